@@ -1,6 +1,7 @@
 package main
 
 import (
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -67,14 +68,90 @@ func TestAofPersistence(t *testing.T) {
 		t.Fatalf("failed to read aof: %v", err)
 	}
 
-	if v, ok := SETMap["key1"]; !ok || v != "value1" {
-		t.Fatalf("expected SET key1=value1, got %v (exists=%v)", v, ok)
+	obj := keyspace.Lookup("key1")
+	if obj == nil || obj.typ != TypeString || obj.value.(string) != "value1" {
+		t.Fatalf("expected SET key1=value1, got %+v", obj)
 	}
 
-	if _, ok := HSETMap["myhash"]; !ok {
-		t.Fatalf("expected HSET map for 'myhash' to exist")
+	obj = keyspace.Lookup("myhash")
+	if obj == nil || obj.typ != TypeHash {
+		t.Fatalf("expected hash for 'myhash' to exist, got %+v", obj)
 	}
-	if hv, ok := HSETMap["myhash"]["field1"]; !ok || hv != "hvalue1" {
+	if hv, ok := obj.value.(*Hash).Get("field1"); !ok || hv != "hvalue1" {
 		t.Fatalf("expected HSET myhash.field1=hvalue1, got %v (exists=%v)", hv, ok)
 	}
 }
+
+// propagated runs inputs on a connection backed by a fresh AOF and returns
+// the commands that ended up in it.
+func propagated(t *testing.T, inputs ...Value) []Value {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.aof")
+	aof, err := NewAof(path)
+	if err != nil {
+		t.Fatalf("failed to create aof: %v", err)
+	}
+
+	cmdHandler := NewCommandHandler()
+	cmdHandler.aof = aof
+	for _, input := range inputs {
+		if _, err := cmdHandler.Handle(input.array[0].bulk, input.array[1:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aof.Close()
+
+	aof, err = NewAof(path)
+	if err != nil {
+		t.Fatalf("failed to open aof: %v", err)
+	}
+	defer aof.Close()
+
+	var logged []Value
+	aof.Read(func(value Value) {
+		logged = append(logged, value)
+	})
+
+	return logged
+}
+
+func assertPropagated(t *testing.T, logged []Value, expected []Value) {
+	t.Helper()
+
+	if len(logged) != len(expected) {
+		t.Fatalf("expected %d logged commands, got %d: %v", len(expected), len(logged), logged)
+	}
+	for i := range expected {
+		if string(logged[i].Serialize()) != string(expected[i].Serialize()) {
+			t.Errorf("expected %q at index %d, got %q", expected[i].Serialize(), i, logged[i].Serialize())
+		}
+	}
+}
+
+func TestAofLoadWithRequirePass(t *testing.T) {
+	requirePass = "secret"
+	defer func() { requirePass = "" }()
+
+	path := filepath.Join(t.TempDir(), "test.aof")
+	aof, err := NewAof(path)
+	if err != nil {
+		t.Fatalf("failed to create aof: %v", err)
+	}
+	defer aof.Close()
+
+	if err := aof.Write(makeCommand("SET", "aof:auth", "value")); err != nil {
+		t.Fatalf("failed to write to aof: %v", err)
+	}
+	if _, err := aof.file.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loadAof(aof); err != nil {
+		t.Fatalf("expected the aof to load, got %v", err)
+	}
+
+	if obj := keyspace.Lookup("aof:auth"); obj == nil || obj.value.(string) != "value" {
+		t.Fatalf("expected aof:auth=value, got %+v", obj)
+	}
+}
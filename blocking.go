@@ -0,0 +1,207 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// blockState describes what a blocked client waits for.
+type blockState struct {
+	keys         []string
+	typ          string
+	timeout      time.Duration
+	timeoutReply Value
+}
+
+// blockedClient is a client parked on keys until one of them can serve its
+// command. Serving it executes the command again, through the client's own
+// handler, and sends the reply to the connection waiting in WaitUnblocked.
+type blockedClient struct {
+	handler *CommandHandler
+	cmd     Command
+	command string
+	args    []Value
+	state   *blockState
+	reply   chan Value
+}
+
+// blockClient registers the client of handler, whose last command asked to
+// block, on the keys it waits for.
+func (ks *Keyspace) blockClient(handler *CommandHandler, cmd Command, command string, args []Value) *blockedClient {
+	bc := &blockedClient{
+		handler: handler,
+		cmd:     cmd,
+		command: command,
+		args:    args,
+		state:   handler.client.bstate,
+		reply:   make(chan Value, 1),
+	}
+	handler.client.bstate = nil
+
+	for _, key := range bc.state.keys {
+		if !slices.Contains(ks.blocking[key], bc) {
+			ks.blocking[key] = append(ks.blocking[key], bc)
+		}
+	}
+
+	return bc
+}
+
+// unblockClient removes bc from every key it is blocked on. It reports false
+// if bc was already served.
+func (ks *Keyspace) unblockClient(bc *blockedClient) bool {
+	found := false
+	for _, key := range bc.state.keys {
+		clients := ks.blocking[key]
+		i := slices.Index(clients, bc)
+		if i < 0 {
+			continue
+		}
+		found = true
+
+		if len(clients) == 1 {
+			delete(ks.blocking, key)
+		} else {
+			ks.blocking[key] = slices.Delete(clients, i, i+1)
+		}
+	}
+
+	return found
+}
+
+// signalKeyAsReady marks key as possibly able to serve the clients blocked on
+// it. They are served once the command being executed is done.
+func (ks *Keyspace) signalKeyAsReady(key string) {
+	if _, ok := ks.blocking[key]; !ok || slices.Contains(ks.readyKeys, key) {
+		return
+	}
+
+	ks.readyKeys = append(ks.readyKeys, key)
+}
+
+// handleClientsBlockedOnKeys serves the clients blocked on the ready keys in
+// the order they blocked. Serving a client can make other keys ready, like
+// BLMOVE pushing to its destination, so it loops until no key is left.
+func (ks *Keyspace) handleClientsBlockedOnKeys() {
+	for len(ks.readyKeys) > 0 {
+		ready := ks.readyKeys
+		ks.readyKeys = nil
+
+		for _, key := range ready {
+			ks.serveClientsBlockedOnKey(key)
+		}
+	}
+}
+
+func (ks *Keyspace) serveClientsBlockedOnKey(key string) {
+	for _, bc := range slices.Clone(ks.blocking[key]) {
+		obj := ks.Lookup(key)
+		if obj == nil {
+			return
+		}
+		// A client waiting for another type keeps its place, while those
+		// behind it may still be served.
+		if obj.typ != bc.state.typ {
+			continue
+		}
+
+		// The command blocking again means the key can't serve this
+		// client, which keeps its place. Others may still be served, like
+		// stream readers waiting for different IDs or groups.
+		result := bc.handler.call(bc.cmd, bc.command, bc.args)
+		if bc.handler.client.bstate != nil {
+			bc.handler.client.bstate = nil
+			continue
+		}
+
+		ks.unblockClient(bc)
+		bc.reply <- result
+	}
+}
+
+// Blocked reports whether the last command blocked the client, in which case
+// its reply has to be waited for with WaitUnblocked.
+func (c *CommandHandler) Blocked() bool {
+	return c.blocked != nil
+}
+
+// WaitUnblocked parks the connection until the blocked command is served or
+// times out, and returns its reply. It reports false if closed is closed
+// first, when the client went away: the command is given up on then, so it
+// doesn't take an element nobody would receive.
+func (c *CommandHandler) WaitUnblocked(closed <-chan struct{}) (Value, bool) {
+	bc := c.blocked
+	c.blocked = nil
+
+	var timeout <-chan time.Time
+	if bc.state.timeout > 0 {
+		timer := time.NewTimer(bc.state.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case result := <-bc.reply:
+		return result, true
+	case <-closed:
+		keyspace.mutex.Lock()
+		defer keyspace.mutex.Unlock()
+
+		keyspace.unblockClient(bc)
+		return Value{}, false
+	case <-timeout:
+	}
+
+	keyspace.mutex.Lock()
+	defer keyspace.mutex.Unlock()
+
+	// The client may have been served right as the timer fired.
+	if !keyspace.unblockClient(bc) {
+		return <-bc.reply, true
+	}
+
+	return bc.state.timeoutReply, true
+}
+
+// Unblock gives up on the blocked command without waiting for its reply, so
+// a closed connection doesn't get served.
+func (c *CommandHandler) Unblock() {
+	keyspace.mutex.Lock()
+	defer keyspace.mutex.Unlock()
+
+	keyspace.unblockClient(c.blocked)
+	c.blocked = nil
+}
+
+// parseTimeout parses the timeout argument of the blocking commands, in
+// seconds with an optional fractional part.
+func parseTimeout(arg string) (time.Duration, *RespError) {
+	seconds, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, NewErr("timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, NewErr("timeout is negative")
+	}
+	if seconds*1000 > math.MaxInt64/float64(time.Millisecond) {
+		return 0, NewErr("timeout is out of range")
+	}
+
+	return time.Duration(seconds * 1000 * float64(time.Millisecond)), nil
+}
+
+// parseTimeoutMs parses the timeout of commands taking it in milliseconds,
+// like the BLOCK option of XREAD.
+func parseTimeoutMs(arg string) (time.Duration, *RespError) {
+	ms, ok := parseInteger(arg)
+	if !ok || ms > math.MaxInt64/int64(time.Millisecond) {
+		return 0, NewErr("timeout is not an integer or out of range")
+	}
+	if ms < 0 {
+		return 0, NewErr("timeout is negative")
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// blockOn runs a blocking command on a new client and returns a channel that
+// receives its serialized reply once it is served.
+func blockOn(t *testing.T, cmdHandler *CommandHandler, input Value) <-chan string {
+	t.Helper()
+
+	result, err := cmdHandler.Handle(input.array[0].bulk, input.array[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmdHandler.Blocked() {
+		t.Fatalf("expected the client to block, got %q", result.Serialize())
+	}
+
+	reply := make(chan string, 1)
+	go func() {
+		result, _ := cmdHandler.WaitUnblocked(nil)
+		reply <- string(result.SerializeProto(cmdHandler.client.proto))
+	}()
+
+	return reply
+}
+
+func waitReply(t *testing.T, reply <-chan string) string {
+	t.Helper()
+
+	select {
+	case result := <-reply:
+		return result
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the blocked client")
+		return ""
+	}
+}
+
+func TestBlockingPopServedByPush(t *testing.T) {
+	reply := blockOn(t, NewCommandHandler(), makeCommand("BLPOP", "block:a", "block:b", "0"))
+
+	result := runCommands(t, makeCommand("RPUSH", "block:b", "x", "y"), makeCommand("LRANGE", "block:b", "0", "-1"))
+	if expected := "*1\r\n$1\r\ny\r\n"; result != expected {
+		t.Errorf("expected %q left in the list, got %q", expected, result)
+	}
+
+	if result, expected := waitReply(t, reply), "*2\r\n$7\r\nblock:b\r\n$1\r\nx\r\n"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestBlockingPopFIFO(t *testing.T) {
+	first := blockOn(t, NewCommandHandler(), makeCommand("BRPOP", "block:fifo", "0"))
+	second := blockOn(t, NewCommandHandler(), makeCommand("BRPOP", "block:fifo", "0"))
+
+	runCommands(t, makeCommand("RPUSH", "block:fifo", "a", "b"))
+
+	if result, expected := waitReply(t, first), "*2\r\n$10\r\nblock:fifo\r\n$1\r\nb\r\n"; result != expected {
+		t.Errorf("expected the first client to get %q, got %q", expected, result)
+	}
+	if result, expected := waitReply(t, second), "*2\r\n$10\r\nblock:fifo\r\n$1\r\na\r\n"; result != expected {
+		t.Errorf("expected the second client to get %q, got %q", expected, result)
+	}
+}
+
+func TestBlockingPopTimeout(t *testing.T) {
+	reply := blockOn(t, NewCommandHandler(), makeCommand("BLPOP", "block:timeout", "0.01"))
+
+	if result, expected := waitReply(t, reply), "*-1\r\n"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+
+	// The timed out client must not swallow what gets pushed afterwards.
+	result := runCommands(t, makeCommand("RPUSH", "block:timeout", "a"), makeCommand("LLEN", "block:timeout"))
+	if expected := ":1\r\n"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestBlockingIgnoresWrongType(t *testing.T) {
+	cmdHandler := NewCommandHandler()
+	reply := blockOn(t, cmdHandler, makeCommand("BLPOP", "block:type", "0"))
+
+	runCommands(t, makeCommand("SET", "block:type", "v"))
+	select {
+	case result := <-reply:
+		t.Fatalf("expected the client to stay blocked, got %q", result)
+	default:
+	}
+
+	keyspace.mutex.Lock()
+	keyspace.Delete("block:type")
+	keyspace.mutex.Unlock()
+
+	runCommands(t, makeCommand("LPUSH", "block:type", "a"))
+	if result, expected := waitReply(t, reply), "*2\r\n$10\r\nblock:type\r\n$1\r\na\r\n"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestBlockingServesWaitersBehindOtherTypes(t *testing.T) {
+	zpop := blockOn(t, NewCommandHandler(), makeCommand("BZPOPMIN", "block:mixed", "0"))
+	lpop := blockOn(t, NewCommandHandler(), makeCommand("BLPOP", "block:mixed", "0"))
+
+	runCommands(t, makeCommand("LPUSH", "block:mixed", "a"))
+	if result, expected := waitReply(t, lpop), "*2\r\n$11\r\nblock:mixed\r\n$1\r\na\r\n"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+
+	// The zset waiter kept its place once the key can serve it.
+	runCommands(t, makeCommand("ZADD", "block:mixed", "1", "m"))
+	if result, expected := waitReply(t, zpop), "*3\r\n$11\r\nblock:mixed\r\n$1\r\nm\r\n$1\r\n1\r\n"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestBlockingCommandsNotBlocking(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{
+			name:     "blpop with data",
+			input:    []Value{makeCommand("RPUSH", "block:data", "a"), makeCommand("BLPOP", "block:data", "0")},
+			expected: "*2\r\n$10\r\nblock:data\r\n$1\r\na\r\n",
+		},
+		{
+			name:     "blmove with data",
+			input:    []Value{makeCommand("RPUSH", "block:src", "a", "b"), makeCommand("BLMOVE", "block:src", "block:dst", "LEFT", "RIGHT", "0")},
+			expected: "$1\r\na\r\n",
+		},
+		{
+			name:     "blmpop with data",
+			input:    []Value{makeCommand("RPUSH", "block:mpop", "a", "b"), makeCommand("BLMPOP", "0", "1", "block:mpop", "LEFT", "COUNT", "5")},
+			expected: "*2\r\n$10\r\nblock:mpop\r\n*2\r\n$1\r\na\r\n$1\r\nb\r\n",
+		},
+		{name: "negative timeout", input: []Value{makeCommand("BLPOP", "block:neg", "-1")}, expected: "-ERR timeout is negative\r\n"},
+		{name: "invalid timeout", input: []Value{makeCommand("BLPOP", "block:neg", "x")}, expected: "-ERR timeout is not a float or out of range\r\n"},
+		{
+			name:     "blpop on a string",
+			input:    []Value{makeCommand("SET", "block:str", "v"), makeCommand("BLPOP", "block:str", "0")},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCommands(t, tt.input...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestBlockingPropagation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.aof")
+	aof, err := NewAof(path)
+	if err != nil {
+		t.Fatalf("failed to create aof: %v", err)
+	}
+
+	blocked := NewCommandHandler()
+	blocked.aof = aof
+	popped := blockOn(t, blocked, makeCommand("BLMOVE", "block:aof", "block:aof:dst", "RIGHT", "LEFT", "0"))
+
+	pusher := NewCommandHandler()
+	pusher.aof = aof
+	push := makeCommand("RPUSH", "block:aof", "a", "b")
+	if _, err := pusher.Handle(push.array[0].bulk, push.array[1:]); err != nil {
+		t.Fatal(err)
+	}
+	waitReply(t, popped)
+	aof.Close()
+
+	aof, err = NewAof(path)
+	if err != nil {
+		t.Fatalf("failed to open aof: %v", err)
+	}
+	defer aof.Close()
+
+	var logged []Value
+	aof.Read(func(value Value) {
+		logged = append(logged, value)
+	})
+
+	expected := []Value{
+		makeCommand("RPUSH", "block:aof", "a", "b"),
+		makeCommand("LMOVE", "block:aof", "block:aof:dst", "RIGHT", "LEFT"),
+	}
+	assertPropagated(t, logged, expected)
+}
+
+func TestBlockingZPopServedByZAdd(t *testing.T) {
+	reply := blockOn(t, NewCommandHandler(), makeCommand("BZPOPMAX", "block:zset", "0"))
+
+	runCommands(t, makeCommand("ZADD", "block:zset", "1", "a", "2", "b"))
+
+	if result, expected := waitReply(t, reply), "*3\r\n$10\r\nblock:zset\r\n$1\r\nb\r\n$1\r\n2\r\n"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestBlockingZPopBehindListWaiter(t *testing.T) {
+	lpop := blockOn(t, NewCommandHandler(), makeCommand("BLPOP", "block:zmixed", "0"))
+	zpop := blockOn(t, NewCommandHandler(), makeCommand("BZPOPMIN", "block:zmixed", "0"))
+
+	runCommands(t, makeCommand("ZADD", "block:zmixed", "1", "a"))
+	if result, expected := waitReply(t, zpop), "*3\r\n$12\r\nblock:zmixed\r\n$1\r\na\r\n$1\r\n1\r\n"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+
+	runCommands(t, makeCommand("RPUSH", "block:zmixed", "b"))
+	if result, expected := waitReply(t, lpop), "*2\r\n$12\r\nblock:zmixed\r\n$1\r\nb\r\n"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestBlockingZPopPropagation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.aof")
+	aof, err := NewAof(path)
+	if err != nil {
+		t.Fatalf("failed to create aof: %v", err)
+	}
+
+	blocked := NewCommandHandler()
+	blocked.aof = aof
+	popped := blockOn(t, blocked, makeCommand("BZPOPMIN", "block:zaof", "0"))
+
+	pusher := NewCommandHandler()
+	pusher.aof = aof
+	add := makeCommand("ZADD", "block:zaof", "1", "a")
+	if _, err := pusher.Handle(add.array[0].bulk, add.array[1:]); err != nil {
+		t.Fatal(err)
+	}
+	waitReply(t, popped)
+	aof.Close()
+
+	aof, err = NewAof(path)
+	if err != nil {
+		t.Fatalf("failed to open aof: %v", err)
+	}
+	defer aof.Close()
+
+	var logged []Value
+	aof.Read(func(value Value) {
+		logged = append(logged, value)
+	})
+
+	expected := []Value{
+		makeCommand("ZADD", "block:zaof", "1", "a"),
+		makeCommand("ZPOPMIN", "block:zaof"),
+	}
+	assertPropagated(t, logged, expected)
+}
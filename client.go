@@ -0,0 +1,75 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+var nextClientID atomic.Int64
+
+// requirePass is the password of the default user. An empty password means
+// every connection starts out authenticated.
+var requirePass string
+
+// Client holds the per-connection state that outlives a single command.
+type Client struct {
+	id            int64
+	name          string
+	proto         int
+	authenticated bool
+
+	// keys holds the positions of the key arguments of the command being
+	// executed, with the command name at position 0.
+	keys []int
+
+	// propagate holds the commands written to the AOF once the command being
+	// executed modified the dataset. It starts out as the command itself;
+	// handlers whose effect wouldn't be the same on replay rewrite it.
+	propagate []Value
+
+	// bstate is set by a blocking command that found nothing to serve, and
+	// tells the command handler to park the client.
+	bstate *blockState
+}
+
+func NewClient() *Client {
+	return &Client{
+		id:            nextClientID.Add(1),
+		proto:         RESP2,
+		authenticated: requirePass == "",
+	}
+}
+
+// authenticate logs the client in as user, which only succeeds for the
+// default user with the right password, if one is required at all.
+func (c *Client) authenticate(user, pass string) bool {
+	if user != "default" || (requirePass != "" && pass != requirePass) {
+		return false
+	}
+
+	c.authenticated = true
+	return true
+}
+
+// rewriteCommand replaces what gets propagated for the current command.
+func (c *Client) rewriteCommand(argv ...string) {
+	c.propagate = []Value{MakeCommandValue(argv...)}
+}
+
+// block asks for the current command to be executed again once one of keys
+// holds a value of type typ, or to reply with timeoutReply when timeout
+// elapses first. A zero timeout blocks forever.
+func (c *Client) block(keys []string, typ string, timeout time.Duration, timeoutReply Value) {
+	c.bstate = &blockState{keys: keys, typ: typ, timeout: timeout, timeoutReply: timeoutReply}
+}
+
+// alsoPropagate adds a command to propagate after the current one.
+func (c *Client) alsoPropagate(argv ...string) {
+	c.propagate = append(c.propagate, MakeCommandValue(argv...))
+}
+
+// preventPropagation keeps the current command out of the AOF, for commands
+// that propagate their effects with alsoPropagate instead.
+func (c *Client) preventPropagation() {
+	c.propagate = nil
+}
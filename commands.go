@@ -1,15 +1,18 @@
 package main
 
 import (
-	"fmt"
+	"log"
+	"slices"
+	"strconv"
 	"strings"
-	"sync"
 )
 
+const serverVersion = "7.4.0"
+
 type Details struct {
 	name              string
 	arity             int
-	flags             interface{}
+	flags             []string
 	firstKey          int
 	lastKey           int
 	step              int
@@ -19,20 +22,59 @@ type Details struct {
 	subcommands       interface{}
 }
 
+// CheckArity reports whether argc, the number of arguments including the
+// command name, fits the arity. A negative arity means "at least -arity".
+func (d *Details) CheckArity(argc int) bool {
+	if d.arity < 0 {
+		return argc >= -d.arity
+	}
+	return argc == d.arity
+}
+
+// KeyPositions returns the positions of the key arguments in a call with
+// argc arguments, counting the command name as position 0. A negative
+// lastKey counts back from the end of the call.
+func (d *Details) KeyPositions(argc int) []int {
+	if d.firstKey == 0 {
+		return nil
+	}
+
+	last := d.lastKey
+	if last < 0 {
+		last = argc + last
+	}
+
+	positions := make([]int, 0, (last-d.firstKey)/d.step+1)
+	for i := d.firstKey; i <= last && i < argc; i += d.step {
+		positions = append(positions, i)
+	}
+
+	return positions
+}
+
+func (d *Details) HasFlag(flag string) bool {
+	return slices.Contains(d.flags, flag)
+}
+
 func (d *Details) ToValue() Value {
 	val := Value{typ: "array", array: make([]Value, 0, 10)}
 	val.array = append(val.array, MakeStringValue(d.name))
 	val.array = append(val.array, MakeIntValue(d.arity))
-	val.array = append(val.array, MakeNilValue())
+
+	flags := make([]Value, len(d.flags))
+	for i, v := range d.flags {
+		flags[i] = MakeStringValue(v)
+	}
+	val.array = append(val.array, MakeSetValue(flags...))
 	val.array = append(val.array, MakeIntValue(d.firstKey))
 	val.array = append(val.array, MakeIntValue(d.lastKey))
 	val.array = append(val.array, MakeIntValue(d.step))
 
-	args := make([]any, len(d.aclCategories))
+	categories := make([]Value, len(d.aclCategories))
 	for i, v := range d.aclCategories {
-		args[i] = v
+		categories[i] = MakeStringValue(v)
 	}
-	val.array = append(val.array, MakeArrayValue(args...))
+	val.array = append(val.array, MakeSetValue(categories...))
 
 	val.array = append(val.array, MakeNilValue())
 	val.array = append(val.array, MakeNilValue())
@@ -43,11 +85,17 @@ func (d *Details) ToValue() Value {
 
 type Command struct {
 	details Details
-	handler func([]Value) Value
+	handler func(*Client, []Value) Value
 }
 
 type CommandHandler struct {
 	commands map[string]Command
+	client   *Client
+	aof      *Aof
+
+	// blocked is set when the last command blocked the client, until
+	// WaitUnblocked returns its reply.
+	blocked *blockedClient
 }
 
 func NewCommandHandler() *CommandHandler {
@@ -56,8 +104,8 @@ func NewCommandHandler() *CommandHandler {
 	commands["COMMAND"] = Command{
 		details: Details{
 			name:              "command",
-			arity:             1,
-			flags:             nil,
+			arity:             -1,
+			flags:             []string{"loading", "stale"},
 			firstKey:          0,
 			lastKey:           0,
 			step:              0,
@@ -73,7 +121,7 @@ func NewCommandHandler() *CommandHandler {
 		details: Details{
 			name:              "ping",
 			arity:             -1,
-			flags:             nil,
+			flags:             []string{"fast"},
 			firstKey:          0,
 			lastKey:           0,
 			step:              0,
@@ -85,116 +133,119 @@ func NewCommandHandler() *CommandHandler {
 		handler: ping,
 	}
 
-	commands["SET"] = Command{
+	commands["HELLO"] = Command{
 		details: Details{
-			name:              "set",
-			arity:             3,
-			flags:             nil,
-			firstKey:          1,
-			lastKey:           1,
-			step:              1,
-			aclCategories:     []string{"@write", "@string", "@fast"},
+			name:              "hello",
+			arity:             -1,
+			flags:             []string{"noscript", "loading", "stale", "fast", "no-auth"},
+			firstKey:          0,
+			lastKey:           0,
+			step:              0,
+			aclCategories:     []string{"@fast", "@connection"},
 			tips:              nil,
 			keySpecifications: nil,
 			subcommands:       nil,
 		},
-		handler: set,
+		handler: hello,
 	}
 
-	commands["GET"] = Command{
+	commands["AUTH"] = Command{
 		details: Details{
-			name:              "get",
-			arity:             2,
-			flags:             nil,
-			firstKey:          1,
-			lastKey:           1,
-			step:              1,
-			aclCategories:     []string{"@read", "@string", "@fast"},
+			name:              "auth",
+			arity:             -2,
+			flags:             []string{"noscript", "loading", "stale", "fast", "no-auth"},
+			firstKey:          0,
+			lastKey:           0,
+			step:              0,
+			aclCategories:     []string{"@fast", "@connection"},
 			tips:              nil,
 			keySpecifications: nil,
 			subcommands:       nil,
 		},
-		handler: get,
+		handler: auth,
 	}
 
-	commands["HSET"] = Command{
-		details: Details{
-			name:              "hset",
-			arity:             4,
-			flags:             nil,
-			firstKey:          1,
-			lastKey:           1,
-			step:              1,
-			aclCategories:     []string{"@write", "@hash", "@fast"},
-			tips:              nil,
-			keySpecifications: nil,
-			subcommands:       nil,
-		},
-		handler: hset,
+	registerKeyspaceCommands(commands)
+	registerExpireCommands(commands)
+	registerStringCommands(commands)
+	registerHashCommands(commands)
+	registerHashExpireCommands(commands)
+	registerListCommands(commands)
+	registerSetCommands(commands)
+	registerZSetCommands(commands)
+	registerStreamCommands(commands)
+	registerStreamGroupCommands(commands)
+
+	return &CommandHandler{commands: commands, client: NewClient()}
+}
+
+func (c *CommandHandler) Handle(command string, args []Value) (Value, error) {
+	cmd, ok := c.commands[strings.ToUpper(command)]
+	if !ok {
+		return Value{}, ErrUnknownCommand(command, args)
 	}
 
-	commands["HGET"] = Command{
-		details: Details{
-			name:              "hget",
-			arity:             3,
-			flags:             nil,
-			firstKey:          1,
-			lastKey:           1,
-			step:              1,
-			aclCategories:     []string{"@read", "@hash", "@fast"},
-			tips:              nil,
-			keySpecifications: nil,
-			subcommands:       nil,
-		},
-		handler: hget,
+	if !c.client.authenticated && !cmd.details.HasFlag("no-auth") {
+		return Value{}, ErrNoAuth
 	}
 
-	commands["HGETALL"] = Command{
-		details: Details{
-			name:              "hgetall",
-			arity:             2,
-			flags:             nil,
-			firstKey:          1,
-			lastKey:           1,
-			step:              1,
-			aclCategories:     []string{"@read", "@hash", "@fast"},
-			tips:              nil,
-			keySpecifications: nil,
-			subcommands:       nil,
-		},
-		handler: hgetall,
+	if !cmd.details.CheckArity(len(args) + 1) {
+		return Value{}, ErrWrongArity(cmd.details.name)
 	}
 
-	return &CommandHandler{commands: commands}
-}
+	keyspace.mutex.Lock()
+	defer keyspace.mutex.Unlock()
 
-var SETMap = map[string]string{}
-var SETMapMutex = sync.RWMutex{}
+	result := c.call(cmd, command, args)
+	if c.client.bstate != nil {
+		c.blocked = keyspace.blockClient(c, cmd, command, args)
+	}
 
-var HSETMap = map[string]map[string]string{}
-var HSETMapMutex = sync.RWMutex{}
+	// Serving the clients blocked on keys this command pushed to happens
+	// before anything else runs, so the pops are atomic with the push.
+	keyspace.handleClientsBlockedOnKeys()
 
-func (c *CommandHandler) Handle(command string, args []Value) (Value, error) {
-	cmd, ok := c.commands[command]
-	if !ok {
-		return Value{}, fmt.Errorf("Invalid command: %s", command)
+	return result, nil
+}
+
+// call executes cmd and propagates it to the AOF if it modified the dataset.
+// The keyspace must be locked.
+func (c *CommandHandler) call(cmd Command, command string, args []Value) Value {
+	c.client.keys = cmd.details.KeyPositions(len(args) + 1)
+
+	argv := append([]Value{MakeBulkValue(command)}, args...)
+	c.client.propagate = []Value{{typ: "array", array: argv}}
+	c.client.bstate = nil
+
+	dirty := keyspace.dirty
+	result := cmd.handler(c.client, args)
+
+	// The AOF is written while the keyspace is still locked, so the log
+	// keeps the order in which commands were actually executed.
+	if c.aof != nil && cmd.details.HasFlag("write") && keyspace.dirty != dirty {
+		for _, v := range c.client.propagate {
+			if err := c.aof.Write(v); err != nil {
+				log.Println("error writing to aof:", err)
+			}
+		}
 	}
-	return cmd.handler(args), nil
+
+	return result
 }
 
 func commandDocs() Value {
 	return Value{typ: "map"}
 }
 
-func command(args []Value) Value {
+func command(c *Client, args []Value) Value {
 	if len(args) > 1 {
-		return Value{typ: "error", str: "ERR wrong number of arguments for 'command' command"}
+		return ErrWrongArity("command").Value()
 	}
 	if len(args) == 1 {
 		if strings.ToUpper(args[0].bulk) == "DOCS" {
 			return commandDocs()
 		}
-		return Value{typ: "error", str: "ERR invalid argument at index 1"}
+		return NewErr("invalid argument at index 1").Value()
 	}
 
 	cmdHandler := NewCommandHandler()
@@ -207,7 +258,7 @@ func command(args []Value) Value {
 	return value
 }
 
-func ping(args []Value) Value {
+func ping(c *Client, args []Value) Value {
 	if len(args) == 0 {
 		return Value{typ: "string", str: "PONG"}
 	}
@@ -215,98 +266,75 @@ func ping(args []Value) Value {
 	return Value{typ: "string", str: args[0].bulk}
 }
 
-func set(args []Value) Value {
-	if len(args) != 2 {
-		return Value{typ: "error", str: "ERR wrong number of arguments for 'set' command"}
-	}
-
-	key := args[0].bulk
-	val := args[1].bulk
-
-	SETMapMutex.Lock()
-	SETMap[key] = val
-	SETMapMutex.Unlock()
-
-	return Value{typ: "string", str: "OK"}
-}
-
-func get(args []Value) Value {
-	if len(args) != 1 {
-		return Value{typ: "error", str: "ERR wrong number of arguments for 'get' command"}
-	}
-
-	key := args[0].bulk
-	SETMapMutex.RLock()
-	val, ok := SETMap[key]
-	SETMapMutex.RUnlock()
-
-	if !ok {
-		return Value{typ: "null"}
-	}
-
-	return Value{typ: "bulk", bulk: val}
-}
-
-func hset(args []Value) Value {
-	if len(args) != 3 {
-		return Value{typ: "error", str: "ERR wrong number of arguments for 'hset' command"}
-	}
-
-	hash := args[0].bulk
-	key := args[1].bulk
-	val := args[2].bulk
-
-	HSETMapMutex.Lock()
-	if _, ok := HSETMap[hash]; !ok {
-		HSETMap[hash] = make(map[string]string)
-	}
-	HSETMap[hash][key] = val
-	HSETMapMutex.Unlock()
-
-	return Value{typ: "string", str: "OK"}
-}
+func hello(c *Client, args []Value) Value {
+	proto, name, setName := c.proto, "", false
+	if len(args) > 0 {
+		var err error
+		proto, err = strconv.Atoi(args[0].bulk)
+		if err != nil {
+			return NewErr("Protocol version is not an integer or out of range").Value()
+		}
+		if proto != RESP2 && proto != RESP3 {
+			return ErrNoProto.Value()
+		}
 
-func hget(args []Value) Value {
-	if len(args) != 2 {
-		return Value{typ: "error", str: "ERR wrong number of arguments for 'hget' command"}
+		for i := 1; i < len(args); i++ {
+			moreArgs := len(args) - i - 1
+			switch opt := strings.ToUpper(args[i].bulk); {
+			case opt == "AUTH" && moreArgs >= 2:
+				if !c.authenticate(args[i+1].bulk, args[i+2].bulk) {
+					return ErrWrongPass.Value()
+				}
+				i += 2
+			case opt == "SETNAME" && moreArgs >= 1:
+				name, setName = args[i+1].bulk, true
+				if strings.ContainsFunc(name, func(r rune) bool { return r <= ' ' || r > '~' }) {
+					return NewErr("Client names cannot contain spaces, newlines or special characters.").Value()
+				}
+				i++
+			default:
+				return NewErr("Syntax error in HELLO option '%s'", args[i].bulk).Value()
+			}
+		}
 	}
 
-	hash := args[0].bulk
-	key := args[1].bulk
-
-	HSETMapMutex.RLock()
-	defer HSETMapMutex.RUnlock()
-
-	if _, ok := HSETMap[hash]; !ok {
-		return Value{typ: "null"}
+	// Even HELLO without arguments needs authentication, as it tells about
+	// the server.
+	if !c.authenticated {
+		return NewRespError("NOAUTH", "HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time").Value()
 	}
-	val, ok := HSETMap[hash][key]
 
-	if !ok {
-		return Value{typ: "null"}
+	if setName {
+		c.name = name
 	}
-
-	return Value{typ: "bulk", bulk: val}
+	c.proto = proto
+
+	return MakeMapValue(
+		MakeBulkValue("server"), MakeBulkValue("redis"),
+		MakeBulkValue("version"), MakeBulkValue(serverVersion),
+		MakeBulkValue("proto"), MakeIntValue(c.proto),
+		MakeBulkValue("id"), MakeIntValue(int(c.id)),
+		MakeBulkValue("mode"), MakeBulkValue("standalone"),
+		MakeBulkValue("role"), MakeBulkValue("master"),
+		MakeBulkValue("modules"), Value{typ: "array"},
+	)
 }
 
-func hgetall(args []Value) Value {
-	if len(args) != 1 {
-		return Value{typ: "error", str: "ERR wrong number of arguments for 'hgetall' command"}
+func auth(c *Client, args []Value) Value {
+	if len(args) > 2 {
+		return ErrSyntax.Value()
 	}
 
-	hash := args[0].bulk
-	HSETMapMutex.RLock()
-	defer HSETMapMutex.RUnlock()
-
-	if _, ok := HSETMap[hash]; !ok {
-		return Value{typ: "null"}
+	user, pass := "default", args[0].bulk
+	if len(args) == 2 {
+		user, pass = args[0].bulk, args[1].bulk
+	} else if requirePass == "" {
+		return NewErr("AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?").Value()
 	}
 
-	result := make([]Value, 0, len(HSETMap[hash])*2)
-	for key, val := range HSETMap[hash] {
-		result = append(result, Value{typ: "bulk", bulk: key})
-		result = append(result, Value{typ: "bulk", bulk: val})
+	if !c.authenticate(user, pass) {
+		return ErrWrongPass.Value()
 	}
 
-	return Value{typ: "array", array: result}
+	return MakeStringValue("OK")
 }
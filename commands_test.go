@@ -1,6 +1,7 @@
 package main
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -57,3 +58,189 @@ func TestCommandPing(t *testing.T) {
 		})
 	}
 }
+
+func TestCommandHello(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Value
+		proto    int
+		expected string
+	}{
+		{
+			name:     "unsupported protocol",
+			input:    []Value{makeCommand("HELLO", "4")},
+			proto:    RESP2,
+			expected: "-NOPROTO unsupported protocol version\r\n",
+		},
+		{
+			name:     "invalid option",
+			input:    []Value{makeCommand("HELLO", "3", "FOO")},
+			proto:    RESP2,
+			expected: "-ERR Syntax error in HELLO option 'FOO'\r\n",
+		},
+		{
+			name:     "hgetall in resp2",
+			input:    []Value{makeCommand("HSET", "hello:resp2", "field", "value"), makeCommand("HGETALL", "hello:resp2")},
+			proto:    RESP2,
+			expected: "*2\r\n$5\r\nfield\r\n$5\r\nvalue\r\n",
+		},
+		{
+			name: "hgetall in resp3",
+			input: []Value{
+				makeCommand("HELLO", "3", "SETNAME", "worker"),
+				makeCommand("HSET", "hello:resp3", "field", "value"),
+				makeCommand("HGETALL", "hello:resp3"),
+			},
+			proto:    RESP3,
+			expected: "%1\r\n$5\r\nfield\r\n$5\r\nvalue\r\n",
+		},
+		{
+			name:     "null in resp3",
+			input:    []Value{makeCommand("HELLO", "3"), makeCommand("GET", "hello:missing")},
+			proto:    RESP3,
+			expected: "_\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmdHandler := NewCommandHandler()
+
+			var val Value
+			for _, input := range tt.input {
+				var err error
+				val, err = cmdHandler.Handle(strings.ToUpper(input.array[0].bulk), input.array[1:])
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if cmdHandler.client.proto != tt.proto {
+				t.Errorf("expected protocol %d, got %d", tt.proto, cmdHandler.client.proto)
+			}
+
+			result := string(val.SerializeProto(cmdHandler.client.proto))
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestCommandArity(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    Value
+		expected string
+	}{
+		{name: "get without key", input: makeCommand("GET"), expected: "-ERR wrong number of arguments for 'get' command\r\n"},
+		{name: "get with extra argument", input: makeCommand("GET", "a", "b"), expected: "-ERR wrong number of arguments for 'get' command\r\n"},
+		{name: "hset without value", input: makeCommand("HSET", "h", "f"), expected: "-ERR wrong number of arguments for 'hset' command\r\n"},
+		{name: "variadic hello", input: makeCommand("HELLO"), expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runCommand(tt.input)
+			if tt.expected == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			respErr, ok := err.(*RespError)
+			if !ok {
+				t.Fatalf("expected RespError, got %v", err)
+			}
+
+			result := string(respErr.Value().Serialize())
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestDetailsKeyPositions(t *testing.T) {
+	tests := []struct {
+		name     string
+		details  Details
+		argc     int
+		expected []int
+	}{
+		{name: "no keys", details: Details{firstKey: 0, lastKey: 0, step: 0}, argc: 2, expected: nil},
+		{name: "single key", details: Details{firstKey: 1, lastKey: 1, step: 1}, argc: 3, expected: []int{1}},
+		{name: "every key", details: Details{firstKey: 1, lastKey: -1, step: 1}, argc: 4, expected: []int{1, 2, 3}},
+		{name: "key value pairs", details: Details{firstKey: 1, lastKey: -1, step: 2}, argc: 5, expected: []int{1, 3}},
+		{name: "all but last", details: Details{firstKey: 1, lastKey: -2, step: 1}, argc: 4, expected: []int{1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			positions := tt.details.KeyPositions(tt.argc)
+			if !reflect.DeepEqual(positions, tt.expected) && !(len(positions) == 0 && len(tt.expected) == 0) {
+				t.Errorf("expected %v, got %v", tt.expected, positions)
+			}
+		})
+	}
+}
+
+func TestCommandAuth(t *testing.T) {
+	tests := []struct {
+		name        string
+		requirePass string
+		input       []Value
+		expected    string
+	}{
+		{
+			name:        "password",
+			requirePass: "secret",
+			input:       []Value{makeCommand("AUTH", "secret"), makeCommand("GET", "auth:missing")},
+			expected:    "$-1\r\n",
+		},
+		{
+			name:        "user and password",
+			requirePass: "secret",
+			input:       []Value{makeCommand("AUTH", "default", "secret"), makeCommand("GET", "auth:missing")},
+			expected:    "$-1\r\n",
+		},
+		{name: "wrong password", requirePass: "secret", input: []Value{makeCommand("AUTH", "nope")}, expected: "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+		{name: "wrong user", requirePass: "secret", input: []Value{makeCommand("AUTH", "admin", "secret")}, expected: "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+		{name: "too many arguments", requirePass: "secret", input: []Value{makeCommand("AUTH", "default", "secret", "x")}, expected: "-ERR syntax error\r\n"},
+		{
+			name:     "no password configured",
+			input:    []Value{makeCommand("AUTH", "secret")},
+			expected: "-ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?\r\n",
+		},
+		{name: "no password configured with user", input: []Value{makeCommand("AUTH", "default", "anything")}, expected: "+OK\r\n"},
+		{
+			name:        "hello without arguments",
+			requirePass: "secret",
+			input:       []Value{makeCommand("HELLO")},
+			expected:    "-NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requirePass = tt.requirePass
+			defer func() { requirePass = "" }()
+
+			cmdHandler := NewCommandHandler()
+
+			var val Value
+			for _, input := range tt.input {
+				var err error
+				val, err = cmdHandler.Handle(strings.ToUpper(input.array[0].bulk), input.array[1:])
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if result := string(val.Serialize()); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"math/rand/v2"
+)
+
+const (
+	dictInitialSize = 4
+
+	// dictMinFill is how sparse a table gets before it shrinks: less than
+	// one entry every dictMinFill buckets.
+	dictMinFill = 8
+)
+
+type dictEntry[V any] struct {
+	key  string
+	val  V
+	next *dictEntry[V]
+}
+
+// Dict is a hash table with chaining and a power of two number of buckets.
+// It is used instead of a Go map where the entries have to be scanned: like
+// the Redis dict, its buckets can be visited with a cursor that keeps
+// working while the table grows or shrinks between calls, which the
+// iteration order of a map doesn't allow. Reading from a nil *Dict behaves
+// like reading from an empty one.
+type Dict[V any] struct {
+	table []*dictEntry[V]
+	used  int
+	seed  maphash.Seed
+}
+
+func NewDict[V any]() *Dict[V] {
+	return &Dict[V]{seed: maphash.MakeSeed()}
+}
+
+func (d *Dict[V]) Len() int {
+	if d == nil {
+		return 0
+	}
+
+	return d.used
+}
+
+func (d *Dict[V]) bucket(key string) uint64 {
+	return maphash.String(d.seed, key) & uint64(len(d.table)-1)
+}
+
+func (d *Dict[V]) find(key string) *dictEntry[V] {
+	if d.Len() == 0 {
+		return nil
+	}
+
+	for e := d.table[d.bucket(key)]; e != nil; e = e.next {
+		if e.key == key {
+			return e
+		}
+	}
+
+	return nil
+}
+
+func (d *Dict[V]) Get(key string) (V, bool) {
+	if e := d.find(key); e != nil {
+		return e.val, true
+	}
+
+	var zero V
+	return zero, false
+}
+
+// Set stores val at key and reports whether the key is new.
+func (d *Dict[V]) Set(key string, val V) bool {
+	if e := d.find(key); e != nil {
+		e.val = val
+		return false
+	}
+
+	if d.used >= len(d.table) {
+		d.resize(max(dictInitialSize, len(d.table)*2))
+	}
+
+	i := d.bucket(key)
+	d.table[i] = &dictEntry[V]{key: key, val: val, next: d.table[i]}
+	d.used++
+	return true
+}
+
+func (d *Dict[V]) Delete(key string) bool {
+	if d.Len() == 0 {
+		return false
+	}
+
+	for p := &d.table[d.bucket(key)]; *p != nil; p = &(*p).next {
+		if (*p).key == key {
+			*p = (*p).next
+			d.used--
+			d.shrinkIfNeeded()
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *Dict[V]) shrinkIfNeeded() {
+	if len(d.table) <= dictInitialSize || d.used*dictMinFill >= len(d.table) {
+		return
+	}
+
+	size := dictInitialSize
+	for size < d.used {
+		size *= 2
+	}
+	d.resize(size)
+}
+
+// resize rehashes every entry into a table of size buckets at once. Redis
+// rehashes incrementally to bound the latency of a single command, but Scan
+// only needs the table not to change during a call.
+func (d *Dict[V]) resize(size int) {
+	old := d.table
+	d.table = make([]*dictEntry[V], size)
+
+	for _, e := range old {
+		for e != nil {
+			next := e.next
+			i := d.bucket(e.key)
+			e.next = d.table[i]
+			d.table[i] = e
+			e = next
+		}
+	}
+}
+
+// ForEach calls fn for every entry, which must not modify the dict.
+func (d *Dict[V]) ForEach(fn func(key string, val V)) {
+	if d == nil {
+		return
+	}
+
+	for _, e := range d.table {
+		for ; e != nil; e = e.next {
+			fn(e.key, e.val)
+		}
+	}
+}
+
+// RandomKey returns a random key, and false if the dict is empty. Keys
+// sharing their bucket with others are a bit less likely to be picked, as
+// the bucket is chosen first.
+func (d *Dict[V]) RandomKey() (string, bool) {
+	if d.Len() == 0 {
+		return "", false
+	}
+
+	var e *dictEntry[V]
+	for e == nil {
+		e = d.table[rand.IntN(len(d.table))]
+	}
+
+	n := 0
+	for x := e; x != nil; x = x.next {
+		n++
+	}
+	for i := rand.IntN(n); i > 0; i-- {
+		e = e.next
+	}
+
+	return e.key, true
+}
+
+// Scan calls fn for the entries of the bucket at cursor, and returns the
+// cursor of the next bucket to visit, 0 once every bucket was.
+//
+// Like in Redis, the cursor is incremented on its reversed bits. When the
+// table doubles, bucket i splits into i and i+size, and when it halves they
+// merge back into i: visiting the buckets in reverse binary order means
+// those are always visited together, so every entry present for the whole
+// scan is returned. Some may be returned twice after the table shrinks.
+func (d *Dict[V]) Scan(cursor uint64, fn func(key string, val V)) uint64 {
+	if d.Len() == 0 {
+		return 0
+	}
+
+	mask := uint64(len(d.table) - 1)
+	for e := d.table[cursor&mask]; e != nil; e = e.next {
+		fn(e.key, e.val)
+	}
+
+	// Setting the bits above the mask makes the increment of the reversed
+	// cursor carry over them.
+	cursor |= ^mask
+	cursor = bits.Reverse64(cursor)
+	cursor++
+	return bits.Reverse64(cursor)
+}
+
+// Clone returns a copy of the dict, with the same buckets.
+func (d *Dict[V]) Clone() *Dict[V] {
+	clone := &Dict[V]{table: make([]*dictEntry[V], len(d.table)), used: d.used, seed: d.seed}
+	for i, e := range d.table {
+		for p := &clone.table[i]; e != nil; e = e.next {
+			*p = &dictEntry[V]{key: e.key, val: e.val}
+			p = &(*p).next
+		}
+	}
+
+	return clone
+}
+
+// Clear deletes every entry, unlinking them from each other.
+func (d *Dict[V]) Clear() {
+	if d == nil {
+		return
+	}
+
+	for _, e := range d.table {
+		for e != nil {
+			next := e.next
+			e.next = nil
+			e = next
+		}
+	}
+
+	d.table, d.used = nil, 0
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDict(t *testing.T) {
+	d := NewDict[int]()
+	for i := 0; i < 1000; i++ {
+		if !d.Set(strconv.Itoa(i), i) {
+			t.Fatalf("expected %d to be new", i)
+		}
+	}
+	if d.Set("7", 70) {
+		t.Error("expected overwriting a key not to add it")
+	}
+	if v, ok := d.Get("7"); !ok || v != 70 {
+		t.Errorf("expected 70, got %d (exists=%v)", v, ok)
+	}
+
+	for i := 0; i < 990; i++ {
+		if !d.Delete(strconv.Itoa(i)) {
+			t.Fatalf("expected %d to be deleted", i)
+		}
+	}
+	if d.Delete("0") {
+		t.Error("expected deleting a missing key to fail")
+	}
+
+	if d.Len() != 10 {
+		t.Errorf("expected 10 keys, got %d", d.Len())
+	}
+	if len(d.table) > 16 {
+		t.Errorf("expected the table to shrink, it has %d buckets", len(d.table))
+	}
+	for i := 990; i < 1000; i++ {
+		if v, ok := d.Get(strconv.Itoa(i)); !ok || v != i {
+			t.Errorf("expected %d, got %d (exists=%v)", i, v, ok)
+		}
+	}
+}
+
+// TestDictScanWhileResizing checks the guarantee of the scan cursor: a key
+// present for the whole scan is returned, however much the table grows or
+// shrinks between calls.
+func TestDictScanWhileResizing(t *testing.T) {
+	tests := []struct {
+		name string
+		// resize changes the dict after the call-th call to Scan.
+		resize func(d *Dict[int], call int)
+	}{
+		{name: "stable", resize: func(d *Dict[int], call int) {}},
+		{
+			name: "growing",
+			resize: func(d *Dict[int], call int) {
+				if call >= 20 {
+					return
+				}
+				for i := 0; i < 100; i++ {
+					d.Set("grow:"+strconv.Itoa(call)+":"+strconv.Itoa(i), 0)
+				}
+			},
+		},
+		{
+			name: "shrinking",
+			resize: func(d *Dict[int], call int) {
+				for i := call * 50; i < (call+1)*50; i++ {
+					d.Delete("shrink:" + strconv.Itoa(i))
+				}
+			},
+		},
+		{
+			name: "growing then shrinking",
+			resize: func(d *Dict[int], call int) {
+				switch {
+				case call < 5:
+					for i := 0; i < 500; i++ {
+						d.Set("grow:"+strconv.Itoa(call)+":"+strconv.Itoa(i), 0)
+					}
+				case call == 5:
+					for i := 0; i < 5; i++ {
+						for j := 0; j < 500; j++ {
+							d.Delete("grow:" + strconv.Itoa(i) + ":" + strconv.Itoa(j))
+						}
+					}
+					for i := 0; i < 2000; i++ {
+						d.Delete("shrink:" + strconv.Itoa(i))
+					}
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDict[int]()
+			for i := 0; i < 100; i++ {
+				d.Set("stay:"+strconv.Itoa(i), 0)
+			}
+			for i := 0; i < 2000; i++ {
+				d.Set("shrink:"+strconv.Itoa(i), 0)
+			}
+
+			seen := make(map[string]bool)
+			cursor, calls := uint64(0), 0
+			for {
+				cursor = d.Scan(cursor, func(key string, _ int) { seen[key] = true })
+				if cursor == 0 {
+					break
+				}
+				tt.resize(d, calls)
+				calls++
+			}
+
+			for i := 0; i < 100; i++ {
+				if key := "stay:" + strconv.Itoa(i); !seen[key] {
+					t.Errorf("expected %s to be returned", key)
+				}
+			}
+		})
+	}
+}
+
+func TestStringMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		match   bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h*llo", "hello world", false},
+		{"*llo*", "hello world", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[b-a]llo", "hallo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"[\\]]", "]", true},
+		{"[abc", "b", true},
+		{"user:*:name", "user:1000:name", true},
+		{"user:*:name", "user:1000:email", false},
+		{"a*a*a*a*a*a*a*a*a*b", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", false},
+	}
+
+	for _, tt := range tests {
+		if match := stringMatch(tt.pattern, tt.s); match != tt.match {
+			t.Errorf("expected %q matching %q to be %v", tt.pattern, tt.s, tt.match)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RespError is an error that is sent back to the client as an error reply.
+// The prefix is the first word of the reply, which clients use to tell
+// error kinds apart (ERR, WRONGTYPE, NOAUTH, ...).
+type RespError struct {
+	prefix  string
+	message string
+}
+
+func (e *RespError) Error() string {
+	return e.prefix + " " + e.message
+}
+
+func (e *RespError) Value() Value {
+	return MakeErrorValue(e.Error())
+}
+
+func NewRespError(prefix, format string, args ...any) *RespError {
+	return &RespError{prefix: prefix, message: fmt.Sprintf(format, args...)}
+}
+
+func NewErr(format string, args ...any) *RespError {
+	return NewRespError("ERR", format, args...)
+}
+
+var (
+	ErrWrongType  = NewRespError("WRONGTYPE", "Operation against a key holding the wrong kind of value")
+	ErrNoAuth     = NewRespError("NOAUTH", "Authentication required.")
+	ErrWrongPass  = NewRespError("WRONGPASS", "invalid username-password pair or user is disabled.")
+	ErrNoProto    = NewRespError("NOPROTO", "unsupported protocol version")
+	ErrSyntax     = NewErr("syntax error")
+	ErrNotInteger = NewErr("value is not an integer or out of range")
+	ErrNotFloat   = NewErr("value is not a valid float")
+
+	ErrInvalidStreamID = NewErr("Invalid stream ID specified as stream command argument")
+)
+
+func ErrWrongArity(name string) *RespError {
+	return NewErr("wrong number of arguments for '%s' command", strings.ToLower(name))
+}
+
+// ErrUnknownCommand mirrors the Redis reply, which quotes the first few
+// arguments so the user can spot what was actually sent.
+func ErrUnknownCommand(name string, args []Value) *RespError {
+	var quoted strings.Builder
+	for _, arg := range args {
+		if quoted.Len() >= 128 {
+			break
+		}
+		fmt.Fprintf(&quoted, "'%.*s' ", 128-quoted.Len(), arg.bulk)
+	}
+
+	return NewErr("unknown command '%.128s', with args beginning with: %s", name, quoted.String())
+}
+
+// ProtocolError means the byte stream can no longer be parsed. The server
+// replies with it and closes the connection, since it can't resynchronize.
+type ProtocolError struct {
+	message string
+}
+
+func (e *ProtocolError) Error() string {
+	return "Protocol error: " + e.message
+}
+
+func (e *ProtocolError) Value() Value {
+	return MakeErrorValue("ERR " + e.Error())
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestErrorUnknownCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    Value
+		expected string
+	}{
+		{
+			name:     "without arguments",
+			input:    makeCommand("foo"),
+			expected: "-ERR unknown command 'foo', with args beginning with: \r\n",
+		},
+		{
+			name:     "with arguments",
+			input:    makeCommand("FOO", "bar", "baz"),
+			expected: "-ERR unknown command 'FOO', with args beginning with: 'bar' 'baz' \r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewCommandHandler().Handle(tt.input.array[0].bulk, tt.input.array[1:])
+
+			var respErr *RespError
+			if !errors.As(err, &respErr) {
+				t.Fatalf("expected RespError, got %v", err)
+			}
+
+			result := string(respErr.Value().Serialize())
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestErrorProtocol(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "invalid multibulk length", input: "*x\r\n", expected: "-ERR Protocol error: invalid multibulk length\r\n"},
+		{name: "invalid bulk length", input: "*1\r\n$x\r\n", expected: "-ERR Protocol error: invalid bulk length\r\n"},
+		{name: "multibulk element without type", input: "*2\r\n$3\r\nGET\r\nkey\r\n", expected: "-ERR Protocol error: expected '$', got 'k'\r\n"},
+		{name: "unbalanced quotes", input: "SET key \"value\r\n", expected: "-ERR Protocol error: unbalanced quotes in request\r\n"},
+		{name: "too big inline request", input: "SET key " + strings.Repeat("v", maxInlineLength), expected: "-ERR Protocol error: too big inline request\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := RespReaderFromString(tt.input).Read()
+
+			var protoErr *ProtocolError
+			if !errors.As(err, &protoErr) {
+				t.Fatalf("expected ProtocolError, got %v", err)
+			}
+
+			result := string(protoErr.Value().Serialize())
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestErrorNoAuth(t *testing.T) {
+	requirePass = "secret"
+	defer func() { requirePass = "" }()
+
+	cmdHandler := NewCommandHandler()
+
+	if _, err := cmdHandler.Handle("GET", []Value{MakeBulkValue("key")}); err != ErrNoAuth {
+		t.Fatalf("expected NOAUTH, got %v", err)
+	}
+
+	val, err := cmdHandler.Handle("HELLO", makeCommand("3", "AUTH", "default", "secret").array)
+	if err != nil || val.typ == "error" {
+		t.Fatalf("expected HELLO to authenticate, got %+v, %v", val, err)
+	}
+
+	if _, err := cmdHandler.Handle("GET", []Value{MakeBulkValue("key")}); err != nil {
+		t.Fatalf("expected GET to succeed after HELLO AUTH, got %v", err)
+	}
+}
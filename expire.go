@@ -0,0 +1,314 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+func registerExpireCommands(commands map[string]Command) {
+	commands["EXPIRE"] = Command{
+		details: Details{
+			name:              "expire",
+			arity:             -3,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@keyspace", "@write", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: expire,
+	}
+
+	commands["PEXPIRE"] = Command{
+		details: Details{
+			name:              "pexpire",
+			arity:             -3,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@keyspace", "@write", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: pexpire,
+	}
+
+	commands["EXPIREAT"] = Command{
+		details: Details{
+			name:              "expireat",
+			arity:             -3,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@keyspace", "@write", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: expireat,
+	}
+
+	commands["PEXPIREAT"] = Command{
+		details: Details{
+			name:              "pexpireat",
+			arity:             -3,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@keyspace", "@write", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: pexpireat,
+	}
+
+	commands["TTL"] = Command{
+		details: Details{
+			name:              "ttl",
+			arity:             2,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@keyspace", "@read", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: ttl,
+	}
+
+	commands["PTTL"] = Command{
+		details: Details{
+			name:              "pttl",
+			arity:             2,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@keyspace", "@read", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: pttl,
+	}
+
+	commands["EXPIRETIME"] = Command{
+		details: Details{
+			name:              "expiretime",
+			arity:             2,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@keyspace", "@read", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: expiretime,
+	}
+
+	commands["PEXPIRETIME"] = Command{
+		details: Details{
+			name:              "pexpiretime",
+			arity:             2,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@keyspace", "@read", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: pexpiretime,
+	}
+
+	commands["PERSIST"] = Command{
+		details: Details{
+			name:              "persist",
+			arity:             2,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@keyspace", "@write", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: persist,
+	}
+}
+
+const (
+	expireNX = 1 << iota
+	expireXX
+	expireGT
+	expireLT
+)
+
+func parseExpireFlags(args []Value) (int, *RespError) {
+	flags := 0
+	for _, arg := range args {
+		switch strings.ToUpper(arg.bulk) {
+		case "NX":
+			flags |= expireNX
+		case "XX":
+			flags |= expireXX
+		case "GT":
+			flags |= expireGT
+		case "LT":
+			flags |= expireLT
+		default:
+			return 0, NewErr("Unsupported option %s", arg.bulk)
+		}
+	}
+
+	if flags&expireNX != 0 && flags&(expireXX|expireGT|expireLT) != 0 {
+		return 0, NewErr("NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if flags&expireGT != 0 && flags&expireLT != 0 {
+		return 0, NewErr("GT and LT options at the same time are not compatible")
+	}
+
+	return flags, nil
+}
+
+// expireGeneric implements the EXPIRE family. basetime is the time relative
+// expirations count from (zero for the absolute variants) and unit is the
+// number of milliseconds the argument is expressed in.
+func expireGeneric(c *Client, args []Value, name string, basetime int64, unit int64) Value {
+	key := args[0].bulk
+
+	when, ok := parseInteger(args[1].bulk)
+	if !ok {
+		return ErrNotInteger.Value()
+	}
+
+	flags, err := parseExpireFlags(args[2:])
+	if err != nil {
+		return err.Value()
+	}
+
+	if when > math.MaxInt64/unit || when < math.MinInt64/unit {
+		return NewErr("invalid expire time in '%s' command", name).Value()
+	}
+	when *= unit
+	if when > math.MaxInt64-basetime {
+		return NewErr("invalid expire time in '%s' command", name).Value()
+	}
+	when += basetime
+
+	if !keyspace.Exists(key) {
+		return MakeIntValue(0)
+	}
+
+	// A key without a TTL is treated as having an infinite one.
+	current, hasExpire := keyspace.GetExpire(key)
+	switch {
+	case flags&expireNX != 0 && hasExpire,
+		flags&expireXX != 0 && !hasExpire,
+		flags&expireGT != 0 && (!hasExpire || when <= current),
+		flags&expireLT != 0 && hasExpire && when >= current:
+		return MakeIntValue(0)
+	}
+
+	// Relative times would be extended by a replay, so the absolute time is
+	// propagated. A time in the past deletes the key on replay too.
+	c.rewriteCommand("PEXPIREAT", key, strconv.FormatInt(when, 10))
+	keyspace.dirty++
+
+	if when <= nowMs() {
+		keyspace.Delete(key)
+		return MakeIntValue(1)
+	}
+
+	keyspace.SetExpire(key, when)
+
+	return MakeIntValue(1)
+}
+
+func expire(c *Client, args []Value) Value {
+	return expireGeneric(c, args, "expire", nowMs(), 1000)
+}
+
+func pexpire(c *Client, args []Value) Value {
+	return expireGeneric(c, args, "pexpire", nowMs(), 1)
+}
+
+func expireat(c *Client, args []Value) Value {
+	return expireGeneric(c, args, "expireat", 0, 1000)
+}
+
+func pexpireat(c *Client, args []Value) Value {
+	return expireGeneric(c, args, "pexpireat", 0, 1)
+}
+
+// ttlGeneric implements TTL, PTTL, EXPIRETIME and PEXPIRETIME. It replies
+// -2 for a missing key and -1 for a key without an expire.
+func ttlGeneric(args []Value, outputMs bool, outputAbs bool) Value {
+	key := args[0].bulk
+
+	if !keyspace.Exists(key) {
+		return MakeIntValue(-2)
+	}
+
+	when, ok := keyspace.GetExpire(key)
+	if !ok {
+		return MakeIntValue(-1)
+	}
+
+	ttl := when
+	if !outputAbs {
+		ttl = max(when-nowMs(), 0)
+	}
+
+	if outputMs {
+		return MakeIntValue(int(ttl))
+	}
+
+	return MakeIntValue(int((ttl + 500) / 1000))
+}
+
+func ttl(c *Client, args []Value) Value {
+	return ttlGeneric(args, false, false)
+}
+
+func pttl(c *Client, args []Value) Value {
+	return ttlGeneric(args, true, false)
+}
+
+func expiretime(c *Client, args []Value) Value {
+	return ttlGeneric(args, false, true)
+}
+
+func pexpiretime(c *Client, args []Value) Value {
+	return ttlGeneric(args, true, true)
+}
+
+func persist(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	if !keyspace.Exists(key) {
+		return MakeIntValue(0)
+	}
+
+	if !keyspace.RemoveExpire(key) {
+		return MakeIntValue(0)
+	}
+	keyspace.dirty++
+
+	return MakeIntValue(1)
+}
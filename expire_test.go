@@ -0,0 +1,193 @@
+package main
+
+import (
+	"testing"
+)
+
+// freezeClock pins nowMs to ms for the duration of the test and returns a
+// function that moves the clock forward.
+func freezeClock(t *testing.T, ms int64) func(int64) {
+	t.Helper()
+
+	orig := nowMs
+	now := ms
+	nowMs = func() int64 { return now }
+	t.Cleanup(func() { nowMs = orig })
+
+	return func(delta int64) { now += delta }
+}
+
+func TestExpire(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Value
+		advance  int64
+		after    Value
+		expected string
+	}{
+		{
+			name:     "ttl of missing key",
+			input:    []Value{makeCommand("TTL", "expire:missing")},
+			expected: ":-2\r\n",
+		},
+		{
+			name:     "ttl without expire",
+			input:    []Value{makeCommand("SET", "expire:none", "v"), makeCommand("TTL", "expire:none")},
+			expected: ":-1\r\n",
+		},
+		{
+			name:     "expire and ttl",
+			input:    []Value{makeCommand("SET", "expire:ttl", "v"), makeCommand("EXPIRE", "expire:ttl", "100"), makeCommand("TTL", "expire:ttl")},
+			expected: ":100\r\n",
+		},
+		{
+			name:     "pexpire and pttl",
+			input:    []Value{makeCommand("SET", "expire:pttl", "v"), makeCommand("PEXPIRE", "expire:pttl", "1500"), makeCommand("PTTL", "expire:pttl")},
+			expected: ":1500\r\n",
+		},
+		{
+			name:     "expire on missing key",
+			input:    []Value{makeCommand("EXPIRE", "expire:nokey", "100")},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "lazy expiration",
+			input:    []Value{makeCommand("SET", "expire:lazy", "v"), makeCommand("PEXPIRE", "expire:lazy", "100")},
+			advance:  100,
+			after:    makeCommand("GET", "expire:lazy"),
+			expected: "$-1\r\n",
+		},
+		{
+			name:     "still alive before the deadline",
+			input:    []Value{makeCommand("SET", "expire:alive", "v"), makeCommand("PEXPIRE", "expire:alive", "100")},
+			advance:  99,
+			after:    makeCommand("GET", "expire:alive"),
+			expected: "$1\r\nv\r\n",
+		},
+		{
+			name:     "expire in the past deletes",
+			input:    []Value{makeCommand("SET", "expire:past", "v"), makeCommand("EXPIRE", "expire:past", "-1"), makeCommand("TYPE", "expire:past")},
+			expected: "+none\r\n",
+		},
+		{
+			name:     "expireat and expiretime",
+			input:    []Value{makeCommand("SET", "expire:at", "v"), makeCommand("EXPIREAT", "expire:at", "2000000000"), makeCommand("EXPIRETIME", "expire:at")},
+			expected: ":2000000000\r\n",
+		},
+		{
+			name:     "pexpiretime",
+			input:    []Value{makeCommand("SET", "expire:pat", "v"), makeCommand("PEXPIREAT", "expire:pat", "2000000000123"), makeCommand("PEXPIRETIME", "expire:pat")},
+			expected: ":2000000000123\r\n",
+		},
+		{
+			name:     "nx with existing ttl",
+			input:    []Value{makeCommand("SET", "expire:nx", "v"), makeCommand("EXPIRE", "expire:nx", "100"), makeCommand("EXPIRE", "expire:nx", "200", "NX")},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "xx without ttl",
+			input:    []Value{makeCommand("SET", "expire:xx", "v"), makeCommand("EXPIRE", "expire:xx", "100", "XX")},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "gt without ttl",
+			input:    []Value{makeCommand("SET", "expire:gt", "v"), makeCommand("EXPIRE", "expire:gt", "100", "GT")},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "gt with lower ttl",
+			input:    []Value{makeCommand("SET", "expire:gt2", "v"), makeCommand("EXPIRE", "expire:gt2", "100"), makeCommand("EXPIRE", "expire:gt2", "200", "GT"), makeCommand("TTL", "expire:gt2")},
+			expected: ":200\r\n",
+		},
+		{
+			name:     "lt without ttl",
+			input:    []Value{makeCommand("SET", "expire:lt", "v"), makeCommand("EXPIRE", "expire:lt", "100", "LT")},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "nx and xx",
+			input:    []Value{makeCommand("SET", "expire:nxxx", "v"), makeCommand("EXPIRE", "expire:nxxx", "100", "NX", "XX")},
+			expected: "-ERR NX and XX, GT or LT options at the same time are not compatible\r\n",
+		},
+		{
+			name:     "gt and lt",
+			input:    []Value{makeCommand("SET", "expire:gtlt", "v"), makeCommand("EXPIRE", "expire:gtlt", "100", "GT", "LT")},
+			expected: "-ERR GT and LT options at the same time are not compatible\r\n",
+		},
+		{
+			name:     "unsupported option",
+			input:    []Value{makeCommand("EXPIRE", "expire:opt", "100", "FOO")},
+			expected: "-ERR Unsupported option FOO\r\n",
+		},
+		{
+			name:     "overflow",
+			input:    []Value{makeCommand("SET", "expire:overflow", "v"), makeCommand("EXPIRE", "expire:overflow", "9223372036854775807")},
+			expected: "-ERR invalid expire time in 'expire' command\r\n",
+		},
+		{
+			name:     "persist",
+			input:    []Value{makeCommand("SET", "expire:persist", "v"), makeCommand("EXPIRE", "expire:persist", "100"), makeCommand("PERSIST", "expire:persist"), makeCommand("TTL", "expire:persist")},
+			expected: ":-1\r\n",
+		},
+		{
+			name:     "set clears ttl",
+			input:    []Value{makeCommand("SET", "expire:reset", "v"), makeCommand("EXPIRE", "expire:reset", "100"), makeCommand("SET", "expire:reset", "w"), makeCommand("TTL", "expire:reset")},
+			expected: ":-1\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			advance := freezeClock(t, 1_000_000)
+
+			result := runCommands(t, tt.input...)
+			if tt.after.typ != "" {
+				advance(tt.advance)
+				result = runCommands(t, tt.after)
+			}
+
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestExpireActiveCycle(t *testing.T) {
+	advance := freezeClock(t, 1_000_000)
+
+	runCommands(t, makeCommand("SET", "expire:active", "v"), makeCommand("PEXPIRE", "expire:active", "10"))
+	advance(10)
+
+	keyspace.mutex.Lock()
+	for _, ok := keyspace.dict.Get("expire:active"); ok; _, ok = keyspace.dict.Get("expire:active") {
+		keyspace.activeExpireSample()
+	}
+	_, ok := keyspace.expires["expire:active"]
+	keyspace.mutex.Unlock()
+
+	if ok {
+		t.Error("expected the expire entry to be reclaimed")
+	}
+}
+
+func TestExpirePropagation(t *testing.T) {
+	freezeClock(t, 1_000_000)
+
+	logged := propagated(t,
+		makeCommand("SET", "expire:aof", "v"),
+		makeCommand("EXPIRE", "expire:aof", "100"),
+		makeCommand("EXPIRE", "expire:aof", "50", "GT"),
+		makeCommand("PEXPIRE", "expire:aof:missing", "100"),
+		makeCommand("SET", "expire:aof:past", "v"),
+		makeCommand("EXPIREAT", "expire:aof:past", "1"),
+	)
+
+	expected := []Value{
+		makeCommand("SET", "expire:aof", "v"),
+		makeCommand("PEXPIREAT", "expire:aof", "1100000"),
+		makeCommand("SET", "expire:aof:past", "v"),
+		makeCommand("PEXPIREAT", "expire:aof:past", "1000"),
+	}
+	assertPropagated(t, logged, expected)
+}
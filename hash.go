@@ -0,0 +1,822 @@
+package main
+
+import (
+	"maps"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+func registerHashCommands(commands map[string]Command) {
+	commands["HSET"] = Command{
+		details: Details{
+			name:              "hset",
+			arity:             -4,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hset,
+	}
+
+	commands["HSETNX"] = Command{
+		details: Details{
+			name:              "hsetnx",
+			arity:             4,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hsetnx,
+	}
+
+	commands["HGET"] = Command{
+		details: Details{
+			name:              "hget",
+			arity:             3,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hget,
+	}
+
+	commands["HMGET"] = Command{
+		details: Details{
+			name:              "hmget",
+			arity:             -3,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hmget,
+	}
+
+	commands["HGETALL"] = Command{
+		details: Details{
+			name:              "hgetall",
+			arity:             2,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@hash", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hgetall,
+	}
+
+	commands["HDEL"] = Command{
+		details: Details{
+			name:              "hdel",
+			arity:             -3,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hdel,
+	}
+
+	commands["HEXISTS"] = Command{
+		details: Details{
+			name:              "hexists",
+			arity:             3,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hexists,
+	}
+
+	commands["HLEN"] = Command{
+		details: Details{
+			name:              "hlen",
+			arity:             2,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hlen,
+	}
+
+	commands["HKEYS"] = Command{
+		details: Details{
+			name:              "hkeys",
+			arity:             2,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@hash", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hkeys,
+	}
+
+	commands["HVALS"] = Command{
+		details: Details{
+			name:              "hvals",
+			arity:             2,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@hash", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hvals,
+	}
+
+	commands["HSTRLEN"] = Command{
+		details: Details{
+			name:              "hstrlen",
+			arity:             3,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hstrlen,
+	}
+
+	commands["HINCRBY"] = Command{
+		details: Details{
+			name:              "hincrby",
+			arity:             4,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hincrby,
+	}
+
+	commands["HINCRBYFLOAT"] = Command{
+		details: Details{
+			name:              "hincrbyfloat",
+			arity:             4,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hincrbyfloat,
+	}
+
+	commands["HRANDFIELD"] = Command{
+		details: Details{
+			name:              "hrandfield",
+			arity:             -2,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@hash", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hrandfield,
+	}
+
+	commands["HSCAN"] = Command{
+		details: Details{
+			name:              "hscan",
+			arity:             -3,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@hash", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hscan,
+	}
+}
+
+// Hash is the value of a hash key. Reading from a nil *Hash behaves like
+// reading from an empty hash, which is what a missing key is.
+type Hash struct {
+	fields *Dict[string]
+
+	// expires holds the TTLs of the fields that have one, as unix time in
+	// milliseconds. nextExpire is a lower bound of all of them, so callers
+	// can skip looking for expired fields until it is reached.
+	expires    map[string]int64
+	nextExpire int64
+}
+
+func NewHash() *Hash {
+	return &Hash{
+		fields:     NewDict[string](),
+		expires:    make(map[string]int64),
+		nextExpire: math.MaxInt64,
+	}
+}
+
+func (h *Hash) Get(field string) (string, bool) {
+	if h == nil {
+		return "", false
+	}
+
+	return h.fields.Get(field)
+}
+
+// Set stores val in field and reports whether the field is new. Like in
+// Redis, overwriting a field discards its TTL.
+func (h *Hash) Set(field, val string) bool {
+	delete(h.expires, field)
+	return h.SetKeepTTL(field, val)
+}
+
+// SetKeepTTL is Set, except that the TTL of the field is kept.
+func (h *Hash) SetKeepTTL(field, val string) bool {
+	return h.fields.Set(field, val)
+}
+
+func (h *Hash) Delete(field string) bool {
+	if !h.fields.Delete(field) {
+		return false
+	}
+
+	delete(h.expires, field)
+	return true
+}
+
+func (h *Hash) Len() int {
+	if h == nil {
+		return 0
+	}
+
+	return h.fields.Len()
+}
+
+// Clone returns a copy of the hash, field TTLs included.
+func (h *Hash) Clone() *Hash {
+	return &Hash{
+		fields:     h.fields.Clone(),
+		expires:    maps.Clone(h.expires),
+		nextExpire: h.nextExpire,
+	}
+}
+
+// RandomField returns a random field, and false if the hash is empty.
+func (h *Hash) RandomField() (string, bool) {
+	if h == nil {
+		return "", false
+	}
+
+	return h.fields.RandomKey()
+}
+
+func (h *Hash) ForEach(fn func(field, val string)) {
+	if h == nil {
+		return
+	}
+
+	h.fields.ForEach(fn)
+}
+
+func (h *Hash) SetFieldExpire(field string, when int64) {
+	h.expires[field] = when
+	h.nextExpire = min(h.nextExpire, when)
+}
+
+// FieldExpire returns the absolute expire time of field in milliseconds,
+// and false if the field doesn't have one.
+func (h *Hash) FieldExpire(field string) (int64, bool) {
+	if h == nil {
+		return 0, false
+	}
+
+	when, ok := h.expires[field]
+	return when, ok
+}
+
+func (h *Hash) PersistField(field string) bool {
+	if _, ok := h.expires[field]; !ok {
+		return false
+	}
+
+	delete(h.expires, field)
+	return true
+}
+
+// deleteExpired deletes the fields whose TTL elapsed by now and recomputes
+// nextExpire.
+func (h *Hash) deleteExpired(now int64) {
+	if h.nextExpire > now {
+		return
+	}
+
+	h.nextExpire = math.MaxInt64
+	for field, when := range h.expires {
+		if when <= now {
+			h.Delete(field)
+			continue
+		}
+		h.nextExpire = min(h.nextExpire, when)
+	}
+}
+
+// reapHashFields deletes the expired fields of the hash stored at key, and
+// the key itself once no field is left. It reports whether the key is gone.
+func reapHashFields(key string, hash *Hash) bool {
+	hash.deleteExpired(nowMs())
+	trackHashExpires(key, hash)
+
+	if hash.Len() == 0 {
+		keyspace.Delete(key)
+		return true
+	}
+
+	return false
+}
+
+// trackHashExpires keeps the keyspace registry of hashes with volatile
+// fields in sync, which is what the active expire cycle samples from.
+func trackHashExpires(key string, hash *Hash) {
+	if len(hash.expires) == 0 {
+		delete(keyspace.hexpires, key)
+		return
+	}
+
+	keyspace.hexpires[key] = hash.nextExpire
+}
+
+// lookupHash returns the hash stored at key, or nil if there is none. The
+// error is set when the key holds another type.
+func lookupHash(key string) (*Hash, *RespError) {
+	obj := keyspace.Lookup(key)
+	if obj == nil {
+		return nil, nil
+	}
+	if obj.typ != TypeHash {
+		return nil, ErrWrongType
+	}
+
+	hash := obj.value.(*Hash)
+	if reapHashFields(key, hash) {
+		return nil, nil
+	}
+
+	return hash, nil
+}
+
+// lookupHashForWrite is lookupHash, except that a missing hash is created.
+func lookupHashForWrite(key string) (*Hash, *RespError) {
+	hash, err := lookupHash(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if hash == nil {
+		hash = NewHash()
+		keyspace.Set(key, &Object{typ: TypeHash, value: hash})
+	}
+
+	return hash, nil
+}
+
+func hset(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	if len(args)%2 != 1 {
+		return ErrWrongArity("hset").Value()
+	}
+
+	hash, err := lookupHashForWrite(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	added := 0
+	for i := 1; i < len(args); i += 2 {
+		if hash.Set(args[i].bulk, args[i+1].bulk) {
+			added++
+		}
+	}
+	keyspace.dirty++
+
+	return MakeIntValue(added)
+}
+
+func hsetnx(c *Client, args []Value) Value {
+	key := args[0].bulk
+	field := args[1].bulk
+
+	hash, err := lookupHash(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	if _, ok := hash.Get(field); ok {
+		return MakeIntValue(0)
+	}
+
+	hash, _ = lookupHashForWrite(key)
+	hash.Set(field, args[2].bulk)
+	keyspace.dirty++
+
+	return MakeIntValue(1)
+}
+
+func hget(c *Client, args []Value) Value {
+	key := args[0].bulk
+	field := args[1].bulk
+
+	hash, err := lookupHash(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	val, ok := hash.Get(field)
+	if !ok {
+		return Value{typ: "null"}
+	}
+
+	return Value{typ: "bulk", bulk: val}
+}
+
+func hmget(c *Client, args []Value) Value {
+	hash, err := lookupHash(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	result := make([]Value, 0, len(args)-1)
+	for _, field := range args[1:] {
+		val, ok := hash.Get(field.bulk)
+		if !ok {
+			result = append(result, MakeNilValue())
+			continue
+		}
+		result = append(result, MakeBulkValue(val))
+	}
+
+	return Value{typ: "array", array: result}
+}
+
+func hgetall(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	hash, err := lookupHash(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	result := make([]Value, 0, hash.Len()*2)
+	hash.ForEach(func(field, val string) {
+		result = append(result, Value{typ: "bulk", bulk: field})
+		result = append(result, Value{typ: "bulk", bulk: val})
+	})
+
+	return MakeMapValue(result...)
+}
+
+func hdel(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	hash, err := lookupHash(key)
+	if err != nil {
+		return err.Value()
+	}
+	if hash == nil {
+		return MakeIntValue(0)
+	}
+
+	deleted := 0
+	for _, field := range args[1:] {
+		if hash.Delete(field.bulk) {
+			deleted++
+		}
+	}
+
+	if deleted > 0 {
+		// A hash never stays around without fields.
+		if hash.Len() == 0 {
+			keyspace.Delete(key)
+		}
+		keyspace.dirty++
+	}
+
+	return MakeIntValue(deleted)
+}
+
+func hexists(c *Client, args []Value) Value {
+	hash, err := lookupHash(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	if _, ok := hash.Get(args[1].bulk); !ok {
+		return MakeIntValue(0)
+	}
+
+	return MakeIntValue(1)
+}
+
+func hlen(c *Client, args []Value) Value {
+	hash, err := lookupHash(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	return MakeIntValue(hash.Len())
+}
+
+func hkeys(c *Client, args []Value) Value {
+	hash, err := lookupHash(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	result := make([]Value, 0, hash.Len())
+	hash.ForEach(func(field, val string) {
+		result = append(result, MakeBulkValue(field))
+	})
+
+	return Value{typ: "array", array: result}
+}
+
+func hvals(c *Client, args []Value) Value {
+	hash, err := lookupHash(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	result := make([]Value, 0, hash.Len())
+	hash.ForEach(func(field, val string) {
+		result = append(result, MakeBulkValue(val))
+	})
+
+	return Value{typ: "array", array: result}
+}
+
+func hstrlen(c *Client, args []Value) Value {
+	hash, err := lookupHash(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	val, _ := hash.Get(args[1].bulk)
+	return MakeIntValue(len(val))
+}
+
+func hincrby(c *Client, args []Value) Value {
+	key := args[0].bulk
+	field := args[1].bulk
+
+	incr, ok := parseInteger(args[2].bulk)
+	if !ok {
+		return ErrNotInteger.Value()
+	}
+
+	hash, err := lookupHash(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	var current int64
+	if val, found := hash.Get(field); found {
+		if current, ok = parseInteger(val); !ok {
+			return NewErr("hash value is not an integer").Value()
+		}
+	}
+
+	if (incr < 0 && current < 0 && incr < math.MinInt64-current) ||
+		(incr > 0 && current > 0 && incr > math.MaxInt64-current) {
+		return NewErr("increment or decrement would overflow").Value()
+	}
+	current += incr
+
+	hash, _ = lookupHashForWrite(key)
+	hash.SetKeepTTL(field, strconv.FormatInt(current, 10))
+	keyspace.dirty++
+
+	return MakeIntValue(int(current))
+}
+
+func hincrbyfloat(c *Client, args []Value) Value {
+	key := args[0].bulk
+	field := args[1].bulk
+
+	incr, ok := parseLongDouble(args[2].bulk)
+	if !ok {
+		return ErrNotFloat.Value()
+	}
+
+	hash, err := lookupHash(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	current := newLongDouble()
+	if val, found := hash.Get(field); found {
+		if current, ok = parseLongDouble(val); !ok {
+			return NewErr("hash value is not a float").Value()
+		}
+	}
+
+	if current.IsInf() || incr.IsInf() {
+		return NewErr("increment would produce NaN or Infinity").Value()
+	}
+	current.Add(current, incr)
+
+	result := formatLongDouble(current)
+	hash, _ = lookupHashForWrite(key)
+	hash.SetKeepTTL(field, result)
+	keyspace.dirty++
+
+	// Same as INCRBYFLOAT: replay sets the result instead of redoing the math.
+	// HSET drops the TTL of the field, so it has to be restored after it.
+	c.rewriteCommand("HSET", key, field, result)
+	if when, ok := hash.FieldExpire(field); ok {
+		c.alsoPropagate("HPEXPIREAT", key, strconv.FormatInt(when, 10), "FIELDS", "1", field)
+	}
+
+	return MakeBulkValue(result)
+}
+
+// randomPickPrealloc caps the memory reserved up front for a negative count
+// of random picks, which the client chooses freely.
+const randomPickPrealloc = 1024
+
+// hrandfieldSubStrategyMul decides how HRANDFIELD picks count distinct
+// fields, like HRANDFIELD_SUB_STRATEGY_MUL in Redis: when count is close to
+// the size of the hash, picking random fields would mostly find ones already
+// picked, so the fields are all copied and shuffled instead.
+const hrandfieldSubStrategyMul = 3
+
+// hrandfield follows Redis: a positive count returns distinct fields, at
+// most as many as the hash has, while a negative count may return the same
+// field several times and always returns exactly -count fields.
+func hrandfield(c *Client, args []Value) Value {
+	if len(args) > 3 || (len(args) == 3 && !strings.EqualFold(args[2].bulk, "WITHVALUES")) {
+		return ErrSyntax.Value()
+	}
+
+	hash, err := lookupHash(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	if len(args) == 1 {
+		field, ok := hash.RandomField()
+		if !ok {
+			return MakeNilValue()
+		}
+		return MakeBulkValue(field)
+	}
+
+	count, ok := parseInteger(args[1].bulk)
+	if !ok {
+		return ErrNotInteger.Value()
+	}
+	if count < -math.MaxInt64/2 || count > math.MaxInt64/2 {
+		return NewErr("value is out of range").Value()
+	}
+	withValues := len(args) == 3
+
+	var picked []string
+	switch size := int64(hash.Len()); {
+	case count == 0 || size == 0:
+	case count < 0:
+		picked = make([]string, 0, min(-count, randomPickPrealloc))
+		for range -count {
+			field, _ := hash.RandomField()
+			picked = append(picked, field)
+		}
+	case count >= size:
+		picked = hashFields(hash)
+	case count*hrandfieldSubStrategyMul > size:
+		picked = hashFields(hash)
+		rand.Shuffle(len(picked), func(i, j int) { picked[i], picked[j] = picked[j], picked[i] })
+		picked = picked[:count]
+	default:
+		seen := make(map[string]bool, count)
+		for int64(len(picked)) < count {
+			if field, _ := hash.RandomField(); !seen[field] {
+				seen[field] = true
+				picked = append(picked, field)
+			}
+		}
+	}
+
+	result := make([]Value, 0, len(picked))
+	for _, field := range picked {
+		if !withValues {
+			result = append(result, MakeBulkValue(field))
+			continue
+		}
+
+		val, _ := hash.Get(field)
+		if c.proto == RESP3 {
+			result = append(result, Value{typ: "array", array: []Value{MakeBulkValue(field), MakeBulkValue(val)}})
+		} else {
+			result = append(result, MakeBulkValue(field), MakeBulkValue(val))
+		}
+	}
+
+	return Value{typ: "array", array: result}
+}
+
+func hashFields(hash *Hash) []string {
+	fields := make([]string, 0, hash.Len())
+	hash.ForEach(func(field, val string) {
+		fields = append(fields, field)
+	})
+
+	return fields
+}
+
+func hscan(c *Client, args []Value) Value {
+	cursor, err := parseScanCursor(args[1].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	opts, err := parseScanOptions(args[2:], "hscan")
+	if err != nil {
+		return err.Value()
+	}
+
+	hash, err := lookupHash(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	elements := []Value{}
+	if hash == nil {
+		return scanReply(0, elements)
+	}
+
+	cursor = scanDict(hash.fields, cursor, opts.count, func(field, val string) {
+		if !opts.match(field) {
+			return
+		}
+
+		elements = append(elements, MakeBulkValue(field))
+		if !opts.noValues {
+			elements = append(elements, MakeBulkValue(val))
+		}
+	})
+
+	return scanReply(cursor, elements)
+}
@@ -0,0 +1,606 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+func registerHashExpireCommands(commands map[string]Command) {
+	commands["HEXPIRE"] = Command{
+		details: Details{
+			name:              "hexpire",
+			arity:             -6,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hexpire,
+	}
+
+	commands["HPEXPIRE"] = Command{
+		details: Details{
+			name:              "hpexpire",
+			arity:             -6,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hpexpire,
+	}
+
+	commands["HEXPIREAT"] = Command{
+		details: Details{
+			name:              "hexpireat",
+			arity:             -6,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hexpireat,
+	}
+
+	commands["HPEXPIREAT"] = Command{
+		details: Details{
+			name:              "hpexpireat",
+			arity:             -6,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hpexpireat,
+	}
+
+	commands["HTTL"] = Command{
+		details: Details{
+			name:              "httl",
+			arity:             -5,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: httl,
+	}
+
+	commands["HPTTL"] = Command{
+		details: Details{
+			name:              "hpttl",
+			arity:             -5,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hpttl,
+	}
+
+	commands["HEXPIRETIME"] = Command{
+		details: Details{
+			name:              "hexpiretime",
+			arity:             -5,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hexpiretime,
+	}
+
+	commands["HPEXPIRETIME"] = Command{
+		details: Details{
+			name:              "hpexpiretime",
+			arity:             -5,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hpexpiretime,
+	}
+
+	commands["HPERSIST"] = Command{
+		details: Details{
+			name:              "hpersist",
+			arity:             -5,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hpersist,
+	}
+
+	commands["HGETEX"] = Command{
+		details: Details{
+			name:              "hgetex",
+			arity:             -5,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hgetex,
+	}
+
+	commands["HSETEX"] = Command{
+		details: Details{
+			name:              "hsetex",
+			arity:             -6,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@hash", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: hsetex,
+	}
+}
+
+// hashFieldMaxExpire is the largest absolute field expire time accepted, in
+// milliseconds, same as Redis.
+const hashFieldMaxExpire = (1<<48 - 1) >> 2
+
+// Per field replies of the hash field expiration commands.
+const (
+	hfeNoField   = -2
+	hfeNoTTL     = -1
+	hfeNotSet    = 0
+	hfeSet       = 1
+	hfeDeleted   = 2
+	hfePersisted = 1
+)
+
+// parseFieldsArgument parses "FIELDS numfields field [field ...]" starting
+// at args[at]. Every field is followed by perField-1 more arguments, which
+// is how HSETEX passes values.
+func parseFieldsArgument(args []Value, at int, perField int) ([]Value, *RespError) {
+	if at >= len(args) || !strings.EqualFold(args[at].bulk, "FIELDS") {
+		return nil, NewErr("Mandatory argument FIELDS is missing or not at the right position")
+	}
+
+	if at+1 >= len(args) {
+		return nil, ErrSyntax
+	}
+
+	numFields, ok := parseInteger(args[at+1].bulk)
+	if !ok || numFields < 1 {
+		return nil, NewErr("Number of fields must be a positive integer")
+	}
+
+	rest := args[at+2:]
+	if numFields > int64(len(rest)) || int(numFields)*perField != len(rest) {
+		return nil, NewErr("The `numfields` parameter must match the number of arguments")
+	}
+
+	return rest, nil
+}
+
+func fieldsToArgv(fields []string) []string {
+	return append([]string{"FIELDS", strconv.Itoa(len(fields))}, fields...)
+}
+
+func integersValue(codes []int) Value {
+	result := make([]Value, len(codes))
+	for i, code := range codes {
+		result[i] = MakeIntValue(code)
+	}
+
+	return Value{typ: "array", array: result}
+}
+
+// parseHashFieldExpire converts the expire argument of the hash field
+// commands into an absolute unix time in milliseconds.
+func parseHashFieldExpire(arg string, name string, basetime int64, unit int64) (int64, *RespError) {
+	when, ok := parseInteger(arg)
+	if !ok {
+		return 0, ErrNotInteger
+	}
+
+	// Unlike the key commands, a time in the past must still be positive,
+	// which also keeps the multiplication by unit from overflowing.
+	if when < 0 {
+		return 0, NewErr("invalid expire time, must be >= 0")
+	}
+	if when > hashFieldMaxExpire/unit {
+		return 0, NewErr("invalid expire time in '%s' command", name)
+	}
+	when *= unit
+	if when > hashFieldMaxExpire-basetime {
+		return 0, NewErr("invalid expire time in '%s' command", name)
+	}
+
+	return when + basetime, nil
+}
+
+// hexpireGeneric implements HEXPIRE, HPEXPIRE, HEXPIREAT and HPEXPIREAT.
+// Every field gets its own status code: -2 missing, 0 condition not met,
+// 1 expire set and 2 deleted because the time is already in the past.
+func hexpireGeneric(c *Client, args []Value, name string, basetime int64, unit int64) Value {
+	key := args[0].bulk
+
+	when, err := parseHashFieldExpire(args[1].bulk, name, basetime, unit)
+	if err != nil {
+		return err.Value()
+	}
+
+	fieldsAt, flags := 2, 0
+	if f, err := parseExpireFlags(args[2:3]); err == nil {
+		fieldsAt, flags = 3, f
+	}
+
+	fields, err := parseFieldsArgument(args, fieldsAt, 1)
+	if err != nil {
+		return err.Value()
+	}
+
+	hash, err := lookupHash(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	now := nowMs()
+	codes := make([]int, len(fields))
+	var changed []string
+	for i, f := range fields {
+		field := f.bulk
+		if _, ok := hash.Get(field); !ok {
+			codes[i] = hfeNoField
+			continue
+		}
+
+		current, hasExpire := hash.FieldExpire(field)
+		switch {
+		case flags&expireNX != 0 && hasExpire,
+			flags&expireXX != 0 && !hasExpire,
+			flags&expireGT != 0 && (!hasExpire || when <= current),
+			flags&expireLT != 0 && hasExpire && when >= current:
+			codes[i] = hfeNotSet
+			continue
+		}
+
+		if when <= now {
+			hash.Delete(field)
+			codes[i] = hfeDeleted
+		} else {
+			hash.SetFieldExpire(field, when)
+			codes[i] = hfeSet
+		}
+		changed = append(changed, field)
+	}
+
+	if len(changed) > 0 {
+		reapHashFields(key, hash)
+		keyspace.dirty++
+
+		// Relative times would be extended by a replay, and the conditions
+		// were already applied, so only the absolute time is propagated.
+		argv := append([]string{"HPEXPIREAT", key, strconv.FormatInt(when, 10)}, fieldsToArgv(changed)...)
+		c.rewriteCommand(argv...)
+	}
+
+	return integersValue(codes)
+}
+
+func hexpire(c *Client, args []Value) Value {
+	return hexpireGeneric(c, args, "hexpire", nowMs(), 1000)
+}
+
+func hpexpire(c *Client, args []Value) Value {
+	return hexpireGeneric(c, args, "hpexpire", nowMs(), 1)
+}
+
+func hexpireat(c *Client, args []Value) Value {
+	return hexpireGeneric(c, args, "hexpireat", 0, 1000)
+}
+
+func hpexpireat(c *Client, args []Value) Value {
+	return hexpireGeneric(c, args, "hpexpireat", 0, 1)
+}
+
+// httlGeneric implements HTTL, HPTTL, HEXPIRETIME and HPEXPIRETIME, replying
+// -2 for a missing field and -1 for a field without a TTL.
+func httlGeneric(args []Value, outputMs bool, outputAbs bool) Value {
+	fields, err := parseFieldsArgument(args, 1, 1)
+	if err != nil {
+		return err.Value()
+	}
+
+	hash, err := lookupHash(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	now := nowMs()
+	codes := make([]int, len(fields))
+	for i, f := range fields {
+		if _, ok := hash.Get(f.bulk); !ok {
+			codes[i] = hfeNoField
+			continue
+		}
+
+		when, ok := hash.FieldExpire(f.bulk)
+		if !ok {
+			codes[i] = hfeNoTTL
+			continue
+		}
+
+		ttl := when
+		if !outputAbs {
+			ttl = when - now
+		}
+		if !outputMs {
+			ttl = (ttl + 999) / 1000
+		}
+		codes[i] = int(ttl)
+	}
+
+	return integersValue(codes)
+}
+
+func httl(c *Client, args []Value) Value {
+	return httlGeneric(args, false, false)
+}
+
+func hpttl(c *Client, args []Value) Value {
+	return httlGeneric(args, true, false)
+}
+
+func hexpiretime(c *Client, args []Value) Value {
+	return httlGeneric(args, false, true)
+}
+
+func hpexpiretime(c *Client, args []Value) Value {
+	return httlGeneric(args, true, true)
+}
+
+func hpersist(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	fields, err := parseFieldsArgument(args, 1, 1)
+	if err != nil {
+		return err.Value()
+	}
+
+	hash, err := lookupHash(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	codes := make([]int, len(fields))
+	persisted := false
+	for i, f := range fields {
+		switch {
+		case hash.Len() == 0:
+			codes[i] = hfeNoField
+		case hash.PersistField(f.bulk):
+			codes[i] = hfePersisted
+			persisted = true
+		default:
+			if _, ok := hash.Get(f.bulk); !ok {
+				codes[i] = hfeNoField
+			} else {
+				codes[i] = hfeNoTTL
+			}
+		}
+	}
+
+	if persisted {
+		trackHashExpires(key, hash)
+		keyspace.dirty++
+	}
+
+	return integersValue(codes)
+}
+
+// parseHashFieldOptions parses the expiration options of HGETEX and HSETEX,
+// up to the FIELDS argument. keepName is PERSIST for HGETEX and KEEPTTL for
+// HSETEX. It returns the flags, the absolute expire time and where FIELDS is.
+func parseHashFieldOptions(args []Value, name string, keepName string, allowCond bool) (int, int64, int, *RespError) {
+	flags, when := 0, int64(0)
+
+	i := 1
+	for ; i < len(args) && !strings.EqualFold(args[i].bulk, "FIELDS"); i++ {
+		opt := strings.ToUpper(args[i].bulk)
+		switch {
+		case allowCond && opt == "FNX" && flags&(setNX|setXX) == 0:
+			flags |= setNX
+		case allowCond && opt == "FXX" && flags&(setNX|setXX) == 0:
+			flags |= setXX
+		case opt == keepName && flags&(setExpire|setKeepTTL|setPersist) == 0:
+			if opt == "PERSIST" {
+				flags |= setPersist
+			} else {
+				flags |= setKeepTTL
+			}
+		case (opt == "EX" || opt == "PX" || opt == "EXAT" || opt == "PXAT") && i+1 < len(args) &&
+			flags&(setExpire|setKeepTTL|setPersist) == 0:
+			unit, basetime := int64(1000), nowMs()
+			if opt[0] == 'P' {
+				unit = 1
+			}
+			if strings.HasSuffix(opt, "AT") {
+				basetime = 0
+			}
+
+			if n, ok := parseInteger(args[i+1].bulk); ok && n <= 0 {
+				return 0, 0, 0, NewErr("invalid expire time in '%s' command", name)
+			}
+
+			var err *RespError
+			if when, err = parseHashFieldExpire(args[i+1].bulk, name, basetime, unit); err != nil {
+				return 0, 0, 0, err
+			}
+			flags |= setExpire
+			i++
+		default:
+			return 0, 0, 0, ErrSyntax
+		}
+	}
+
+	return flags, when, i, nil
+}
+
+// hgetex returns the values of the fields and optionally changes their TTL.
+// An expire time in the past deletes the fields after reading them.
+func hgetex(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	flags, when, fieldsAt, err := parseHashFieldOptions(args, "hgetex", "PERSIST", false)
+	if err != nil {
+		return err.Value()
+	}
+
+	fields, err := parseFieldsArgument(args, fieldsAt, 1)
+	if err != nil {
+		return err.Value()
+	}
+
+	hash, err := lookupHash(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	result := make([]Value, len(fields))
+	var changed []string
+	for i, f := range fields {
+		field := f.bulk
+		val, ok := hash.Get(field)
+		if !ok {
+			result[i] = MakeNilValue()
+			continue
+		}
+		result[i] = MakeBulkValue(val)
+
+		switch {
+		case flags&setExpire != 0 && when <= nowMs():
+			hash.Delete(field)
+			changed = append(changed, field)
+		case flags&setExpire != 0:
+			hash.SetFieldExpire(field, when)
+			changed = append(changed, field)
+		case flags&setPersist != 0 && hash.PersistField(field):
+			changed = append(changed, field)
+		}
+	}
+
+	if len(changed) > 0 {
+		reapHashFields(key, hash)
+		keyspace.dirty++
+
+		if flags&setPersist != 0 {
+			c.rewriteCommand(append([]string{"HPERSIST", key}, fieldsToArgv(changed)...)...)
+		} else {
+			c.rewriteCommand(append([]string{"HPEXPIREAT", key, strconv.FormatInt(when, 10)}, fieldsToArgv(changed)...)...)
+		}
+	}
+
+	return Value{typ: "array", array: result}
+}
+
+// hsetex sets all the fields or none of them, depending on FNX and FXX.
+// Without KEEPTTL the fields lose their previous TTL, like with HSET.
+func hsetex(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	flags, when, fieldsAt, err := parseHashFieldOptions(args, "hsetex", "KEEPTTL", true)
+	if err != nil {
+		return err.Value()
+	}
+
+	pairs, err := parseFieldsArgument(args, fieldsAt, 2)
+	if err != nil {
+		return err.Value()
+	}
+
+	hash, err := lookupHash(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	for i := 0; i < len(pairs); i += 2 {
+		_, exists := hash.Get(pairs[i].bulk)
+		if (flags&setNX != 0 && exists) || (flags&setXX != 0 && !exists) {
+			return MakeIntValue(0)
+		}
+	}
+
+	hash, _ = lookupHashForWrite(key)
+	argv := []string{"HSETEX", key}
+	switch {
+	case flags&setExpire != 0:
+		argv = append(argv, "PXAT", strconv.FormatInt(when, 10))
+	case flags&setKeepTTL != 0:
+		argv = append(argv, "KEEPTTL")
+	}
+	argv = append(argv, "FIELDS", strconv.Itoa(len(pairs)/2))
+
+	for i := 0; i < len(pairs); i += 2 {
+		field, val := pairs[i].bulk, pairs[i+1].bulk
+		argv = append(argv, field, val)
+
+		switch {
+		case flags&setKeepTTL != 0:
+			hash.SetKeepTTL(field, val)
+		case flags&setExpire != 0 && when <= nowMs():
+			hash.Delete(field)
+		case flags&setExpire != 0:
+			hash.Set(field, val)
+			hash.SetFieldExpire(field, when)
+		default:
+			hash.Set(field, val)
+		}
+	}
+
+	reapHashFields(key, hash)
+	keyspace.dirty++
+	c.rewriteCommand(argv...)
+
+	return MakeIntValue(1)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestHashFieldExpire(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Value
+		advance  int64
+		after    Value
+		expected string
+	}{
+		{
+			name:     "hexpire sets and skips missing fields",
+			input:    []Value{makeCommand("HSET", "hfe:set", "a", "1"), makeCommand("HEXPIRE", "hfe:set", "100", "FIELDS", "2", "a", "b")},
+			expected: "*2\r\n:1\r\n:-2\r\n",
+		},
+		{
+			name:     "hexpire on missing key",
+			input:    []Value{makeCommand("HEXPIRE", "hfe:missing", "100", "FIELDS", "2", "a", "b")},
+			expected: "*2\r\n:-2\r\n:-2\r\n",
+		},
+		{
+			name:     "hexpire nx",
+			input:    []Value{makeCommand("HSET", "hfe:nx", "a", "1"), makeCommand("HEXPIRE", "hfe:nx", "100", "FIELDS", "1", "a"), makeCommand("HEXPIRE", "hfe:nx", "200", "NX", "FIELDS", "1", "a")},
+			expected: "*1\r\n:0\r\n",
+		},
+		{
+			name:     "hexpire gt without ttl",
+			input:    []Value{makeCommand("HSET", "hfe:gt", "a", "1"), makeCommand("HEXPIRE", "hfe:gt", "100", "GT", "FIELDS", "1", "a")},
+			expected: "*1\r\n:0\r\n",
+		},
+		{
+			name:     "hexpireat in the past deletes",
+			input:    []Value{makeCommand("HSET", "hfe:past", "a", "1", "b", "2"), makeCommand("HEXPIREAT", "hfe:past", "1", "FIELDS", "1", "a"), makeCommand("HKEYS", "hfe:past")},
+			expected: "*1\r\n$1\r\nb\r\n",
+		},
+		{
+			name:     "hexpire missing fields argument",
+			input:    []Value{makeCommand("HEXPIRE", "hfe:args", "100", "NX", "1", "a")},
+			expected: "-ERR Mandatory argument FIELDS is missing or not at the right position\r\n",
+		},
+		{
+			name:     "hexpire zero fields",
+			input:    []Value{makeCommand("HEXPIRE", "hfe:args", "100", "FIELDS", "0", "a")},
+			expected: "-ERR Number of fields must be a positive integer\r\n",
+		},
+		{
+			name:     "hexpire wrong numfields",
+			input:    []Value{makeCommand("HEXPIRE", "hfe:args", "100", "FIELDS", "2", "a")},
+			expected: "-ERR The `numfields` parameter must match the number of arguments\r\n",
+		},
+		{
+			name:     "hexpire time out of range",
+			input:    []Value{makeCommand("HEXPIRE", "hfe:args", "999999999999999", "FIELDS", "1", "a")},
+			expected: "-ERR invalid expire time in 'hexpire' command\r\n",
+		},
+		{
+			name:     "hexpire negative time",
+			input:    []Value{makeCommand("HSET", "hfe:neg", "a", "1"), makeCommand("HEXPIRE", "hfe:neg", "-1", "FIELDS", "1", "a")},
+			expected: "-ERR invalid expire time, must be >= 0\r\n",
+		},
+		{
+			name:     "hpexpire negative time",
+			input:    []Value{makeCommand("HSET", "hfe:neg", "a", "1"), makeCommand("HPEXPIRE", "hfe:neg", "-1", "FIELDS", "1", "a")},
+			expected: "-ERR invalid expire time, must be >= 0\r\n",
+		},
+		{
+			name:     "hexpireat negative time",
+			input:    []Value{makeCommand("HSET", "hfe:neg", "a", "1"), makeCommand("HEXPIREAT", "hfe:neg", "-1", "FIELDS", "1", "a")},
+			expected: "-ERR invalid expire time, must be >= 0\r\n",
+		},
+		{
+			name:     "hexpire overflowing negative time",
+			input:    []Value{makeCommand("HSET", "hfe:neg", "a", "1"), makeCommand("HEXPIRE", "hfe:neg", "-9223372036854775807", "FIELDS", "1", "a")},
+			expected: "-ERR invalid expire time, must be >= 0\r\n",
+		},
+		{
+			name:     "hexpireat overflowing time",
+			input:    []Value{makeCommand("HSET", "hfe:neg", "a", "1"), makeCommand("HEXPIREAT", "hfe:neg", "9223372036854775807", "FIELDS", "1", "a")},
+			expected: "-ERR invalid expire time in 'hexpireat' command\r\n",
+		},
+		{
+			name:     "hpexpireat overflowing time",
+			input:    []Value{makeCommand("HSET", "hfe:neg", "a", "1"), makeCommand("HPEXPIREAT", "hfe:neg", "9223372036854775807", "FIELDS", "1", "a")},
+			expected: "-ERR invalid expire time in 'hpexpireat' command\r\n",
+		},
+		{
+			name:     "httl",
+			input:    []Value{makeCommand("HSET", "hfe:ttl", "a", "1", "b", "2"), makeCommand("HPEXPIRE", "hfe:ttl", "1500", "FIELDS", "1", "a"), makeCommand("HTTL", "hfe:ttl", "FIELDS", "3", "a", "b", "c")},
+			expected: "*3\r\n:2\r\n:-1\r\n:-2\r\n",
+		},
+		{
+			name:     "hpexpiretime",
+			input:    []Value{makeCommand("HSET", "hfe:time", "a", "1"), makeCommand("HPEXPIRE", "hfe:time", "1500", "FIELDS", "1", "a"), makeCommand("HPEXPIRETIME", "hfe:time", "FIELDS", "1", "a")},
+			expected: "*1\r\n:1001500\r\n",
+		},
+		{
+			name:     "hpersist",
+			input:    []Value{makeCommand("HSET", "hfe:persist", "a", "1", "b", "2"), makeCommand("HEXPIRE", "hfe:persist", "100", "FIELDS", "1", "a"), makeCommand("HPERSIST", "hfe:persist", "FIELDS", "3", "a", "b", "c")},
+			expected: "*3\r\n:1\r\n:-1\r\n:-2\r\n",
+		},
+		{
+			name:     "field expires lazily",
+			input:    []Value{makeCommand("HSET", "hfe:lazy", "a", "1", "b", "2"), makeCommand("HPEXPIRE", "hfe:lazy", "10", "FIELDS", "1", "a")},
+			advance:  10,
+			after:    makeCommand("HGETALL", "hfe:lazy"),
+			expected: "*2\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		},
+		{
+			name:     "last field expiring deletes the key",
+			input:    []Value{makeCommand("HSET", "hfe:last", "a", "1"), makeCommand("HPEXPIRE", "hfe:last", "10", "FIELDS", "1", "a")},
+			advance:  10,
+			after:    makeCommand("HLEN", "hfe:last"),
+			expected: ":0\r\n",
+		},
+		{
+			name:     "hset clears the field ttl",
+			input:    []Value{makeCommand("HSET", "hfe:hset", "a", "1"), makeCommand("HEXPIRE", "hfe:hset", "100", "FIELDS", "1", "a"), makeCommand("HSET", "hfe:hset", "a", "2"), makeCommand("HTTL", "hfe:hset", "FIELDS", "1", "a")},
+			expected: "*1\r\n:-1\r\n",
+		},
+		{
+			name:     "hincrby keeps the field ttl",
+			input:    []Value{makeCommand("HSET", "hfe:incr", "a", "1"), makeCommand("HEXPIRE", "hfe:incr", "100", "FIELDS", "1", "a"), makeCommand("HINCRBY", "hfe:incr", "a", "1"), makeCommand("HTTL", "hfe:incr", "FIELDS", "1", "a")},
+			expected: "*1\r\n:100\r\n",
+		},
+		{
+			name:     "hgetex sets the ttl",
+			input:    []Value{makeCommand("HSET", "hfe:getex", "a", "1"), makeCommand("HGETEX", "hfe:getex", "EX", "100", "FIELDS", "2", "a", "b"), makeCommand("HTTL", "hfe:getex", "FIELDS", "1", "a")},
+			expected: "*1\r\n:100\r\n",
+		},
+		{
+			name:     "hgetex persist",
+			input:    []Value{makeCommand("HSET", "hfe:getex2", "a", "1"), makeCommand("HEXPIRE", "hfe:getex2", "100", "FIELDS", "1", "a"), makeCommand("HGETEX", "hfe:getex2", "PERSIST", "FIELDS", "1", "a")},
+			expected: "*1\r\n$1\r\n1\r\n",
+		},
+		{
+			name:     "hgetex zero expire",
+			input:    []Value{makeCommand("HGETEX", "hfe:getex3", "EX", "0", "FIELDS", "1", "a")},
+			expected: "-ERR invalid expire time in 'hgetex' command\r\n",
+		},
+		{
+			name:     "hsetex with expire",
+			input:    []Value{makeCommand("HSETEX", "hfe:setex", "PX", "2500", "FIELDS", "2", "a", "1", "b", "2"), makeCommand("HTTL", "hfe:setex", "FIELDS", "2", "a", "b")},
+			expected: "*2\r\n:3\r\n:3\r\n",
+		},
+		{
+			name:     "hsetex fnx fails for all fields",
+			input:    []Value{makeCommand("HSET", "hfe:fnx", "a", "1"), makeCommand("HSETEX", "hfe:fnx", "FNX", "FIELDS", "2", "a", "2", "b", "2")},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "hsetex fxx on missing key",
+			input:    []Value{makeCommand("HSETEX", "hfe:fxx", "FXX", "FIELDS", "1", "a", "1"), makeCommand("TYPE", "hfe:fxx")},
+			expected: "+none\r\n",
+		},
+		{
+			name:     "hsetex keepttl",
+			input:    []Value{makeCommand("HSETEX", "hfe:keep", "EX", "100", "FIELDS", "1", "a", "1"), makeCommand("HSETEX", "hfe:keep", "KEEPTTL", "FIELDS", "1", "a", "2"), makeCommand("HTTL", "hfe:keep", "FIELDS", "1", "a")},
+			expected: "*1\r\n:100\r\n",
+		},
+		{
+			name:     "hsetex odd pairs",
+			input:    []Value{makeCommand("HSETEX", "hfe:odd", "FIELDS", "2", "a", "1", "b")},
+			expected: "-ERR The `numfields` parameter must match the number of arguments\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			advance := freezeClock(t, 1_000_000)
+
+			result := runCommands(t, tt.input...)
+			if tt.after.typ != "" {
+				advance(tt.advance)
+				result = runCommands(t, tt.after)
+			}
+
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestHashFieldExpireActiveCycle(t *testing.T) {
+	advance := freezeClock(t, 1_000_000)
+
+	runCommands(t,
+		makeCommand("HSET", "hfe:active", "a", "1", "b", "2"),
+		makeCommand("HPEXPIRE", "hfe:active", "10", "FIELDS", "1", "a"),
+	)
+	advance(10)
+
+	keyspace.mutex.Lock()
+	for keyspace.hexpires["hfe:active"] != 0 {
+		keyspace.activeExpireHashFieldsSample()
+	}
+	obj, _ := keyspace.dict.Get("hfe:active")
+	hash := obj.value.(*Hash)
+	_, ok := hash.Get("a")
+	keyspace.mutex.Unlock()
+
+	if ok {
+		t.Error("expected the expired field to be reclaimed")
+	}
+}
+
+func TestHashFieldExpirePropagation(t *testing.T) {
+	freezeClock(t, 1_000_000)
+
+	logged := propagated(t,
+		makeCommand("HSET", "hfe:aof", "a", "1", "b", "2"),
+		makeCommand("HEXPIRE", "hfe:aof", "100", "FIELDS", "3", "a", "b", "c"),
+		makeCommand("HEXPIRE", "hfe:aof", "50", "GT", "FIELDS", "1", "a"),
+		makeCommand("HGETEX", "hfe:aof", "PERSIST", "FIELDS", "1", "b"),
+		makeCommand("HSETEX", "hfe:aof", "FXX", "EX", "10", "FIELDS", "1", "a", "3"),
+	)
+
+	expected := []Value{
+		makeCommand("HSET", "hfe:aof", "a", "1", "b", "2"),
+		makeCommand("HPEXPIREAT", "hfe:aof", "1100000", "FIELDS", "2", "a", "b"),
+		makeCommand("HPERSIST", "hfe:aof", "FIELDS", "1", "b"),
+		makeCommand("HSETEX", "hfe:aof", "PXAT", "1010000", "FIELDS", "1", "a", "3"),
+	}
+	assertPropagated(t, logged, expected)
+}
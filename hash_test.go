@@ -0,0 +1,216 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestHashCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{name: "hset counts new fields", input: []Value{makeCommand("HSET", "hash:set", "a", "1", "b", "2")}, expected: ":2\r\n"},
+		{
+			name:     "hset updates existing",
+			input:    []Value{makeCommand("HSET", "hash:set2", "a", "1"), makeCommand("HSET", "hash:set2", "a", "2", "b", "3"), makeCommand("HGET", "hash:set2", "a")},
+			expected: "$1\r\n2\r\n",
+		},
+		{name: "hset odd pairs", input: []Value{makeCommand("HSET", "hash:set3", "a", "1", "b")}, expected: "-ERR wrong number of arguments for 'hset' command\r\n"},
+		{name: "hsetnx new", input: []Value{makeCommand("HSETNX", "hash:setnx", "a", "1")}, expected: ":1\r\n"},
+		{
+			name:     "hsetnx existing",
+			input:    []Value{makeCommand("HSET", "hash:setnx2", "a", "1"), makeCommand("HSETNX", "hash:setnx2", "a", "2"), makeCommand("HGET", "hash:setnx2", "a")},
+			expected: "$1\r\n1\r\n",
+		},
+		{
+			name:     "hmget",
+			input:    []Value{makeCommand("HSET", "hash:mget", "a", "1", "b", "2"), makeCommand("HMGET", "hash:mget", "a", "c", "b")},
+			expected: "*3\r\n$1\r\n1\r\n$-1\r\n$1\r\n2\r\n",
+		},
+		{
+			name:     "hmget on string",
+			input:    []Value{makeCommand("SET", "hash:mget2", "v"), makeCommand("HMGET", "hash:mget2", "a")},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+		{name: "hgetall missing key", input: []Value{makeCommand("HGETALL", "hash:missing")}, expected: "*0\r\n"},
+		{
+			name:     "hdel",
+			input:    []Value{makeCommand("HSET", "hash:del", "a", "1", "b", "2", "c", "3"), makeCommand("HDEL", "hash:del", "a", "b", "x")},
+			expected: ":2\r\n",
+		},
+		{
+			name:     "hdel last field deletes key",
+			input:    []Value{makeCommand("HSET", "hash:del2", "a", "1"), makeCommand("HDEL", "hash:del2", "a"), makeCommand("TYPE", "hash:del2")},
+			expected: "+none\r\n",
+		},
+		{
+			name:     "hexists",
+			input:    []Value{makeCommand("HSET", "hash:exists", "a", "1"), makeCommand("HEXISTS", "hash:exists", "a")},
+			expected: ":1\r\n",
+		},
+		{name: "hexists missing", input: []Value{makeCommand("HEXISTS", "hash:exists2", "a")}, expected: ":0\r\n"},
+		{
+			name:     "hlen",
+			input:    []Value{makeCommand("HSET", "hash:len", "a", "1", "b", "2"), makeCommand("HLEN", "hash:len")},
+			expected: ":2\r\n",
+		},
+		{
+			name:     "hkeys",
+			input:    []Value{makeCommand("HSET", "hash:keys", "a", "1"), makeCommand("HKEYS", "hash:keys")},
+			expected: "*1\r\n$1\r\na\r\n",
+		},
+		{
+			name:     "hvals",
+			input:    []Value{makeCommand("HSET", "hash:vals", "a", "1"), makeCommand("HVALS", "hash:vals")},
+			expected: "*1\r\n$1\r\n1\r\n",
+		},
+		{
+			name:     "hstrlen",
+			input:    []Value{makeCommand("HSET", "hash:strlen", "a", "hello"), makeCommand("HSTRLEN", "hash:strlen", "a")},
+			expected: ":5\r\n",
+		},
+		{name: "hincrby creates", input: []Value{makeCommand("HINCRBY", "hash:incr", "a", "5")}, expected: ":5\r\n"},
+		{
+			name:     "hincrby not integer",
+			input:    []Value{makeCommand("HSET", "hash:incr2", "a", "x"), makeCommand("HINCRBY", "hash:incr2", "a", "1")},
+			expected: "-ERR hash value is not an integer\r\n",
+		},
+		{
+			name:     "hincrby overflow",
+			input:    []Value{makeCommand("HSET", "hash:incr3", "a", "9223372036854775807"), makeCommand("HINCRBY", "hash:incr3", "a", "1")},
+			expected: "-ERR increment or decrement would overflow\r\n",
+		},
+		{
+			name:     "hincrbyfloat",
+			input:    []Value{makeCommand("HSET", "hash:float", "a", "10.50"), makeCommand("HINCRBYFLOAT", "hash:float", "a", "0.1")},
+			expected: "$4\r\n10.6\r\n",
+		},
+		{
+			name:     "hincrbyfloat not float",
+			input:    []Value{makeCommand("HSET", "hash:float2", "a", "x"), makeCommand("HINCRBYFLOAT", "hash:float2", "a", "1")},
+			expected: "-ERR hash value is not a float\r\n",
+		},
+		{name: "hrandfield missing", input: []Value{makeCommand("HRANDFIELD", "hash:rand")}, expected: "$-1\r\n"},
+		{
+			name:     "hrandfield single",
+			input:    []Value{makeCommand("HSET", "hash:rand2", "a", "1"), makeCommand("HRANDFIELD", "hash:rand2")},
+			expected: "$1\r\na\r\n",
+		},
+		{
+			name:     "hrandfield count larger than hash",
+			input:    []Value{makeCommand("HSET", "hash:rand3", "a", "1"), makeCommand("HRANDFIELD", "hash:rand3", "5", "WITHVALUES")},
+			expected: "*2\r\n$1\r\na\r\n$1\r\n1\r\n",
+		},
+		{
+			name:     "hrandfield negative count repeats",
+			input:    []Value{makeCommand("HSET", "hash:rand4", "a", "1"), makeCommand("HRANDFIELD", "hash:rand4", "-3")},
+			expected: "*3\r\n$1\r\na\r\n$1\r\na\r\n$1\r\na\r\n",
+		},
+		{
+			name:     "hrandfield withvalues in resp3",
+			input:    []Value{makeCommand("HELLO", "3"), makeCommand("HSET", "hash:rand5", "a", "1"), makeCommand("HRANDFIELD", "hash:rand5", "-1", "WITHVALUES")},
+			expected: "*1\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n",
+		},
+		{name: "hrandfield zero", input: []Value{makeCommand("HSET", "hash:rand6", "a", "1"), makeCommand("HRANDFIELD", "hash:rand6", "0")}, expected: "*0\r\n"},
+		{
+			name:     "hrandfield count out of range",
+			input:    []Value{makeCommand("HSET", "hash:rand7", "a", "1"), makeCommand("HRANDFIELD", "hash:rand7", "-9223372036854775807")},
+			expected: "-ERR value is out of range\r\n",
+		},
+		{
+			name:     "hrandfield smallest count",
+			input:    []Value{makeCommand("HSET", "hash:rand8", "a", "1"), makeCommand("HRANDFIELD", "hash:rand8", "-9223372036854775808")},
+			expected: "-ERR value is out of range\r\n",
+		},
+		{
+			name:     "hrandfield count out of range with values",
+			input:    []Value{makeCommand("HSET", "hash:rand9", "a", "1"), makeCommand("HRANDFIELD", "hash:rand9", "-9223372036854775807", "WITHVALUES")},
+			expected: "-ERR value is out of range\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCommands(t, tt.input...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestHashRandfieldDistinct(t *testing.T) {
+	input := makeCommand("HSET", "hash:distinct")
+	for i := 0; i < 100; i++ {
+		input.array = append(input.array, makeCommand("f"+strconv.Itoa(i), "v").array...)
+	}
+	runCommands(t, input)
+
+	// The counts go through every way of picking distinct fields: picking
+	// random ones, shuffling a copy of them and returning them all.
+	cmdHandler := NewCommandHandler()
+	for _, count := range []int{5, 60, 100, 150} {
+		for i := 0; i < 20; i++ {
+			val, err := cmdHandler.Handle("HRANDFIELD", makeCommand("hash:distinct", strconv.Itoa(count)).array)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			seen := map[string]bool{}
+			for _, field := range val.array {
+				if seen[field.bulk] {
+					t.Fatalf("field %q returned twice in %v", field.bulk, val.array)
+				}
+				seen[field.bulk] = true
+			}
+			if len(seen) != min(count, 100) {
+				t.Fatalf("expected %d fields, got %d", min(count, 100), len(seen))
+			}
+		}
+	}
+}
+
+func TestHashScan(t *testing.T) {
+	input := makeCommand("HSET", "hash:scan")
+	for i := 0; i < 50; i++ {
+		input.array = append(input.array, makeCommand("f"+strconv.Itoa(i), "v"+strconv.Itoa(i)).array...)
+	}
+	runCommands(t, input)
+
+	elements := scanAll(t, []string{"HSCAN", "hash:scan"}, "COUNT", "5")
+	fields := make(map[string]string)
+	for i := 0; i < len(elements); i += 2 {
+		fields[elements[i]] = elements[i+1]
+	}
+	if len(fields) != 50 || fields["f7"] != "v7" {
+		t.Errorf("expected the 50 fields with their values, got %v", fields)
+	}
+
+	if fields := scanAll(t, []string{"HSCAN", "hash:scan"}, "MATCH", "f4?", "NOVALUES"); len(fields) != 10 {
+		t.Errorf("expected the 10 fields matching, without values, got %v", fields)
+	}
+
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{name: "missing key", input: []Value{makeCommand("HSCAN", "hash:scan:missing", "0")}, expected: "*2\r\n$1\r\n0\r\n*0\r\n"},
+		{name: "type option", input: []Value{makeCommand("HSCAN", "hash:scan", "0", "TYPE", "hash")}, expected: "-ERR syntax error\r\n"},
+		{
+			name:     "wrong type",
+			input:    []Value{makeCommand("SET", "hash:scan:str", "v"), makeCommand("HSCAN", "hash:scan:str", "0")},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := runCommands(t, tt.input...); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
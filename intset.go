@@ -0,0 +1,55 @@
+package main
+
+import (
+	"slices"
+)
+
+// Intset is the compact encoding of small sets made only of integers. Like
+// the Redis intset it keeps the integers sorted in a single slice, found
+// with a binary search, instead of paying for a hash table entry each.
+type Intset struct {
+	entries []int64
+}
+
+func NewIntset() *Intset {
+	return &Intset{}
+}
+
+// Add inserts v and reports whether it wasn't there already.
+func (is *Intset) Add(v int64) bool {
+	i, found := slices.BinarySearch(is.entries, v)
+	if found {
+		return false
+	}
+
+	is.entries = slices.Insert(is.entries, i, v)
+	return true
+}
+
+func (is *Intset) Remove(v int64) bool {
+	i, found := slices.BinarySearch(is.entries, v)
+	if !found {
+		return false
+	}
+
+	is.entries = slices.Delete(is.entries, i, i+1)
+	return true
+}
+
+func (is *Intset) Contains(v int64) bool {
+	_, found := slices.BinarySearch(is.entries, v)
+	return found
+}
+
+func (is *Intset) Len() int {
+	return len(is.entries)
+}
+
+func (is *Intset) Clone() *Intset {
+	return &Intset{entries: slices.Clone(is.entries)}
+}
+
+// Get returns the i-th smallest integer of the set.
+func (is *Intset) Get(i int) int64 {
+	return is.entries[i]
+}
@@ -0,0 +1,725 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TypeString = "string"
+	TypeHash   = "hash"
+	TypeList   = "list"
+	TypeSet    = "set"
+	TypeZSet   = "zset"
+	TypeStream = "stream"
+)
+
+// Object is a value stored in the keyspace, tagged with its data type so
+// commands can refuse to operate on a key holding the wrong kind of value.
+type Object struct {
+	typ   string
+	value any
+}
+
+// Keyspace maps every key to a single typed object. Commands are executed
+// with the mutex held, which makes each of them atomic the same way Redis'
+// single threaded event loop does.
+type Keyspace struct {
+	mutex   sync.Mutex
+	dict    *Dict[*Object]
+	expires map[string]int64 // unix time in milliseconds
+
+	// hexpires maps hashes with volatile fields to the earliest time one of
+	// their fields expires.
+	hexpires map[string]int64
+
+	// blocking maps keys to the clients blocked on them, in the order they
+	// blocked. readyKeys holds the keys that may now serve some of them.
+	blocking  map[string][]*blockedClient
+	readyKeys []string
+
+	// dirty counts the modifications done to the dataset. Handlers bump it
+	// whenever they change something, which is how the command gets
+	// propagated to the AOF.
+	dirty int
+}
+
+func NewKeyspace() *Keyspace {
+	return &Keyspace{
+		dict:     NewDict[*Object](),
+		expires:  make(map[string]int64),
+		hexpires: make(map[string]int64),
+		blocking: make(map[string][]*blockedClient),
+	}
+}
+
+var keyspace = NewKeyspace()
+
+// nowMs is the clock used for key expiration, replaceable in tests.
+var nowMs = func() int64 {
+	return time.Now().UnixMilli()
+}
+
+// Lookup returns the object stored at key. Keys whose TTL already elapsed
+// are deleted on access, so they are never returned.
+func (ks *Keyspace) Lookup(key string) *Object {
+	ks.expireIfNeeded(key)
+	obj, _ := ks.dict.Get(key)
+	return obj
+}
+
+// Set stores obj at key, discarding any TTL the previous value had.
+func (ks *Keyspace) Set(key string, obj *Object) {
+	ks.dict.Set(key, obj)
+	delete(ks.expires, key)
+	delete(ks.hexpires, key)
+	ks.signalKeyAsReady(key)
+}
+
+// SetKeepTTL stores obj at key, keeping the TTL of the previous value.
+func (ks *Keyspace) SetKeepTTL(key string, obj *Object) {
+	ks.dict.Set(key, obj)
+}
+
+func (ks *Keyspace) Delete(key string) bool {
+	if !ks.dict.Delete(key) {
+		return false
+	}
+
+	delete(ks.expires, key)
+	delete(ks.hexpires, key)
+	return true
+}
+
+// Unlink deletes key like Delete, except that its value is freed in the
+// background when it is big.
+func (ks *Keyspace) Unlink(key string) bool {
+	obj, ok := ks.dict.Get(key)
+	if !ok {
+		return false
+	}
+
+	ks.Delete(key)
+	freeObjectAsync(obj)
+	return true
+}
+
+// Rename moves the value at src, along with its TTL, to dst, overwriting
+// whatever dst held.
+func (ks *Keyspace) Rename(src, dst string) {
+	obj, _ := ks.dict.Get(src)
+	when, volatile := ks.expires[src]
+
+	ks.Delete(src)
+	ks.Set(dst, obj)
+	if volatile {
+		ks.SetExpire(dst, when)
+	}
+	if obj.typ == TypeHash {
+		trackHashExpires(dst, obj.value.(*Hash))
+	}
+}
+
+// RandomKey returns a random key that isn't expired, and false if the
+// keyspace is empty.
+func (ks *Keyspace) RandomKey() (string, bool) {
+	for {
+		key, ok := ks.dict.RandomKey()
+		if !ok || !ks.expireIfNeeded(key) {
+			return key, ok
+		}
+	}
+}
+
+func (ks *Keyspace) Exists(key string) bool {
+	return ks.Lookup(key) != nil
+}
+
+func (ks *Keyspace) SetExpire(key string, when int64) {
+	ks.expires[key] = when
+}
+
+// GetExpire returns the absolute expire time of key in milliseconds, and
+// false if the key doesn't have one.
+func (ks *Keyspace) GetExpire(key string) (int64, bool) {
+	when, ok := ks.expires[key]
+	return when, ok
+}
+
+func (ks *Keyspace) RemoveExpire(key string) bool {
+	if _, ok := ks.expires[key]; !ok {
+		return false
+	}
+
+	delete(ks.expires, key)
+	return true
+}
+
+func (ks *Keyspace) expireIfNeeded(key string) bool {
+	when, ok := ks.expires[key]
+	if !ok || when > nowMs() {
+		return false
+	}
+
+	ks.Delete(key)
+	return true
+}
+
+const (
+	activeExpireCycleInterval   = 100 * time.Millisecond
+	activeExpireCycleSampleSize = 20
+	activeExpireCycleTimeLimit  = 25 * time.Millisecond
+)
+
+// ActiveExpireCycle reclaims keys that expired but are never accessed again.
+// Like Redis, every cycle samples a few keys with a TTL and repeats as long
+// as more than a quarter of the sample turned out to be expired, but never
+// longer than a fraction of the cycle interval.
+func (ks *Keyspace) ActiveExpireCycle() {
+	for {
+		time.Sleep(activeExpireCycleInterval)
+
+		start := time.Now()
+		for time.Since(start) < activeExpireCycleTimeLimit {
+			ks.mutex.Lock()
+			sampled, expired := ks.activeExpireSample()
+			hashesSampled, hashesExpired := ks.activeExpireHashFieldsSample()
+			ks.mutex.Unlock()
+
+			sampled += hashesSampled
+			expired += hashesExpired
+
+			if sampled == 0 || expired*4 <= sampled {
+				break
+			}
+		}
+	}
+}
+
+// activeExpireSample relies on map iteration starting at a random position
+// to pick the keys it checks.
+func (ks *Keyspace) activeExpireSample() (sampled, expired int) {
+	now := nowMs()
+	for key, when := range ks.expires {
+		if sampled == activeExpireCycleSampleSize {
+			break
+		}
+		sampled++
+
+		if when <= now {
+			ks.Delete(key)
+			expired++
+		}
+	}
+
+	return sampled, expired
+}
+
+func (ks *Keyspace) Len() int {
+	return ks.dict.Len()
+}
+
+func registerKeyspaceCommands(commands map[string]Command) {
+	commands["TYPE"] = Command{
+		details: Details{
+			name:              "type",
+			arity:             2,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@keyspace", "@read", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: typeCommand,
+	}
+
+	commands["DEL"] = Command{
+		details: Details{
+			name:              "del",
+			arity:             -2,
+			flags:             []string{"write"},
+			firstKey:          1,
+			lastKey:           -1,
+			step:              1,
+			aclCategories:     []string{"@keyspace", "@write", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: del,
+	}
+
+	commands["UNLINK"] = Command{
+		details: Details{
+			name:              "unlink",
+			arity:             -2,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           -1,
+			step:              1,
+			aclCategories:     []string{"@keyspace", "@write", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: unlink,
+	}
+
+	commands["EXISTS"] = Command{
+		details: Details{
+			name:              "exists",
+			arity:             -2,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           -1,
+			step:              1,
+			aclCategories:     []string{"@keyspace", "@read", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: exists,
+	}
+
+	commands["RENAME"] = Command{
+		details: Details{
+			name:              "rename",
+			arity:             3,
+			flags:             []string{"write"},
+			firstKey:          1,
+			lastKey:           2,
+			step:              1,
+			aclCategories:     []string{"@keyspace", "@write", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: rename,
+	}
+
+	commands["RENAMENX"] = Command{
+		details: Details{
+			name:              "renamenx",
+			arity:             3,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           2,
+			step:              1,
+			aclCategories:     []string{"@keyspace", "@write", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: renamenx,
+	}
+
+	commands["COPY"] = Command{
+		details: Details{
+			name:              "copy",
+			arity:             -3,
+			flags:             []string{"write", "denyoom"},
+			firstKey:          1,
+			lastKey:           2,
+			step:              1,
+			aclCategories:     []string{"@keyspace", "@write", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: copyCommand,
+	}
+
+	commands["TOUCH"] = Command{
+		details: Details{
+			name:              "touch",
+			arity:             -2,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           -1,
+			step:              1,
+			aclCategories:     []string{"@keyspace", "@read", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: touch,
+	}
+
+	commands["RANDOMKEY"] = Command{
+		details: Details{
+			name:              "randomkey",
+			arity:             1,
+			flags:             []string{"readonly"},
+			firstKey:          0,
+			lastKey:           0,
+			step:              0,
+			aclCategories:     []string{"@keyspace", "@read", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: randomkey,
+	}
+
+	commands["DBSIZE"] = Command{
+		details: Details{
+			name:              "dbsize",
+			arity:             1,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          0,
+			lastKey:           0,
+			step:              0,
+			aclCategories:     []string{"@keyspace", "@read", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: dbsize,
+	}
+
+	commands["SCAN"] = Command{
+		details: Details{
+			name:              "scan",
+			arity:             -2,
+			flags:             []string{"readonly"},
+			firstKey:          0,
+			lastKey:           0,
+			step:              0,
+			aclCategories:     []string{"@keyspace", "@read", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: scan,
+	}
+}
+
+func typeCommand(c *Client, args []Value) Value {
+	obj := keyspace.Lookup(args[0].bulk)
+	if obj == nil {
+		return Value{typ: "string", str: "none"}
+	}
+
+	return Value{typ: "string", str: obj.typ}
+}
+
+// dupObject returns a deep copy of obj, sharing nothing that can be
+// modified with it.
+func dupObject(obj *Object) *Object {
+	switch v := obj.value.(type) {
+	case *Hash:
+		return &Object{typ: obj.typ, value: v.Clone()}
+	case *Set:
+		return &Object{typ: obj.typ, value: v.Clone()}
+	case *Quicklist:
+		return &Object{typ: obj.typ, value: v.Clone()}
+	case *ZSet:
+		return &Object{typ: obj.typ, value: v.Clone()}
+	case *Stream:
+		return &Object{typ: obj.typ, value: v.Clone()}
+	default:
+		// Strings are immutable, so they can be shared.
+		return &Object{typ: obj.typ, value: obj.value}
+	}
+}
+
+func del(c *Client, args []Value) Value {
+	return delGeneric(args, keyspace.Delete)
+}
+
+// unlink is DEL, except that big values are freed in the background.
+func unlink(c *Client, args []Value) Value {
+	return delGeneric(args, keyspace.Unlink)
+}
+
+func delGeneric(args []Value, remove func(key string) bool) Value {
+	deleted := 0
+	for _, arg := range args {
+		if keyspace.Lookup(arg.bulk) != nil && remove(arg.bulk) {
+			deleted++
+		}
+	}
+	keyspace.dirty += deleted
+
+	return MakeIntValue(deleted)
+}
+
+// exists counts the keys that exist, so a key given twice counts twice.
+func exists(c *Client, args []Value) Value {
+	count := 0
+	for _, arg := range args {
+		if keyspace.Exists(arg.bulk) {
+			count++
+		}
+	}
+
+	return MakeIntValue(count)
+}
+
+func rename(c *Client, args []Value) Value {
+	return renameGeneric(args, false)
+}
+
+func renamenx(c *Client, args []Value) Value {
+	return renameGeneric(args, true)
+}
+
+func renameGeneric(args []Value, nx bool) Value {
+	src, dst := args[0].bulk, args[1].bulk
+
+	if keyspace.Lookup(src) == nil {
+		return NewErr("no such key").Value()
+	}
+
+	if src == dst {
+		if nx {
+			return MakeIntValue(0)
+		}
+		return Value{typ: "string", str: "OK"}
+	}
+
+	if nx && keyspace.Exists(dst) {
+		return MakeIntValue(0)
+	}
+
+	keyspace.Rename(src, dst)
+	keyspace.dirty++
+
+	if nx {
+		return MakeIntValue(1)
+	}
+	return Value{typ: "string", str: "OK"}
+}
+
+// copyCommand copies the value at source, along with its TTL, to
+// destination. There is a single database, so DB only accepts 0.
+func copyCommand(c *Client, args []Value) Value {
+	src, dst := args[0].bulk, args[1].bulk
+
+	replace := false
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i].bulk); {
+		case opt == "REPLACE":
+			replace = true
+		case opt == "DB" && i+1 < len(args):
+			i++
+			db, ok := parseInteger(args[i].bulk)
+			if !ok {
+				return ErrNotInteger.Value()
+			}
+			if db != 0 {
+				return NewErr("DB index is out of range").Value()
+			}
+		default:
+			return ErrSyntax.Value()
+		}
+	}
+
+	if src == dst {
+		return NewErr("source and destination objects are the same").Value()
+	}
+
+	obj := keyspace.Lookup(src)
+	if obj == nil {
+		return MakeIntValue(0)
+	}
+
+	if keyspace.Exists(dst) && !replace {
+		return MakeIntValue(0)
+	}
+
+	copied := dupObject(obj)
+	keyspace.Set(dst, copied)
+	if when, ok := keyspace.GetExpire(src); ok {
+		keyspace.SetExpire(dst, when)
+	}
+	if copied.typ == TypeHash {
+		trackHashExpires(dst, copied.value.(*Hash))
+	}
+	keyspace.dirty++
+
+	return MakeIntValue(1)
+}
+
+// touch counts the keys that exist. There is no eviction, so there is no
+// access time to update.
+func touch(c *Client, args []Value) Value {
+	return exists(c, args)
+}
+
+func randomkey(c *Client, args []Value) Value {
+	key, ok := keyspace.RandomKey()
+	if !ok {
+		return MakeNilValue()
+	}
+
+	return MakeBulkValue(key)
+}
+
+func dbsize(c *Client, args []Value) Value {
+	return MakeIntValue(keyspace.Len())
+}
+
+// activeExpireHashFieldsSample does for hash fields what activeExpireSample
+// does for keys, sampling hashes whose earliest field TTL already elapsed.
+func (ks *Keyspace) activeExpireHashFieldsSample() (sampled, expired int) {
+	now := nowMs()
+	for key, when := range ks.hexpires {
+		if sampled == activeExpireCycleSampleSize {
+			break
+		}
+		sampled++
+
+		if when > now {
+			continue
+		}
+		expired++
+
+		obj := ks.Lookup(key)
+		if obj == nil || obj.typ != TypeHash {
+			delete(ks.hexpires, key)
+			continue
+		}
+		reapHashFields(key, obj.value.(*Hash))
+	}
+
+	return sampled, expired
+}
+
+// scanOptions are the options of SCAN and its HSCAN, SSCAN and ZSCAN
+// variants.
+type scanOptions struct {
+	count int
+
+	// pattern is empty when every element matches.
+	pattern string
+
+	// typ is the type of the keys SCAN returns, any when empty.
+	typ string
+
+	// noValues makes HSCAN return the fields only.
+	noValues bool
+}
+
+func parseScanCursor(arg string) (uint64, *RespError) {
+	cursor, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		return 0, NewErr("invalid cursor")
+	}
+
+	return cursor, nil
+}
+
+// parseScanOptions parses the options following the cursor of command.
+// TYPE is only accepted by SCAN, and NOVALUES by HSCAN.
+func parseScanOptions(args []Value, command string) (scanOptions, *RespError) {
+	opts := scanOptions{count: 10}
+
+	for i := 0; i < len(args); i++ {
+		moreArgs := len(args) - 1 - i
+		switch opt := strings.ToUpper(args[i].bulk); {
+		case opt == "COUNT" && moreArgs > 0:
+			i++
+			n, ok := parseInteger(args[i].bulk)
+			if !ok {
+				return opts, ErrNotInteger
+			}
+			if n < 1 {
+				return opts, ErrSyntax
+			}
+			opts.count = int(min(n, math.MaxInt32))
+		case opt == "MATCH" && moreArgs > 0:
+			i++
+			opts.pattern = args[i].bulk
+			if opts.pattern == "*" {
+				opts.pattern = ""
+			}
+		case opt == "TYPE" && moreArgs > 0 && command == "scan":
+			i++
+			opts.typ = strings.ToLower(args[i].bulk)
+			if !slices.Contains([]string{TypeString, TypeList, TypeSet, TypeZSet, TypeHash, TypeStream}, opts.typ) {
+				return opts, NewErr("unknown type name '%s'", args[i].bulk)
+			}
+		case opt == "NOVALUES" && command == "hscan":
+			opts.noValues = true
+		default:
+			return opts, ErrSyntax
+		}
+	}
+
+	return opts, nil
+}
+
+// scanDict scans d from cursor until about count entries were returned, or
+// ten times count buckets were visited, and returns the cursor to continue
+// from.
+func scanDict[V any](d *Dict[V], cursor uint64, count int, fn func(key string, val V)) uint64 {
+	maxIterations := count * 10
+
+	returned := 0
+	for {
+		cursor = d.Scan(cursor, func(key string, val V) {
+			fn(key, val)
+			returned++
+		})
+
+		maxIterations--
+		if cursor == 0 || maxIterations == 0 || returned >= count {
+			return cursor
+		}
+	}
+}
+
+func (opts *scanOptions) match(element string) bool {
+	return opts.pattern == "" || stringMatch(opts.pattern, element)
+}
+
+func scanReply(cursor uint64, elements []Value) Value {
+	return Value{typ: "array", array: []Value{
+		MakeBulkValue(strconv.FormatUint(cursor, 10)),
+		{typ: "array", array: elements},
+	}}
+}
+
+// scan iterates the keyspace with a cursor the client passes back on every
+// call, 0 to start and returned once done. Every key that exists for the
+// whole iteration is returned at least once, however the keyspace changes
+// in between.
+func scan(c *Client, args []Value) Value {
+	cursor, err := parseScanCursor(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	opts, err := parseScanOptions(args[1:], "scan")
+	if err != nil {
+		return err.Value()
+	}
+
+	var keys []string
+	cursor = scanDict(keyspace.dict, cursor, opts.count, func(key string, obj *Object) {
+		if opts.match(key) {
+			keys = append(keys, key)
+		}
+	})
+
+	// Expired keys can only be deleted once the scan is done, as the dict
+	// must not change while scanned.
+	elements := []Value{}
+	for _, key := range keys {
+		obj := keyspace.Lookup(key)
+		if obj == nil || (opts.typ != "" && obj.typ != opts.typ) {
+			continue
+		}
+		elements = append(elements, MakeBulkValue(key))
+	}
+
+	return scanReply(cursor, elements)
+}
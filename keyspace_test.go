@@ -0,0 +1,474 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// runCommands executes inputs in order on a single connection and returns
+// the serialized reply of the last one.
+func runCommands(t *testing.T, inputs ...Value) string {
+	t.Helper()
+
+	cmdHandler := NewCommandHandler()
+
+	var val Value
+	for _, input := range inputs {
+		var err error
+		val, err = cmdHandler.Handle(input.array[0].bulk, input.array[1:])
+		if err != nil {
+			if respErr, ok := err.(*RespError); ok {
+				val = respErr.Value()
+				continue
+			}
+			t.Fatal(err)
+		}
+	}
+
+	return string(val.SerializeProto(cmdHandler.client.proto))
+}
+
+func TestKeyspaceWrongType(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{
+			name:     "hset on a string",
+			input:    []Value{makeCommand("SET", "wrongtype:str", "v"), makeCommand("HSET", "wrongtype:str", "f", "v")},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+		{
+			name:     "get on a hash",
+			input:    []Value{makeCommand("HSET", "wrongtype:hash", "f", "v"), makeCommand("GET", "wrongtype:hash")},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+		{
+			name:     "hgetall on a string",
+			input:    []Value{makeCommand("SET", "wrongtype:str2", "v"), makeCommand("HGETALL", "wrongtype:str2")},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+		{
+			name:     "set overwrites a hash",
+			input:    []Value{makeCommand("HSET", "wrongtype:hash2", "f", "v"), makeCommand("SET", "wrongtype:hash2", "v"), makeCommand("GET", "wrongtype:hash2")},
+			expected: "$1\r\nv\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCommands(t, tt.input...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestKeyspaceType(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{name: "missing key", input: []Value{makeCommand("TYPE", "type:missing")}, expected: "+none\r\n"},
+		{name: "string", input: []Value{makeCommand("SET", "type:str", "v"), makeCommand("TYPE", "type:str")}, expected: "+string\r\n"},
+		{name: "hash", input: []Value{makeCommand("HSET", "type:hash", "f", "v"), makeCommand("TYPE", "type:hash")}, expected: "+hash\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCommands(t, tt.input...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+// emptyKeyspace gives the test a keyspace of its own, for the commands
+// whose reply depends on every key there is.
+func emptyKeyspace(t *testing.T) {
+	t.Helper()
+
+	orig := keyspace
+	keyspace = NewKeyspace()
+	t.Cleanup(func() { keyspace = orig })
+}
+
+func TestKeyspaceCommands(t *testing.T) {
+	freezeClock(t, 1_000_000)
+
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{
+			name:     "del",
+			input:    []Value{makeCommand("SET", "keys:del1", "v"), makeCommand("HSET", "keys:del2", "f", "v"), makeCommand("DEL", "keys:del1", "keys:del2", "keys:del3")},
+			expected: ":2\r\n",
+		},
+		{
+			name:     "del removes the key",
+			input:    []Value{makeCommand("RPUSH", "keys:gone", "a"), makeCommand("DEL", "keys:gone"), makeCommand("TYPE", "keys:gone")},
+			expected: "+none\r\n",
+		},
+		{
+			name:     "del removes the ttl",
+			input:    []Value{makeCommand("SET", "keys:delttl", "v"), makeCommand("EXPIRE", "keys:delttl", "100"), makeCommand("DEL", "keys:delttl"), makeCommand("SET", "keys:delttl", "v"), makeCommand("TTL", "keys:delttl")},
+			expected: ":-1\r\n",
+		},
+		{
+			name:     "del skips expired keys",
+			input:    []Value{makeCommand("SET", "keys:expired", "v"), makeCommand("PEXPIREAT", "keys:expired", "1"), makeCommand("DEL", "keys:expired")},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "unlink",
+			input:    []Value{makeCommand("SADD", "keys:unlink", "a"), makeCommand("UNLINK", "keys:unlink", "keys:unlink"), makeCommand("TYPE", "keys:unlink")},
+			expected: "+none\r\n",
+		},
+		{
+			name:     "exists counts repeated keys",
+			input:    []Value{makeCommand("SET", "keys:exists", "v"), makeCommand("EXISTS", "keys:exists", "keys:exists", "keys:nope")},
+			expected: ":2\r\n",
+		},
+		{
+			name:     "touch",
+			input:    []Value{makeCommand("SET", "keys:touch", "v"), makeCommand("TOUCH", "keys:touch", "keys:nope")},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "rename",
+			input:    []Value{makeCommand("RPUSH", "keys:src", "a"), makeCommand("RENAME", "keys:src", "keys:dst"), makeCommand("LRANGE", "keys:dst", "0", "-1")},
+			expected: "*1\r\n$1\r\na\r\n",
+		},
+		{
+			name:     "rename removes the source",
+			input:    []Value{makeCommand("SET", "keys:src2", "v"), makeCommand("RENAME", "keys:src2", "keys:dst2"), makeCommand("EXISTS", "keys:src2")},
+			expected: ":0\r\n",
+		},
+		{
+			name: "rename moves the ttl",
+			input: []Value{
+				makeCommand("SET", "keys:src3", "v"),
+				makeCommand("PEXPIRE", "keys:src3", "500"),
+				makeCommand("SET", "keys:dst3", "v"),
+				makeCommand("RENAME", "keys:src3", "keys:dst3"),
+				makeCommand("PTTL", "keys:dst3"),
+			},
+			expected: ":500\r\n",
+		},
+		{
+			name: "rename drops the ttl of the destination",
+			input: []Value{
+				makeCommand("SET", "keys:src4", "v"),
+				makeCommand("SET", "keys:dst4", "v"),
+				makeCommand("EXPIRE", "keys:dst4", "100"),
+				makeCommand("RENAME", "keys:src4", "keys:dst4"),
+				makeCommand("TTL", "keys:dst4"),
+			},
+			expected: ":-1\r\n",
+		},
+		{name: "rename missing key", input: []Value{makeCommand("RENAME", "keys:nope", "keys:dst")}, expected: "-ERR no such key\r\n"},
+		{
+			name:     "rename to itself",
+			input:    []Value{makeCommand("SET", "keys:self", "v"), makeCommand("RENAME", "keys:self", "keys:self"), makeCommand("GET", "keys:self")},
+			expected: "$1\r\nv\r\n",
+		},
+		{
+			name:     "renamenx to an existing key",
+			input:    []Value{makeCommand("SET", "keys:nxsrc", "a"), makeCommand("SET", "keys:nxdst", "b"), makeCommand("RENAMENX", "keys:nxsrc", "keys:nxdst")},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "renamenx",
+			input:    []Value{makeCommand("SET", "keys:nxsrc2", "a"), makeCommand("RENAMENX", "keys:nxsrc2", "keys:nxdst2"), makeCommand("GET", "keys:nxdst2")},
+			expected: "$1\r\na\r\n",
+		},
+		{
+			name: "copy",
+			input: []Value{
+				makeCommand("ZADD", "keys:csrc", "1", "a", "2", "b"),
+				makeCommand("COPY", "keys:csrc", "keys:cdst"),
+				makeCommand("ZRANGE", "keys:cdst", "0", "-1", "WITHSCORES"),
+			},
+			expected: "*4\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		},
+		{
+			name:     "copy to an existing key",
+			input:    []Value{makeCommand("SET", "keys:csrc2", "a"), makeCommand("SET", "keys:cdst2", "b"), makeCommand("COPY", "keys:csrc2", "keys:cdst2")},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "copy replace",
+			input:    []Value{makeCommand("SET", "keys:csrc3", "a"), makeCommand("HSET", "keys:cdst3", "f", "v"), makeCommand("COPY", "keys:csrc3", "keys:cdst3", "REPLACE"), makeCommand("GET", "keys:cdst3")},
+			expected: "$1\r\na\r\n",
+		},
+		{
+			name:     "copy keeps the ttl",
+			input:    []Value{makeCommand("SET", "keys:csrc4", "a"), makeCommand("PEXPIRE", "keys:csrc4", "500"), makeCommand("COPY", "keys:csrc4", "keys:cdst4"), makeCommand("PTTL", "keys:cdst4")},
+			expected: ":500\r\n",
+		},
+		{name: "copy missing key", input: []Value{makeCommand("COPY", "keys:nope", "keys:cdst5")}, expected: ":0\r\n"},
+		{name: "copy to itself", input: []Value{makeCommand("COPY", "keys:csrc", "keys:csrc")}, expected: "-ERR source and destination objects are the same\r\n"},
+		{name: "copy to another db", input: []Value{makeCommand("COPY", "keys:csrc", "keys:cdst6", "DB", "1")}, expected: "-ERR DB index is out of range\r\n"},
+		{name: "copy syntax error", input: []Value{makeCommand("COPY", "keys:csrc", "keys:cdst6", "FOO")}, expected: "-ERR syntax error\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCommands(t, tt.input...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestKeyspaceRandomKeyAndDBSize(t *testing.T) {
+	emptyKeyspace(t)
+	advance := freezeClock(t, 1_000_000)
+
+	if result, expected := runCommands(t, makeCommand("RANDOMKEY")), "$-1\r\n"; result != expected {
+		t.Errorf("expected %q on an empty keyspace, got %q", expected, result)
+	}
+
+	runCommands(t,
+		makeCommand("SET", "random:live", "v"),
+		makeCommand("SET", "random:expired", "v"),
+		makeCommand("PEXPIRE", "random:expired", "10"),
+	)
+	advance(10)
+
+	if result, expected := runCommands(t, makeCommand("DBSIZE")), ":2\r\n"; result != expected {
+		t.Errorf("expected %q before the expired key is reclaimed, got %q", expected, result)
+	}
+
+	for i := 0; i < 10; i++ {
+		if result, expected := runCommands(t, makeCommand("RANDOMKEY")), "$11\r\nrandom:live\r\n"; result != expected {
+			t.Fatalf("expected %q, got %q", expected, result)
+		}
+	}
+
+	if result, expected := runCommands(t, makeCommand("DBSIZE")), ":1\r\n"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+// TestKeyspaceCopyIsDeep modifies every kind of copied value and checks the
+// source is left alone.
+func TestKeyspaceCopyIsDeep(t *testing.T) {
+	freezeClock(t, 1_000_000)
+
+	tests := []struct {
+		name   string
+		setup  []Value
+		modify []Value
+		check  Value
+		// expected is the reply of check on the source.
+		expected string
+	}{
+		{
+			name:     "hash",
+			setup:    []Value{makeCommand("HSET", "deep:hash", "f", "v"), makeCommand("HPEXPIRE", "deep:hash", "500", "FIELDS", "1", "f")},
+			modify:   []Value{makeCommand("HSET", "deep:hash:copy", "g", "w"), makeCommand("HPERSIST", "deep:hash:copy", "FIELDS", "1", "f")},
+			check:    makeCommand("HPTTL", "deep:hash", "FIELDS", "2", "f", "g"),
+			expected: "*2\r\n:500\r\n:-2\r\n",
+		},
+		{
+			name:     "list",
+			setup:    []Value{makeCommand("RPUSH", "deep:list", "a", "b")},
+			modify:   []Value{makeCommand("LSET", "deep:list:copy", "0", "x"), makeCommand("RPUSH", "deep:list:copy", "c")},
+			check:    makeCommand("LRANGE", "deep:list", "0", "-1"),
+			expected: "*2\r\n$1\r\na\r\n$1\r\nb\r\n",
+		},
+		{
+			name:     "intset",
+			setup:    []Value{makeCommand("SADD", "deep:intset", "1")},
+			modify:   []Value{makeCommand("SADD", "deep:intset:copy", "2")},
+			check:    makeCommand("SCARD", "deep:intset"),
+			expected: ":1\r\n",
+		},
+		{
+			name:     "set",
+			setup:    []Value{makeCommand("SADD", "deep:set", "a")},
+			modify:   []Value{makeCommand("SADD", "deep:set:copy", "b"), makeCommand("SREM", "deep:set:copy", "a")},
+			check:    makeCommand("SMEMBERS", "deep:set"),
+			expected: "*1\r\n$1\r\na\r\n",
+		},
+		{
+			name:     "zset",
+			setup:    []Value{makeCommand("ZADD", "deep:zset", "1", "a", "2", "b")},
+			modify:   []Value{makeCommand("ZADD", "deep:zset:copy", "3", "a"), makeCommand("ZREM", "deep:zset:copy", "b")},
+			check:    makeCommand("ZRANGE", "deep:zset", "0", "-1", "WITHSCORES"),
+			expected: "*4\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		},
+		{
+			name: "stream",
+			setup: []Value{
+				makeCommand("XADD", "deep:stream", "1", "f", "v"),
+				makeCommand("XADD", "deep:stream", "2", "f", "v"),
+				makeCommand("XGROUP", "CREATE", "deep:stream", "g", "0"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "COUNT", "1", "STREAMS", "deep:stream", ">"),
+			},
+			modify: []Value{
+				makeCommand("XDEL", "deep:stream:copy", "2"),
+				makeCommand("XACK", "deep:stream:copy", "g", "1"),
+				makeCommand("XGROUP", "CREATECONSUMER", "deep:stream:copy", "g", "d"),
+			},
+			check:    makeCommand("XINFO", "STREAM", "deep:stream", "FULL"),
+			expected: "", // compared with the source before the copy
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runCommands(t, tt.setup...)
+
+			expected := tt.expected
+			if expected == "" {
+				expected = runCommands(t, tt.check)
+			}
+
+			src := tt.check.array[1].bulk
+			runCommands(t, makeCommand("COPY", src, src+":copy"))
+			runCommands(t, tt.modify...)
+
+			if result := runCommands(t, tt.check); result != expected {
+				t.Errorf("expected the source to stay %q, got %q", expected, result)
+			}
+		})
+	}
+}
+
+func TestKeyspaceUnlinkLazyfree(t *testing.T) {
+	input := []Value{makeCommand("HSET", "lazyfree:hash")}
+	for i := 0; i <= lazyfreeThreshold; i++ {
+		input[0].array = append(input[0].array, makeCommand("f"+strconv.Itoa(i), "v").array...)
+	}
+	runCommands(t, input...)
+
+	keyspace.mutex.Lock()
+	hash := keyspace.Lookup("lazyfree:hash").value.(*Hash)
+	keyspace.mutex.Unlock()
+
+	if result, expected := runCommands(t, makeCommand("UNLINK", "lazyfree:hash")), ":1\r\n"; result != expected {
+		t.Fatalf("expected %q, got %q", expected, result)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for lazyfreePending.Load() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the hash to be freed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if hash.Len() != 0 {
+		t.Errorf("expected the unlinked hash to be freed, %d fields are left", hash.Len())
+	}
+}
+
+func TestKeyspacePropagation(t *testing.T) {
+	freezeClock(t, 1_000_000)
+
+	logged := propagated(t,
+		makeCommand("SET", "keys:aof", "v"),
+		makeCommand("DEL", "keys:aof:missing"),
+		makeCommand("RENAME", "keys:aof", "keys:aof:renamed"),
+		makeCommand("RENAMENX", "keys:aof:renamed", "keys:aof:renamed"),
+		makeCommand("COPY", "keys:aof:renamed", "keys:aof:copy"),
+		makeCommand("UNLINK", "keys:aof:renamed", "keys:aof:copy"),
+	)
+
+	expected := []Value{
+		makeCommand("SET", "keys:aof", "v"),
+		makeCommand("RENAME", "keys:aof", "keys:aof:renamed"),
+		makeCommand("COPY", "keys:aof:renamed", "keys:aof:copy"),
+		makeCommand("UNLINK", "keys:aof:renamed", "keys:aof:copy"),
+	}
+	assertPropagated(t, logged, expected)
+}
+
+// scanAll iterates with a SCAN family command until the cursor comes back
+// to 0, and returns every element it replied with. prefix is what precedes
+// the cursor, and options what follows it.
+func scanAll(t *testing.T, prefix []string, options ...string) []string {
+	t.Helper()
+
+	cmdHandler := NewCommandHandler()
+
+	var elements []string
+	cursor := "0"
+	for {
+		args := append(append(slices.Clone(prefix[1:]), cursor), options...)
+		result, err := cmdHandler.Handle(prefix[0], makeCommand(args...).array)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.typ != "array" {
+			t.Fatalf("expected a cursor and elements, got %q", result.Serialize())
+		}
+
+		for _, element := range result.array[1].array {
+			elements = append(elements, element.bulk)
+		}
+
+		if cursor = result.array[0].bulk; cursor == "0" {
+			return elements
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	emptyKeyspace(t)
+	advance := freezeClock(t, 1_000_000)
+
+	input := []Value{makeCommand("HSET", "scan:hash", "f", "v"), makeCommand("SET", "scan:expired", "v"), makeCommand("PEXPIRE", "scan:expired", "10")}
+	for i := 0; i < 100; i++ {
+		input = append(input, makeCommand("SET", "scan:"+strconv.Itoa(i), "v"))
+	}
+	runCommands(t, input...)
+	advance(10)
+
+	keys := scanAll(t, []string{"SCAN"}, "COUNT", "7")
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+	if len(keys) != 101 || slices.Contains(keys, "scan:expired") {
+		t.Errorf("expected the 101 live keys, got %d: %v", len(keys), keys)
+	}
+
+	keys = scanAll(t, []string{"SCAN"}, "MATCH", "scan:1?")
+	slices.Sort(keys)
+	if expected := []string{"scan:10", "scan:11", "scan:12", "scan:13", "scan:14", "scan:15", "scan:16", "scan:17", "scan:18", "scan:19"}; !slices.Equal(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+
+	if keys := scanAll(t, []string{"SCAN"}, "TYPE", "hash"); !slices.Equal(keys, []string{"scan:hash"}) {
+		t.Errorf("expected only the hash, got %v", keys)
+	}
+
+	tests := []struct {
+		name     string
+		input    Value
+		expected string
+	}{
+		{name: "invalid cursor", input: makeCommand("SCAN", "-1"), expected: "-ERR invalid cursor\r\n"},
+		{name: "zero count", input: makeCommand("SCAN", "0", "COUNT", "0"), expected: "-ERR syntax error\r\n"},
+		{name: "unknown type", input: makeCommand("SCAN", "0", "TYPE", "foo"), expected: "-ERR unknown type name 'foo'\r\n"},
+		{name: "novalues", input: makeCommand("SCAN", "0", "NOVALUES"), expected: "-ERR syntax error\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := runCommands(t, tt.input); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
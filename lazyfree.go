@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sync/atomic"
+)
+
+// lazyfreeThreshold is the effort above which UNLINK frees a value in the
+// background. Handing a small value to another goroutine costs more than
+// freeing it right away.
+const lazyfreeThreshold = 64
+
+// lazyfreePending counts the values handed to the background that are not
+// freed yet.
+var lazyfreePending atomic.Int64
+
+// freeEffort estimates the work freeing obj takes, which like in Redis is
+// about the number of allocations it is made of.
+func freeEffort(obj *Object) int {
+	switch v := obj.value.(type) {
+	case *Hash:
+		return v.Len()
+	case *Set:
+		if v.intset != nil {
+			return 1
+		}
+		return v.Len()
+	case *Quicklist:
+		return v.Len()/quicklistFill + 1
+	case *ZSet:
+		return v.Len()
+	case *Stream:
+		effort := len(v.nodes)
+		for _, cg := range v.groups {
+			effort += cg.pel.Len() + len(cg.consumers)
+		}
+		return effort
+	default:
+		return 1
+	}
+}
+
+// freeObject tears obj down. The memory is reclaimed by the garbage
+// collector anyway, but unlinking every entry of a huge dict or every node
+// of a long list is work of its own, which is what UNLINK takes off the
+// keyspace lock.
+func freeObject(obj *Object) {
+	switch v := obj.value.(type) {
+	case *Hash:
+		v.fields.Clear()
+		clear(v.expires)
+	case *Set:
+		v.index.Clear()
+		v.intset, v.members = nil, nil
+	case *Quicklist:
+		for node := v.head; node != nil; {
+			next := node.next
+			node.prev, node.next, node.entries = nil, nil, nil
+			node = next
+		}
+		v.head, v.tail, v.count = nil, nil, 0
+	case *ZSet:
+		v.dict.Clear()
+		for x := v.zsl.header.level[0].forward; x != nil; {
+			next := x.level[0].forward
+			x.backward, x.level = nil, nil
+			x = next
+		}
+		v.zsl = newZskiplist()
+	case *Stream:
+		clear(v.groups)
+		v.nodes = nil
+	}
+}
+
+// freeObjectAsync frees obj on a background goroutine if it is big enough
+// to be worth it, and right away otherwise. Nothing else may reference obj.
+func freeObjectAsync(obj *Object) {
+	if freeEffort(obj) <= lazyfreeThreshold {
+		freeObject(obj)
+		return
+	}
+
+	lazyfreePending.Add(1)
+	go func() {
+		freeObject(obj)
+		lazyfreePending.Add(-1)
+	}()
+}
@@ -0,0 +1,1100 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+func registerListCommands(commands map[string]Command) {
+	commands["LPUSH"] = Command{
+		details: Details{
+			name:              "lpush",
+			arity:             -3,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@list", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: lpush,
+	}
+
+	commands["RPUSH"] = Command{
+		details: Details{
+			name:              "rpush",
+			arity:             -3,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@list", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: rpush,
+	}
+
+	commands["LPUSHX"] = Command{
+		details: Details{
+			name:              "lpushx",
+			arity:             -3,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@list", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: lpushx,
+	}
+
+	commands["RPUSHX"] = Command{
+		details: Details{
+			name:              "rpushx",
+			arity:             -3,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@list", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: rpushx,
+	}
+
+	commands["LPOP"] = Command{
+		details: Details{
+			name:              "lpop",
+			arity:             -2,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@list", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: lpop,
+	}
+
+	commands["RPOP"] = Command{
+		details: Details{
+			name:              "rpop",
+			arity:             -2,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@list", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: rpop,
+	}
+
+	commands["LLEN"] = Command{
+		details: Details{
+			name:              "llen",
+			arity:             2,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@list", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: llen,
+	}
+
+	commands["LINDEX"] = Command{
+		details: Details{
+			name:              "lindex",
+			arity:             3,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@list", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: lindex,
+	}
+
+	commands["LSET"] = Command{
+		details: Details{
+			name:              "lset",
+			arity:             4,
+			flags:             []string{"write", "denyoom"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@list", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: lset,
+	}
+
+	commands["LRANGE"] = Command{
+		details: Details{
+			name:              "lrange",
+			arity:             4,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@list", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: lrange,
+	}
+
+	commands["LINSERT"] = Command{
+		details: Details{
+			name:              "linsert",
+			arity:             5,
+			flags:             []string{"write", "denyoom"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@list", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: linsert,
+	}
+
+	commands["LREM"] = Command{
+		details: Details{
+			name:              "lrem",
+			arity:             4,
+			flags:             []string{"write"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@list", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: lrem,
+	}
+
+	commands["LTRIM"] = Command{
+		details: Details{
+			name:              "ltrim",
+			arity:             4,
+			flags:             []string{"write"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@list", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: ltrim,
+	}
+
+	commands["LPOS"] = Command{
+		details: Details{
+			name:              "lpos",
+			arity:             -3,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@list", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: lpos,
+	}
+
+	commands["LMOVE"] = Command{
+		details: Details{
+			name:              "lmove",
+			arity:             5,
+			flags:             []string{"write", "denyoom"},
+			firstKey:          1,
+			lastKey:           2,
+			step:              1,
+			aclCategories:     []string{"@write", "@list", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: lmove,
+	}
+
+	commands["RPOPLPUSH"] = Command{
+		details: Details{
+			name:              "rpoplpush",
+			arity:             3,
+			flags:             []string{"write", "denyoom"},
+			firstKey:          1,
+			lastKey:           2,
+			step:              1,
+			aclCategories:     []string{"@write", "@list", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: rpoplpush,
+	}
+
+	commands["LMPOP"] = Command{
+		details: Details{
+			name:              "lmpop",
+			arity:             -4,
+			flags:             []string{"write", "movablekeys"},
+			firstKey:          0,
+			lastKey:           0,
+			step:              0,
+			aclCategories:     []string{"@write", "@list", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: lmpop,
+	}
+
+	commands["BLPOP"] = Command{
+		details: Details{
+			name:              "blpop",
+			arity:             -3,
+			flags:             []string{"write", "blocking"},
+			firstKey:          1,
+			lastKey:           -2,
+			step:              1,
+			aclCategories:     []string{"@write", "@list", "@slow", "@blocking"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: blpop,
+	}
+
+	commands["BRPOP"] = Command{
+		details: Details{
+			name:              "brpop",
+			arity:             -3,
+			flags:             []string{"write", "blocking"},
+			firstKey:          1,
+			lastKey:           -2,
+			step:              1,
+			aclCategories:     []string{"@write", "@list", "@slow", "@blocking"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: brpop,
+	}
+
+	commands["BLMOVE"] = Command{
+		details: Details{
+			name:              "blmove",
+			arity:             6,
+			flags:             []string{"write", "denyoom", "blocking"},
+			firstKey:          1,
+			lastKey:           2,
+			step:              1,
+			aclCategories:     []string{"@write", "@list", "@slow", "@blocking"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: blmove,
+	}
+
+	commands["BRPOPLPUSH"] = Command{
+		details: Details{
+			name:              "brpoplpush",
+			arity:             4,
+			flags:             []string{"write", "denyoom", "blocking"},
+			firstKey:          1,
+			lastKey:           2,
+			step:              1,
+			aclCategories:     []string{"@write", "@list", "@slow", "@blocking"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: brpoplpush,
+	}
+
+	commands["BLMPOP"] = Command{
+		details: Details{
+			name:              "blmpop",
+			arity:             -5,
+			flags:             []string{"write", "blocking", "movablekeys"},
+			firstKey:          0,
+			lastKey:           0,
+			step:              0,
+			aclCategories:     []string{"@write", "@list", "@slow", "@blocking"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: blmpop,
+	}
+}
+
+// Ends of a list, as in LIST_HEAD and LIST_TAIL.
+const (
+	listHead = iota
+	listTail
+)
+
+// parseListWhere parses the LEFT and RIGHT arguments of the list commands.
+func parseListWhere(arg string) (int, bool) {
+	switch strings.ToUpper(arg) {
+	case "LEFT":
+		return listHead, true
+	case "RIGHT":
+		return listTail, true
+	}
+
+	return 0, false
+}
+
+func listWhereName(where int) string {
+	if where == listHead {
+		return "LEFT"
+	}
+	return "RIGHT"
+}
+
+// lookupList returns the list stored at key, or nil if there is none. The
+// error is set when the key holds another type.
+func lookupList(key string) (*Quicklist, *RespError) {
+	obj := keyspace.Lookup(key)
+	if obj == nil {
+		return nil, nil
+	}
+	if obj.typ != TypeList {
+		return nil, ErrWrongType
+	}
+
+	return obj.value.(*Quicklist), nil
+}
+
+// lookupListForWrite is lookupList, except that a missing list is created.
+func lookupListForWrite(key string) (*Quicklist, *RespError) {
+	list, err := lookupList(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if list == nil {
+		list = NewQuicklist()
+		keyspace.Set(key, &Object{typ: TypeList, value: list})
+	}
+
+	return list, nil
+}
+
+// deleteIfEmptyList deletes the key of a list that just lost its last
+// element, since Redis never keeps empty aggregates around.
+func deleteIfEmptyList(key string, list *Quicklist) {
+	if list.Len() == 0 {
+		keyspace.Delete(key)
+	}
+}
+
+func listPush(list *Quicklist, where int, val string) {
+	if where == listHead {
+		list.PushHead(val)
+	} else {
+		list.PushTail(val)
+	}
+}
+
+func listPop(list *Quicklist, where int) (string, bool) {
+	if where == listHead {
+		return list.PopHead()
+	}
+	return list.PopTail()
+}
+
+// normalizeRange clamps the start and stop indexes of LRANGE-like commands
+// to a list of length llen, with negative indexes counting from the end. It
+// reports false when the range is empty.
+func normalizeRange(start, stop int64, llen int) (int, int, bool) {
+	n := int64(llen)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+
+	return int(start), int(stop), true
+}
+
+func pushGeneric(c *Client, args []Value, where int, xx bool) Value {
+	key := args[0].bulk
+
+	list, err := lookupList(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	if list == nil {
+		if xx {
+			return MakeIntValue(0)
+		}
+		list, _ = lookupListForWrite(key)
+	}
+
+	for _, arg := range args[1:] {
+		listPush(list, where, arg.bulk)
+	}
+	keyspace.dirty++
+
+	return MakeIntValue(list.Len())
+}
+
+func lpush(c *Client, args []Value) Value {
+	return pushGeneric(c, args, listHead, false)
+}
+
+func rpush(c *Client, args []Value) Value {
+	return pushGeneric(c, args, listTail, false)
+}
+
+func lpushx(c *Client, args []Value) Value {
+	return pushGeneric(c, args, listHead, true)
+}
+
+func rpushx(c *Client, args []Value) Value {
+	return pushGeneric(c, args, listTail, true)
+}
+
+// popCount pops up to count elements from the list stored at key, deleting
+// the key once it is empty.
+func popCount(key string, list *Quicklist, where int, count int) []Value {
+	result := make([]Value, 0, min(count, list.Len()))
+	for len(result) < count {
+		val, ok := listPop(list, where)
+		if !ok {
+			break
+		}
+		result = append(result, MakeBulkValue(val))
+	}
+
+	deleteIfEmptyList(key, list)
+	return result
+}
+
+// parsePositiveCount parses the count argument of the popping commands.
+func parsePositiveCount(arg string) (int, *RespError) {
+	count, ok := parseInteger(arg)
+	if !ok {
+		return 0, ErrNotInteger
+	}
+	if count < 0 {
+		return 0, NewErr("value is out of range, must be positive")
+	}
+
+	return int(count), nil
+}
+
+// popGeneric implements LPOP and RPOP. Without a count the reply is a single
+// element, with one it is an array, null when the key doesn't exist.
+func popGeneric(c *Client, args []Value, name string, where int) Value {
+	key := args[0].bulk
+
+	if len(args) > 2 {
+		return ErrWrongArity(name).Value()
+	}
+
+	count, hasCount := 1, len(args) == 2
+	if hasCount {
+		var err *RespError
+		if count, err = parsePositiveCount(args[1].bulk); err != nil {
+			return err.Value()
+		}
+	}
+
+	list, err := lookupList(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	if list == nil {
+		if hasCount {
+			return MakeNilArrayValue()
+		}
+		return MakeNilValue()
+	}
+
+	if hasCount && count == 0 {
+		return Value{typ: "array", array: []Value{}}
+	}
+
+	result := popCount(key, list, where, count)
+	keyspace.dirty++
+
+	if !hasCount {
+		return result[0]
+	}
+	return Value{typ: "array", array: result}
+}
+
+func lpop(c *Client, args []Value) Value {
+	return popGeneric(c, args, "lpop", listHead)
+}
+
+func rpop(c *Client, args []Value) Value {
+	return popGeneric(c, args, "rpop", listTail)
+}
+
+func llen(c *Client, args []Value) Value {
+	list, err := lookupList(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	return MakeIntValue(list.Len())
+}
+
+func lindex(c *Client, args []Value) Value {
+	index, ok := parseInteger(args[1].bulk)
+	if !ok {
+		return ErrNotInteger.Value()
+	}
+
+	list, err := lookupList(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	val, ok := list.Index(int(index))
+	if !ok {
+		return MakeNilValue()
+	}
+
+	return MakeBulkValue(val)
+}
+
+func lset(c *Client, args []Value) Value {
+	index, ok := parseInteger(args[1].bulk)
+	if !ok {
+		return ErrNotInteger.Value()
+	}
+
+	list, err := lookupList(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+	if list == nil {
+		return NewErr("no such key").Value()
+	}
+
+	if !list.Set(int(index), args[2].bulk) {
+		return NewErr("index out of range").Value()
+	}
+	keyspace.dirty++
+
+	return MakeStringValue("OK")
+}
+
+func lrange(c *Client, args []Value) Value {
+	start, ok := parseInteger(args[1].bulk)
+	if !ok {
+		return ErrNotInteger.Value()
+	}
+	stop, ok := parseInteger(args[2].bulk)
+	if !ok {
+		return ErrNotInteger.Value()
+	}
+
+	list, err := lookupList(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	from, to, ok := normalizeRange(start, stop, list.Len())
+	if !ok {
+		return Value{typ: "array", array: []Value{}}
+	}
+
+	result := make([]Value, 0, to-from+1)
+	it := list.Iterator(from, false)
+	for i := from; i <= to; i++ {
+		val, _ := it.Next()
+		result = append(result, MakeBulkValue(val))
+	}
+
+	return Value{typ: "array", array: result}
+}
+
+// linsert replies with the new length of the list, -1 when the pivot is not
+// found and 0 when the key doesn't exist.
+func linsert(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	var after bool
+	switch strings.ToUpper(args[1].bulk) {
+	case "BEFORE":
+		after = false
+	case "AFTER":
+		after = true
+	default:
+		return ErrSyntax.Value()
+	}
+
+	list, err := lookupList(key)
+	if err != nil {
+		return err.Value()
+	}
+	if list == nil {
+		return MakeIntValue(0)
+	}
+
+	pivot, index := args[2].bulk, -1
+	it := list.Iterator(0, false)
+	for i := 0; ; i++ {
+		val, ok := it.Next()
+		if !ok {
+			break
+		}
+		if val == pivot {
+			index = i
+			break
+		}
+	}
+
+	if index < 0 {
+		return MakeIntValue(-1)
+	}
+
+	if after {
+		index++
+	}
+	list.Insert(index, args[3].bulk)
+	keyspace.dirty++
+
+	return MakeIntValue(list.Len())
+}
+
+func lrem(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	count, ok := parseInteger(args[1].bulk)
+	if !ok {
+		return ErrNotInteger.Value()
+	}
+
+	list, err := lookupList(key)
+	if err != nil {
+		return err.Value()
+	}
+	if list == nil {
+		return MakeIntValue(0)
+	}
+
+	removed := list.Remove(args[2].bulk, int(count))
+	if removed > 0 {
+		deleteIfEmptyList(key, list)
+		keyspace.dirty++
+	}
+
+	return MakeIntValue(removed)
+}
+
+func ltrim(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	start, ok := parseInteger(args[1].bulk)
+	if !ok {
+		return ErrNotInteger.Value()
+	}
+	stop, ok := parseInteger(args[2].bulk)
+	if !ok {
+		return ErrNotInteger.Value()
+	}
+
+	list, err := lookupList(key)
+	if err != nil {
+		return err.Value()
+	}
+	if list == nil {
+		return MakeStringValue("OK")
+	}
+
+	llen := list.Len()
+	ltrim, rtrim := llen, 0
+	if from, to, ok := normalizeRange(start, stop, llen); ok {
+		ltrim, rtrim = from, llen-to-1
+	}
+
+	list.DeleteRange(0, ltrim)
+	list.DeleteRange(list.Len()-rtrim, rtrim)
+	deleteIfEmptyList(key, list)
+	keyspace.dirty += ltrim + rtrim
+
+	return MakeStringValue("OK")
+}
+
+// lpos returns the index of the rank-th match of the element, scanning from
+// the tail for a negative rank. With COUNT it returns up to count indexes,
+// all of them when count is 0, and MAXLEN bounds how many entries are
+// compared.
+func lpos(c *Client, args []Value) Value {
+	rank, count, maxlen := int64(1), int64(-1), int64(0)
+
+	for i := 2; i < len(args); i += 2 {
+		opt := strings.ToUpper(args[i].bulk)
+		if i+1 >= len(args) {
+			return ErrSyntax.Value()
+		}
+
+		n, ok := parseInteger(args[i+1].bulk)
+		if !ok {
+			return ErrNotInteger.Value()
+		}
+
+		switch opt {
+		case "RANK":
+			if n == 0 {
+				return NewErr("RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list").Value()
+			}
+			if n == math.MinInt64 {
+				return NewErr("value is out of range").Value()
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return NewErr("COUNT can't be negative").Value()
+			}
+			count = n
+		case "MAXLEN":
+			if n < 0 {
+				return NewErr("MAXLEN can't be negative").Value()
+			}
+			maxlen = n
+		default:
+			return ErrSyntax.Value()
+		}
+	}
+
+	list, err := lookupList(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	if list == nil {
+		if count >= 0 {
+			return Value{typ: "array", array: []Value{}}
+		}
+		return MakeNilValue()
+	}
+
+	reverse, skip := rank < 0, rank-1
+	it, index, step := list.Iterator(0, false), 0, 1
+	if reverse {
+		it, index, step, skip = list.Iterator(-1, true), list.Len()-1, -1, -rank-1
+	}
+
+	element, wanted := args[1].bulk, count
+	if wanted < 0 {
+		wanted = 1
+	}
+
+	var matches []Value
+	for compared := int64(0); maxlen == 0 || compared < maxlen; compared++ {
+		val, ok := it.Next()
+		if !ok {
+			break
+		}
+
+		if val == element {
+			if skip > 0 {
+				skip--
+			} else {
+				matches = append(matches, MakeIntValue(index))
+				if wanted > 0 && int64(len(matches)) == wanted {
+					break
+				}
+			}
+		}
+		index += step
+	}
+
+	if count < 0 {
+		if len(matches) == 0 {
+			return MakeNilValue()
+		}
+		return matches[0]
+	}
+
+	return Value{typ: "array", array: append([]Value{}, matches...)}
+}
+
+// moveGeneric pops an element from the source list and pushes it to the
+// destination, which may be the same list. The destination type is checked
+// before anything is popped.
+func moveGeneric(src, dst string, from, to int) Value {
+	list, err := lookupList(src)
+	if err != nil {
+		return err.Value()
+	}
+	if list == nil {
+		return MakeNilValue()
+	}
+
+	dstList, err := lookupListForWrite(dst)
+	if err != nil {
+		return err.Value()
+	}
+
+	// The source is only checked for emptiness after the push, as when it is
+	// also the destination, rotating its only element must keep the key and
+	// its TTL.
+	val, _ := listPop(list, from)
+	listPush(dstList, to, val)
+	deleteIfEmptyList(src, list)
+	keyspace.dirty++
+
+	return MakeBulkValue(val)
+}
+
+func lmove(c *Client, args []Value) Value {
+	from, ok := parseListWhere(args[2].bulk)
+	if !ok {
+		return ErrSyntax.Value()
+	}
+	to, ok := parseListWhere(args[3].bulk)
+	if !ok {
+		return ErrSyntax.Value()
+	}
+
+	return moveGeneric(args[0].bulk, args[1].bulk, from, to)
+}
+
+func rpoplpush(c *Client, args []Value) Value {
+	return moveGeneric(args[0].bulk, args[1].bulk, listTail, listHead)
+}
+
+// parseMpopArgs parses the "numkeys key [key ...] where [COUNT count]"
+// arguments shared by LMPOP, BLMPOP, ZMPOP and BZMPOP, where is parsed with
+// parseWhere.
+func parseMpopArgs(args []Value, parseWhere func(string) (int, bool)) (keys []string, where int, count int, err *RespError) {
+	numKeys, ok := parseInteger(args[0].bulk)
+	if !ok {
+		return nil, 0, 0, ErrNotInteger
+	}
+	if numKeys <= 0 {
+		return nil, 0, 0, NewErr("numkeys should be greater than 0")
+	}
+	if numKeys > int64(len(args)-2) {
+		return nil, 0, 0, ErrSyntax
+	}
+
+	rest := args[numKeys+1:]
+	where, ok = parseWhere(rest[0].bulk)
+	if !ok {
+		return nil, 0, 0, ErrSyntax
+	}
+
+	count = 1
+	switch {
+	case len(rest) == 1:
+	case len(rest) == 3 && strings.EqualFold(rest[1].bulk, "COUNT"):
+		n, ok := parseInteger(rest[2].bulk)
+		if !ok || n <= 0 {
+			return nil, 0, 0, NewErr("count should be greater than 0")
+		}
+		count = int(n)
+	default:
+		return nil, 0, 0, ErrSyntax
+	}
+
+	keys = make([]string, numKeys)
+	for i := range keys {
+		keys[i] = args[i+1].bulk
+	}
+
+	return keys, where, count, nil
+}
+
+// mpopFromKeys pops from the first non empty list among keys. It replies
+// with the key and the popped elements, and propagates the equivalent LPOP
+// or RPOP. ok is false when every list is empty.
+func mpopFromKeys(c *Client, keys []string, where int, count int) (Value, bool) {
+	for _, key := range keys {
+		list, err := lookupList(key)
+		if err != nil {
+			return err.Value(), true
+		}
+		if list == nil {
+			continue
+		}
+
+		elements := popCount(key, list, where, count)
+		keyspace.dirty++
+
+		cmd := "LPOP"
+		if where == listTail {
+			cmd = "RPOP"
+		}
+		c.rewriteCommand(cmd, key, strconv.Itoa(len(elements)))
+
+		return Value{typ: "array", array: []Value{MakeBulkValue(key), {typ: "array", array: elements}}}, true
+	}
+
+	return Value{}, false
+}
+
+func lmpop(c *Client, args []Value) Value {
+	keys, where, count, err := parseMpopArgs(args, parseListWhere)
+	if err != nil {
+		return err.Value()
+	}
+
+	result, ok := mpopFromKeys(c, keys, where, count)
+	if !ok {
+		return MakeNilArrayValue()
+	}
+
+	return result
+}
+
+// blockingPopGeneric implements BLPOP and BRPOP. The first non empty list
+// among the keys is popped from, and the pop is propagated as the LPOP or
+// RPOP it amounts to.
+func blockingPopGeneric(c *Client, args []Value, where int) Value {
+	timeout, err := parseTimeout(args[len(args)-1].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	keys := make([]string, len(args)-1)
+	for i, arg := range args[:len(args)-1] {
+		keys[i] = arg.bulk
+	}
+
+	for _, key := range keys {
+		list, err := lookupList(key)
+		if err != nil {
+			return err.Value()
+		}
+		if list == nil {
+			continue
+		}
+
+		val, _ := listPop(list, where)
+		deleteIfEmptyList(key, list)
+		keyspace.dirty++
+
+		cmd := "LPOP"
+		if where == listTail {
+			cmd = "RPOP"
+		}
+		c.rewriteCommand(cmd, key)
+
+		return Value{typ: "array", array: []Value{MakeBulkValue(key), MakeBulkValue(val)}}
+	}
+
+	c.block(keys, TypeList, timeout, MakeNilArrayValue())
+	return Value{}
+}
+
+func blpop(c *Client, args []Value) Value {
+	return blockingPopGeneric(c, args, listHead)
+}
+
+func brpop(c *Client, args []Value) Value {
+	return blockingPopGeneric(c, args, listTail)
+}
+
+// blockingMoveGeneric implements BLMOVE and BRPOPLPUSH, propagated as the
+// LMOVE they amount to.
+func blockingMoveGeneric(c *Client, src, dst string, from, to int, timeoutArg string) Value {
+	timeout, err := parseTimeout(timeoutArg)
+	if err != nil {
+		return err.Value()
+	}
+
+	list, err := lookupList(src)
+	if err != nil {
+		return err.Value()
+	}
+
+	if list == nil {
+		c.block([]string{src}, TypeList, timeout, MakeNilValue())
+		return Value{}
+	}
+
+	c.rewriteCommand("LMOVE", src, dst, listWhereName(from), listWhereName(to))
+	return moveGeneric(src, dst, from, to)
+}
+
+func blmove(c *Client, args []Value) Value {
+	from, ok := parseListWhere(args[2].bulk)
+	if !ok {
+		return ErrSyntax.Value()
+	}
+	to, ok := parseListWhere(args[3].bulk)
+	if !ok {
+		return ErrSyntax.Value()
+	}
+
+	return blockingMoveGeneric(c, args[0].bulk, args[1].bulk, from, to, args[4].bulk)
+}
+
+func brpoplpush(c *Client, args []Value) Value {
+	return blockingMoveGeneric(c, args[0].bulk, args[1].bulk, listTail, listHead, args[2].bulk)
+}
+
+func blmpop(c *Client, args []Value) Value {
+	timeout, err := parseTimeout(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	keys, where, count, err := parseMpopArgs(args[1:], parseListWhere)
+	if err != nil {
+		return err.Value()
+	}
+
+	result, ok := mpopFromKeys(c, keys, where, count)
+	if !ok {
+		c.block(keys, TypeList, timeout, MakeNilArrayValue())
+		return Value{}
+	}
+
+	return result
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestListCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{name: "lpush returns length", input: []Value{makeCommand("LPUSH", "list:push", "a", "b", "c")}, expected: ":3\r\n"},
+		{
+			name:     "lpush and rpush order",
+			input:    []Value{makeCommand("LPUSH", "list:order", "b", "a"), makeCommand("RPUSH", "list:order", "c"), makeCommand("LRANGE", "list:order", "0", "-1")},
+			expected: "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n",
+		},
+		{name: "lpushx on missing key", input: []Value{makeCommand("LPUSHX", "list:pushx", "a"), makeCommand("LLEN", "list:pushx")}, expected: ":0\r\n"},
+		{
+			name:     "rpushx on existing key",
+			input:    []Value{makeCommand("RPUSH", "list:pushx2", "a"), makeCommand("RPUSHX", "list:pushx2", "b", "c")},
+			expected: ":3\r\n",
+		},
+		{
+			name:     "lpop",
+			input:    []Value{makeCommand("RPUSH", "list:lpop", "a", "b"), makeCommand("LPOP", "list:lpop")},
+			expected: "$1\r\na\r\n",
+		},
+		{
+			name:     "rpop with count",
+			input:    []Value{makeCommand("RPUSH", "list:rpop", "a", "b", "c"), makeCommand("RPOP", "list:rpop", "5")},
+			expected: "*3\r\n$1\r\nc\r\n$1\r\nb\r\n$1\r\na\r\n",
+		},
+		{name: "lpop missing key", input: []Value{makeCommand("LPOP", "list:missing")}, expected: "$-1\r\n"},
+		{name: "lpop missing key with count", input: []Value{makeCommand("LPOP", "list:missing", "2")}, expected: "*-1\r\n"},
+		{
+			name:     "lpop zero count",
+			input:    []Value{makeCommand("RPUSH", "list:lpop0", "a"), makeCommand("LPOP", "list:lpop0", "0")},
+			expected: "*0\r\n",
+		},
+		{name: "lpop negative count", input: []Value{makeCommand("LPOP", "list:lpopneg", "-1")}, expected: "-ERR value is out of range, must be positive\r\n"},
+		{
+			name:     "popping the last element deletes the key",
+			input:    []Value{makeCommand("RPUSH", "list:last", "a"), makeCommand("RPOP", "list:last"), makeCommand("TYPE", "list:last")},
+			expected: "+none\r\n",
+		},
+		{
+			name:     "lindex negative",
+			input:    []Value{makeCommand("RPUSH", "list:index", "a", "b", "c"), makeCommand("LINDEX", "list:index", "-1")},
+			expected: "$1\r\nc\r\n",
+		},
+		{
+			name:     "lindex out of range",
+			input:    []Value{makeCommand("RPUSH", "list:index2", "a"), makeCommand("LINDEX", "list:index2", "5")},
+			expected: "$-1\r\n",
+		},
+		{
+			name:     "lset",
+			input:    []Value{makeCommand("RPUSH", "list:set", "a", "b"), makeCommand("LSET", "list:set", "-2", "x"), makeCommand("LRANGE", "list:set", "0", "-1")},
+			expected: "*2\r\n$1\r\nx\r\n$1\r\nb\r\n",
+		},
+		{name: "lset missing key", input: []Value{makeCommand("LSET", "list:set2", "0", "x")}, expected: "-ERR no such key\r\n"},
+		{
+			name:     "lset out of range",
+			input:    []Value{makeCommand("RPUSH", "list:set3", "a"), makeCommand("LSET", "list:set3", "1", "x")},
+			expected: "-ERR index out of range\r\n",
+		},
+		{
+			name:     "lrange clamps indexes",
+			input:    []Value{makeCommand("RPUSH", "list:range", "a", "b", "c"), makeCommand("LRANGE", "list:range", "-100", "1")},
+			expected: "*2\r\n$1\r\na\r\n$1\r\nb\r\n",
+		},
+		{
+			name:     "lrange empty range",
+			input:    []Value{makeCommand("RPUSH", "list:range2", "a", "b", "c"), makeCommand("LRANGE", "list:range2", "2", "1")},
+			expected: "*0\r\n",
+		},
+		{
+			name:     "linsert before",
+			input:    []Value{makeCommand("RPUSH", "list:insert", "a", "c"), makeCommand("LINSERT", "list:insert", "BEFORE", "c", "b"), makeCommand("LRANGE", "list:insert", "0", "-1")},
+			expected: "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n",
+		},
+		{
+			name:     "linsert missing pivot",
+			input:    []Value{makeCommand("RPUSH", "list:insert2", "a"), makeCommand("LINSERT", "list:insert2", "AFTER", "x", "b")},
+			expected: ":-1\r\n",
+		},
+		{name: "linsert missing key", input: []Value{makeCommand("LINSERT", "list:insert3", "AFTER", "x", "b")}, expected: ":0\r\n"},
+		{
+			name:     "lrem from the tail",
+			input:    []Value{makeCommand("RPUSH", "list:rem", "a", "b", "a", "c", "a"), makeCommand("LREM", "list:rem", "-2", "a"), makeCommand("LRANGE", "list:rem", "0", "-1")},
+			expected: "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n",
+		},
+		{
+			name:     "lrem all",
+			input:    []Value{makeCommand("RPUSH", "list:rem2", "a", "b", "a"), makeCommand("LREM", "list:rem2", "0", "a")},
+			expected: ":2\r\n",
+		},
+		{
+			name:     "ltrim",
+			input:    []Value{makeCommand("RPUSH", "list:trim", "a", "b", "c", "d"), makeCommand("LTRIM", "list:trim", "1", "-2"), makeCommand("LRANGE", "list:trim", "0", "-1")},
+			expected: "*2\r\n$1\r\nb\r\n$1\r\nc\r\n",
+		},
+		{
+			name:     "ltrim to nothing deletes the key",
+			input:    []Value{makeCommand("RPUSH", "list:trim2", "a"), makeCommand("LTRIM", "list:trim2", "5", "10"), makeCommand("TYPE", "list:trim2")},
+			expected: "+none\r\n",
+		},
+		{
+			name:     "lpos",
+			input:    []Value{makeCommand("RPUSH", "list:pos", "a", "b", "c", "b"), makeCommand("LPOS", "list:pos", "b")},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "lpos negative rank",
+			input:    []Value{makeCommand("RPUSH", "list:pos2", "a", "b", "c", "b"), makeCommand("LPOS", "list:pos2", "b", "RANK", "-1")},
+			expected: ":3\r\n",
+		},
+		{
+			name:     "lpos count zero",
+			input:    []Value{makeCommand("RPUSH", "list:pos3", "b", "a", "b", "b"), makeCommand("LPOS", "list:pos3", "b", "RANK", "2", "COUNT", "0")},
+			expected: "*2\r\n:2\r\n:3\r\n",
+		},
+		{
+			name:     "lpos maxlen",
+			input:    []Value{makeCommand("RPUSH", "list:pos4", "a", "b", "c"), makeCommand("LPOS", "list:pos4", "c", "MAXLEN", "2")},
+			expected: "$-1\r\n",
+		},
+		{
+			name:     "lpos zero rank",
+			input:    []Value{makeCommand("LPOS", "list:pos5", "a", "RANK", "0")},
+			expected: "-ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list\r\n",
+		},
+		{
+			name:     "lmove",
+			input:    []Value{makeCommand("RPUSH", "list:src", "a", "b"), makeCommand("LMOVE", "list:src", "list:dst", "RIGHT", "LEFT"), makeCommand("LRANGE", "list:dst", "0", "-1")},
+			expected: "*1\r\n$1\r\nb\r\n",
+		},
+		{
+			name:     "lmove rotates the same list",
+			input:    []Value{makeCommand("RPUSH", "list:rotate", "a", "b", "c"), makeCommand("RPOPLPUSH", "list:rotate", "list:rotate"), makeCommand("LRANGE", "list:rotate", "0", "-1")},
+			expected: "*3\r\n$1\r\nc\r\n$1\r\na\r\n$1\r\nb\r\n",
+		},
+		{
+			name: "lmove rotating a single element keeps the ttl",
+			input: []Value{
+				makeCommand("RPUSH", "list:rotate2", "a"),
+				makeCommand("EXPIRE", "list:rotate2", "100"),
+				makeCommand("LMOVE", "list:rotate2", "list:rotate2", "LEFT", "RIGHT"),
+				makeCommand("TTL", "list:rotate2"),
+			},
+			expected: ":100\r\n",
+		},
+		{
+			name:     "lmove to wrong type keeps the source",
+			input:    []Value{makeCommand("RPUSH", "list:src2", "a"), makeCommand("SET", "list:str", "v"), makeCommand("LMOVE", "list:src2", "list:str", "LEFT", "LEFT"), makeCommand("LLEN", "list:src2")},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "lmpop",
+			input:    []Value{makeCommand("RPUSH", "list:mpop2", "a", "b", "c"), makeCommand("LMPOP", "2", "list:mpop1", "list:mpop2", "RIGHT", "COUNT", "2")},
+			expected: "*2\r\n$10\r\nlist:mpop2\r\n*2\r\n$1\r\nc\r\n$1\r\nb\r\n",
+		},
+		{name: "lmpop empty", input: []Value{makeCommand("LMPOP", "1", "list:mpop3", "LEFT")}, expected: "*-1\r\n"},
+		{name: "lmpop zero count", input: []Value{makeCommand("LMPOP", "1", "list:mpop3", "LEFT", "COUNT", "0")}, expected: "-ERR count should be greater than 0\r\n"},
+		{
+			name:     "lpush on a string",
+			input:    []Value{makeCommand("SET", "list:wrong", "v"), makeCommand("LPUSH", "list:wrong", "a")},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCommands(t, tt.input...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestListPropagation(t *testing.T) {
+	logged := propagated(t,
+		makeCommand("RPUSH", "list:aof", "a", "b", "c"),
+		makeCommand("LMPOP", "1", "list:aof", "LEFT", "COUNT", "2"),
+		makeCommand("LPOP", "list:aof:missing"),
+		makeCommand("LREM", "list:aof", "0", "x"),
+	)
+
+	expected := []Value{
+		makeCommand("RPUSH", "list:aof", "a", "b", "c"),
+		makeCommand("LPOP", "list:aof", "2"),
+	}
+	assertPropagated(t, logged, expected)
+}
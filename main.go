@@ -1,59 +1,165 @@
 package main
 
 import (
+	"bufio"
+	"errors"
+	"flag"
 	"io"
 	"log"
 	"net"
+	"os"
+	"slices"
 	"strings"
+	"time"
 )
 
 func readLoop(conn net.Conn, aof *Aof) {
 	defer conn.Close()
 
 	cmdHandler := NewCommandHandler()
+	cmdHandler.aof = aof
+	reader := NewRespReader(conn)
+	writer := NewRespWriter(conn)
+	defer writer.Flush()
 
 	for {
-		reader := NewRespReader(conn)
+		// Replies are only sent once every pipelined request that already
+		// arrived has been served, so a pipeline costs a single write.
+		if reader.Buffered() == 0 {
+			if err := writer.Flush(); err != nil {
+				log.Println("error writing to client:", err)
+				return
+			}
+		}
+
 		request, err := reader.Read()
 		if err != nil {
 			if err == io.EOF {
 				return
 			}
+			var protoErr *ProtocolError
+			if errors.As(err, &protoErr) {
+				writer.Write(protoErr.Value())
+			}
 			log.Println("error reading from client:", err)
 			return
 		}
 
 		if request.typ != "array" {
-			log.Println("Invalid request, expected array")
-			continue
+			protoErr := &ProtocolError{message: "expected '*', got '" + string(request.Serialize()[0]) + "'"}
+			writer.Write(protoErr.Value())
+			log.Println("error reading from client:", protoErr)
+			return
+		}
+
+		// The RESP3 types may only be used in replies: a request holds bulk
+		// strings only.
+		if i := slices.IndexFunc(request.array, func(v Value) bool { return v.typ != "bulk" }); i >= 0 {
+			protoErr := &ProtocolError{message: "expected '$', got '" + string(request.array[i].Serialize()[0]) + "'"}
+			writer.Write(protoErr.Value())
+			log.Println("error reading from client:", protoErr)
+			return
 		}
 
 		if len(request.array) == 0 {
-			log.Println("Invalid request, array length must be greater than zero")
 			continue
 		}
 
-		command := strings.ToUpper(request.array[0].bulk)
+		command := request.array[0].bulk
 		args := request.array[1:]
 
-		writer := NewRespWriter(conn)
-
 		result, err := cmdHandler.Handle(command, args)
 		if err != nil {
-			log.Println(err)
-			writer.Write(Value{typ: "string", str: ""})
+			var respErr *RespError
+			if !errors.As(err, &respErr) {
+				respErr = NewErr("%s", err)
+			}
+			writer.Write(respErr.Value())
 			continue
 		}
 
-		if command == "SET" || command == "HSET" {
-			aof.Write(request)
+		// A blocked client doesn't read any further request until its
+		// command is served, but the replies before it are sent right away.
+		// The connection is still watched, as a client closing it must stop
+		// waiting for the keys.
+		if cmdHandler.Blocked() {
+			if err := writer.Flush(); err != nil {
+				cmdHandler.Unblock()
+				log.Println("error writing to client:", err)
+				return
+			}
+
+			closed, stopWatching := watchClose(conn, reader)
+			var served bool
+			result, served = cmdHandler.WaitUnblocked(closed)
+			stopWatching()
+			if !served {
+				return
+			}
 		}
 
+		writer.SetProtocol(cmdHandler.client.proto)
 		writer.Write(result)
 	}
 }
 
+// watchClose watches for the client closing conn while its command is
+// blocked, and closes the returned channel if it does. Requests pipelined in
+// the meantime are left buffered in reader. stop ends the watch, and has to
+// be called before reading from reader again.
+func watchClose(conn net.Conn, reader *RespReader) (closed <-chan struct{}, stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+
+		for {
+			err := reader.WaitForData()
+			switch {
+			case err == nil:
+				continue
+			case errors.Is(err, bufio.ErrBufferFull) || errors.Is(err, os.ErrDeadlineExceeded):
+			default:
+				close(done)
+			}
+			return
+		}
+	}()
+
+	return done, func() {
+		// The deadline interrupts the read the watch may be waiting on.
+		conn.SetReadDeadline(time.Now())
+		<-exited
+		conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// loadAof replays the commands logged in aof. The client replaying them is
+// the server itself, so it doesn't have to authenticate.
+func loadAof(aof *Aof) error {
+	cmdHandler := NewCommandHandler()
+	cmdHandler.client.authenticated = true
+
+	var handleErr error
+	err := aof.Read(func(value Value) {
+		if handleErr != nil {
+			return
+		}
+
+		command := strings.ToUpper(value.array[0].bulk)
+		_, handleErr = cmdHandler.Handle(command, value.array[1:])
+	})
+	if err != nil {
+		return err
+	}
+
+	return handleErr
+}
+
 func main() {
+	flag.StringVar(&requirePass, "requirepass", "", "password clients must authenticate with")
+	flag.Parse()
 
 	l, err := net.Listen("tcp", ":6379")
 	if err != nil {
@@ -67,16 +173,11 @@ func main() {
 
 	defer aof.Close()
 
-	aof.Read(func(value Value) {
-		command := strings.ToUpper(value.array[0].bulk)
-		args := value.array[1:]
-		cmdHandler := NewCommandHandler()
+	go keyspace.ActiveExpireCycle()
 
-		_, err := cmdHandler.Handle(command, args)
-		if err != nil {
-			log.Fatal(err)
-		}
-	})
+	if err := loadAof(aof); err != nil {
+		log.Fatal(err)
+	}
 
 	for {
 		conn, err := l.Accept()
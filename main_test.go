@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// dialTestServer serves a single connection with readLoop and returns the
+// client end of it.
+func dialTestServer(t *testing.T) net.Conn {
+	t.Helper()
+
+	aof, err := NewAof(filepath.Join(t.TempDir(), "test.aof"))
+	if err != nil {
+		t.Fatalf("failed to create aof: %v", err)
+	}
+	t.Cleanup(func() { aof.Close() })
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		readLoop(conn, aof)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestReadLoopPipeline(t *testing.T) {
+	conn := dialTestServer(t)
+
+	pipeline := "*1\r\n$4\r\nPING\r\n" +
+		"*3\r\n$3\r\nSET\r\n$13\r\npipeline:key1\r\n$5\r\nvalue\r\n" +
+		"GET pipeline:key1\r\n" +
+		"*2\r\n$4\r\nPING\r\n$4\r\nlast\r\n"
+	expected := "+PONG\r\n+OK\r\n$5\r\nvalue\r\n+last\r\n"
+
+	if _, err := conn.Write([]byte(pipeline)); err != nil {
+		t.Fatal(err)
+	}
+
+	result := make([]byte, len(expected))
+	if _, err := io.ReadFull(bufio.NewReader(conn), result); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(result) != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestReadLoopProtocolError(t *testing.T) {
+	conn := dialTestServer(t)
+
+	if _, err := conn.Write([]byte("*1\r\n$x\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "-ERR Protocol error: invalid bulk length\r\n"
+	if string(result) != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestReadLoopMultibulkElements(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "inline element", input: "*2\r\n$3\r\nGET\r\nkey\r\n", expected: "-ERR Protocol error: expected '$', got 'k'\r\n"},
+		{name: "integer element", input: "*2\r\n$3\r\nGET\r\n:1\r\n", expected: "-ERR Protocol error: expected '$', got ':'\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dialTestServer(t)
+
+			if _, err := conn.Write([]byte(tt.input)); err != nil {
+				t.Fatal(err)
+			}
+
+			// The connection is closed after the error.
+			result, err := io.ReadAll(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(result) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestReadLoopBlocking(t *testing.T) {
+	conn := dialTestServer(t)
+	reader := bufio.NewReader(conn)
+
+	if _, err := conn.Write([]byte("PING\r\nBLPOP readloop:block 0\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The reply to PING is sent before the connection gets parked.
+	pong := make([]byte, len("+PONG\r\n"))
+	if _, err := io.ReadFull(reader, pong); err != nil {
+		t.Fatal(err)
+	}
+
+	for blocked := false; !blocked; {
+		keyspace.mutex.Lock()
+		_, blocked = keyspace.blocking["readloop:block"]
+		keyspace.mutex.Unlock()
+	}
+	runCommands(t, makeCommand("RPUSH", "readloop:block", "a"))
+
+	expected := "*2\r\n$14\r\nreadloop:block\r\n$1\r\na\r\n"
+	result := make([]byte, len(expected))
+	if _, err := io.ReadFull(reader, result); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(result) != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestReadLoopBlockedClientDisconnects(t *testing.T) {
+	conn := dialTestServer(t)
+
+	if _, err := conn.Write([]byte("BLPOP readloop:gone 0\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	blocked := func() bool {
+		keyspace.mutex.Lock()
+		defer keyspace.mutex.Unlock()
+
+		_, ok := keyspace.blocking["readloop:gone"]
+		return ok
+	}
+	for !blocked() {
+	}
+	conn.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for blocked() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the closed connection to stop blocking")
+		}
+	}
+
+	result := runCommands(t, makeCommand("RPUSH", "readloop:gone", "a"), makeCommand("LRANGE", "readloop:gone", "0", "-1"))
+	if expected := "*1\r\n$1\r\na\r\n"; result != expected {
+		t.Errorf("expected the element to stay in the list, got %q", result)
+	}
+}
+
+func TestReadLoopBlockingPipeline(t *testing.T) {
+	conn := dialTestServer(t)
+	reader := bufio.NewReader(conn)
+
+	// The request after the blocking one arrives while the client is
+	// blocked, and is served once it is unblocked.
+	if _, err := conn.Write([]byte("BLPOP readloop:pipeline 0\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	for blocked := false; !blocked; {
+		keyspace.mutex.Lock()
+		_, blocked = keyspace.blocking["readloop:pipeline"]
+		keyspace.mutex.Unlock()
+	}
+	if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	runCommands(t, makeCommand("RPUSH", "readloop:pipeline", "a"))
+
+	expected := "*2\r\n$17\r\nreadloop:pipeline\r\n$1\r\na\r\n+PONG\r\n"
+	result := make([]byte, len(expected))
+	if _, err := io.ReadFull(reader, result); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(result) != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"slices"
+)
+
+// quicklistFill is the maximum number of entries a quicklist node holds.
+const quicklistFill = 128
+
+type quicklistNode struct {
+	prev    *quicklistNode
+	next    *quicklistNode
+	entries []string
+}
+
+// Quicklist is the value of a list key. Like the Redis quicklist it is a
+// doubly linked list of small chunks of entries, so pushing and popping at
+// both ends is O(1) however long the list is, while the chunks keep the
+// per-entry overhead of the links low. Indexes passed to its methods may be
+// negative, counting back from the tail.
+type Quicklist struct {
+	head  *quicklistNode
+	tail  *quicklistNode
+	count int
+}
+
+func NewQuicklist() *Quicklist {
+	return &Quicklist{}
+}
+
+func (ql *Quicklist) Len() int {
+	if ql == nil {
+		return 0
+	}
+
+	return ql.count
+}
+
+// Clone returns a copy of the list, chunked the same way.
+func (ql *Quicklist) Clone() *Quicklist {
+	clone := NewQuicklist()
+	for node := ql.head; node != nil; node = node.next {
+		clone.insertNodeAfter(clone.tail).entries = slices.Clone(node.entries)
+	}
+	clone.count = ql.count
+
+	return clone
+}
+
+func (ql *Quicklist) PushHead(val string) {
+	if ql.head == nil || len(ql.head.entries) >= quicklistFill {
+		ql.insertNodeAfter(nil)
+	}
+
+	ql.head.entries = slices.Insert(ql.head.entries, 0, val)
+	ql.count++
+}
+
+func (ql *Quicklist) PushTail(val string) {
+	if ql.tail == nil || len(ql.tail.entries) >= quicklistFill {
+		ql.insertNodeAfter(ql.tail)
+	}
+
+	ql.tail.entries = append(ql.tail.entries, val)
+	ql.count++
+}
+
+func (ql *Quicklist) PopHead() (string, bool) {
+	if ql.Len() == 0 {
+		return "", false
+	}
+
+	node := ql.head
+	val := node.entries[0]
+	node.entries[0] = ""
+	node.entries = node.entries[1:]
+	ql.count--
+
+	if len(node.entries) == 0 {
+		ql.unlinkNode(node)
+	}
+
+	return val, true
+}
+
+func (ql *Quicklist) PopTail() (string, bool) {
+	if ql.Len() == 0 {
+		return "", false
+	}
+
+	node := ql.tail
+	last := len(node.entries) - 1
+	val := node.entries[last]
+	node.entries = node.entries[:last]
+	ql.count--
+
+	if len(node.entries) == 0 {
+		ql.unlinkNode(node)
+	}
+
+	return val, true
+}
+
+// Index returns the entry at index, and false if the index is out of range.
+func (ql *Quicklist) Index(index int) (string, bool) {
+	node, offset, ok := ql.locate(index)
+	if !ok {
+		return "", false
+	}
+
+	return node.entries[offset], true
+}
+
+// Set replaces the entry at index and reports whether the index was in range.
+func (ql *Quicklist) Set(index int, val string) bool {
+	node, offset, ok := ql.locate(index)
+	if !ok {
+		return false
+	}
+
+	node.entries[offset] = val
+	return true
+}
+
+// Insert inserts val so that it ends up at index, which may be the length of
+// the list to append. A full node is split in two around the new entry.
+func (ql *Quicklist) Insert(index int, val string) {
+	switch {
+	case index == 0:
+		ql.PushHead(val)
+		return
+	case index == ql.count:
+		ql.PushTail(val)
+		return
+	}
+
+	node, offset, ok := ql.locate(index)
+	if !ok {
+		return
+	}
+
+	if len(node.entries) < quicklistFill {
+		node.entries = slices.Insert(node.entries, offset, val)
+	} else {
+		rest := slices.Clone(node.entries[offset:])
+		clear(node.entries[offset:])
+		node.entries = append(node.entries[:offset], val)
+		ql.insertNodeAfter(node).entries = rest
+	}
+	ql.count++
+}
+
+// DeleteRange deletes n entries starting at index.
+func (ql *Quicklist) DeleteRange(index int, n int) {
+	node, offset, ok := ql.locate(index)
+	for ok && node != nil && n > 0 {
+		deleted := min(n, len(node.entries)-offset)
+		node.entries = slices.Delete(node.entries, offset, offset+deleted)
+		ql.count -= deleted
+		n -= deleted
+
+		next := node.next
+		if len(node.entries) == 0 {
+			ql.unlinkNode(node)
+		}
+		node, offset = next, 0
+	}
+}
+
+// Remove deletes the entries equal to val and returns how many it deleted.
+// It deletes at most count entries starting from the head, or at most -count
+// starting from the tail when count is negative. Zero means all of them.
+func (ql *Quicklist) Remove(val string, count int) int {
+	reverse, limit := count < 0, count
+	if reverse {
+		limit = -count
+	}
+
+	removed := 0
+	node := ql.head
+	if reverse {
+		node = ql.tail
+	}
+
+	for node != nil && (limit == 0 || removed < limit) {
+		next := node.next
+		if reverse {
+			next = node.prev
+		}
+
+		entries := node.entries
+		if reverse {
+			for i := len(entries) - 1; i >= 0 && removed < limit; i-- {
+				if entries[i] == val {
+					entries = slices.Delete(entries, i, i+1)
+					removed++
+				}
+			}
+		} else {
+			for i := 0; i < len(entries) && (limit == 0 || removed < limit); {
+				if entries[i] == val {
+					entries = slices.Delete(entries, i, i+1)
+					removed++
+				} else {
+					i++
+				}
+			}
+		}
+
+		ql.count -= len(node.entries) - len(entries)
+		node.entries = entries
+		if len(entries) == 0 {
+			ql.unlinkNode(node)
+		}
+		node = next
+	}
+
+	return removed
+}
+
+// Iterator returns an iterator positioned at index, walking towards the tail,
+// or towards the head when reverse is set.
+func (ql *Quicklist) Iterator(index int, reverse bool) *QuicklistIterator {
+	node, offset, ok := ql.locate(index)
+	if !ok {
+		return &QuicklistIterator{}
+	}
+
+	return &QuicklistIterator{node: node, offset: offset, reverse: reverse}
+}
+
+type QuicklistIterator struct {
+	node    *quicklistNode
+	offset  int
+	reverse bool
+}
+
+func (it *QuicklistIterator) Next() (string, bool) {
+	if it.node == nil {
+		return "", false
+	}
+
+	val := it.node.entries[it.offset]
+	if it.reverse {
+		it.offset--
+		if it.offset < 0 {
+			it.node = it.node.prev
+			if it.node != nil {
+				it.offset = len(it.node.entries) - 1
+			}
+		}
+	} else {
+		it.offset++
+		if it.offset == len(it.node.entries) {
+			it.node, it.offset = it.node.next, 0
+		}
+	}
+
+	return val, true
+}
+
+// locate finds the node holding the entry at index, walking from whichever
+// end of the list is closer.
+func (ql *Quicklist) locate(index int) (*quicklistNode, int, bool) {
+	if index < 0 {
+		index += ql.Len()
+	}
+	if index < 0 || index >= ql.Len() {
+		return nil, 0, false
+	}
+
+	if index < ql.count/2 {
+		node := ql.head
+		for index >= len(node.entries) {
+			index -= len(node.entries)
+			node = node.next
+		}
+		return node, index, true
+	}
+
+	node, index := ql.tail, ql.count-1-index
+	for index >= len(node.entries) {
+		index -= len(node.entries)
+		node = node.prev
+	}
+	return node, len(node.entries) - 1 - index, true
+}
+
+// insertNodeAfter links a new empty node after node, or at the head when
+// node is nil.
+func (ql *Quicklist) insertNodeAfter(node *quicklistNode) *quicklistNode {
+	n := &quicklistNode{prev: node}
+	if node == nil {
+		n.next = ql.head
+		ql.head = n
+	} else {
+		n.next = node.next
+		node.next = n
+	}
+
+	if n.next == nil {
+		ql.tail = n
+	} else {
+		n.next.prev = n
+	}
+
+	return n
+}
+
+func (ql *Quicklist) unlinkNode(node *quicklistNode) {
+	if node.prev == nil {
+		ql.head = node.next
+	} else {
+		node.prev.next = node.next
+	}
+
+	if node.next == nil {
+		ql.tail = node.prev
+	} else {
+		node.next.prev = node.prev
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// TestQuicklistMatchesSlice runs random operations spanning many nodes on a
+// quicklist and a plain slice, and checks they always hold the same entries.
+func TestQuicklistMatchesSlice(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	ql := NewQuicklist()
+	var model []string
+
+	for i := 0; i < 20000; i++ {
+		val := strconv.Itoa(r.IntN(50))
+		switch op := r.IntN(8); {
+		case op < 2:
+			ql.PushHead(val)
+			model = slices.Insert(model, 0, val)
+		case op < 4:
+			ql.PushTail(val)
+			model = append(model, val)
+		case op == 4 && len(model) > 0:
+			got, _ := ql.PopHead()
+			if got != model[0] {
+				t.Fatalf("PopHead: expected %q, got %q", model[0], got)
+			}
+			model = model[1:]
+		case op == 5 && len(model) > 0:
+			got, _ := ql.PopTail()
+			if got != model[len(model)-1] {
+				t.Fatalf("PopTail: expected %q, got %q", model[len(model)-1], got)
+			}
+			model = model[:len(model)-1]
+		case op == 6:
+			index := r.IntN(len(model) + 1)
+			ql.Insert(index, val)
+			model = slices.Insert(model, index, val)
+		case op == 7 && len(model) > 0:
+			index := r.IntN(len(model))
+			n := r.IntN(len(model) - index + 1)
+			ql.DeleteRange(index, n)
+			model = slices.Delete(model, index, index+n)
+		}
+
+		if i%1000 == 0 {
+			count := r.IntN(5) - 2
+			before := len(model)
+			model = removeFromSlice(model, val, count)
+			if removed := ql.Remove(val, count); removed != before-len(model) {
+				t.Fatalf("Remove: expected %d removed, got %d", before-len(model), removed)
+			}
+			assertQuicklist(t, ql, model)
+		}
+	}
+
+	assertQuicklist(t, ql, model)
+}
+
+func TestQuicklistNegativeIndexes(t *testing.T) {
+	ql := NewQuicklist()
+	for i := 0; i < 300; i++ {
+		ql.PushTail(strconv.Itoa(i))
+	}
+
+	if val, ok := ql.Index(-1); !ok || val != "299" {
+		t.Errorf("expected 299 at -1, got %q", val)
+	}
+	if val, ok := ql.Index(-300); !ok || val != "0" {
+		t.Errorf("expected 0 at -300, got %q", val)
+	}
+	if _, ok := ql.Index(-301); ok {
+		t.Error("expected -301 to be out of range")
+	}
+	if _, ok := ql.Index(300); ok {
+		t.Error("expected 300 to be out of range")
+	}
+}
+
+func removeFromSlice(s []string, val string, count int) []string {
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+
+	removed := 0
+	if count < 0 {
+		for i := len(s) - 1; i >= 0 && removed < limit; i-- {
+			if s[i] == val {
+				s = slices.Delete(s, i, i+1)
+				removed++
+			}
+		}
+		return s
+	}
+
+	for i := 0; i < len(s) && (limit == 0 || removed < limit); {
+		if s[i] == val {
+			s = slices.Delete(s, i, i+1)
+			removed++
+		} else {
+			i++
+		}
+	}
+	return s
+}
+
+func assertQuicklist(t *testing.T, ql *Quicklist, model []string) {
+	t.Helper()
+
+	if ql.Len() != len(model) {
+		t.Fatalf("expected length %d, got %d", len(model), ql.Len())
+	}
+
+	var forward []string
+	for it := ql.Iterator(0, false); ; {
+		val, ok := it.Next()
+		if !ok {
+			break
+		}
+		forward = append(forward, val)
+	}
+	if !slices.Equal(forward, model) {
+		t.Fatalf("forward iteration differs from the model")
+	}
+
+	var backward []string
+	for it := ql.Iterator(-1, true); ; {
+		val, ok := it.Next()
+		if !ok {
+			break
+		}
+		backward = append(backward, val)
+	}
+	slices.Reverse(backward)
+	if !slices.Equal(backward, model) {
+		t.Fatalf("reverse iteration differs from the model")
+	}
+
+	for i, val := range model {
+		if got, _ := ql.Index(i); got != val {
+			t.Fatalf("expected %q at %d, got %q", val, i, got)
+		}
+	}
+}
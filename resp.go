@@ -3,28 +3,67 @@ package main
 import (
 	"bufio"
 	"io"
-	"log"
+	"math"
 	"strconv"
+	"strings"
+)
+
+const maxBulkLength = 512 * 1024 * 1024
+
+// maxInlineLength caps an inline request, which unlike a bulk string doesn't
+// announce its length, so a client can't make the server buffer a line that
+// never ends.
+const maxInlineLength = 64 * 1024
+
+var (
+	errUnbalancedQuotes = &ProtocolError{message: "unbalanced quotes in request"}
+	errInlineTooBig     = &ProtocolError{message: "too big inline request"}
+)
+
+const (
+	RESP2 = 2
+	RESP3 = 3
 )
 
 const (
-	STRING  = '+'
-	INTEGER = ':'
-	BULK    = '$'
-	ARRAY   = '*'
-	ERROR   = '-'
-	MAP     = '%'
+	STRING    = '+'
+	INTEGER   = ':'
+	BULK      = '$'
+	ARRAY     = '*'
+	ERROR     = '-'
+	MAP       = '%'
+	SET       = '~'
+	DOUBLE    = ','
+	BOOLEAN   = '#'
+	BIGNUMBER = '('
+	VERBATIM  = '='
+	NULL      = '_'
+	PUSH      = '>'
+	ATTRIBUTE = '|'
+	BLOBERROR = '!'
 )
 
+// Value is a single RESP frame. Maps and attributes keep their entries in
+// array as alternating key/value pairs, verbatim strings keep their three
+// letter format in str and the payload in bulk, and big numbers keep their
+// digits in str. A "nullarray" is the null RESP2 encodes as *-1.
 type Value struct {
-	typ   string
-	str   string
-	num   int
-	bulk  string
-	array []Value
+	typ     string
+	str     string
+	num     int
+	bulk    string
+	double  float64
+	boolean bool
+	array   []Value
 }
 
-func (v Value) serializeNull() []byte {
+func (v Value) serializeNull(proto int) []byte {
+	if proto == RESP3 {
+		return []byte("_\r\n")
+	}
+	if v.typ == "nullarray" {
+		return []byte("*-1\r\n")
+	}
 	return []byte("$-1\r\n")
 }
 
@@ -57,7 +96,7 @@ func (v Value) serializeInteger() []byte {
 	return bytes
 }
 
-func (v Value) serializeArray() []byte {
+func (v Value) serializeArray(proto int) []byte {
 	var bytes []byte
 	len := len(v.array)
 	bytes = append(bytes, ARRAY)
@@ -65,7 +104,7 @@ func (v Value) serializeArray() []byte {
 	bytes = append(bytes, '\r', '\n')
 
 	for i := 0; i < len; i++ {
-		bytes = append(bytes, v.array[i].Serialize()...)
+		bytes = append(bytes, v.array[i].serialize(proto)...)
 	}
 
 	return bytes
@@ -80,26 +119,148 @@ func (v Value) serializeError() []byte {
 	return bytes
 }
 
-func (v Value) serializeMap() []byte {
-	return []byte("%0\r\n") // not implemented
+func (v Value) serializeAggregate(prefix byte, length int, proto int) []byte {
+	var bytes []byte
+	bytes = append(bytes, prefix)
+	bytes = append(bytes, strconv.Itoa(length)...)
+	bytes = append(bytes, '\r', '\n')
+
+	for i := 0; i < len(v.array); i++ {
+		bytes = append(bytes, v.array[i].serialize(proto)...)
+	}
+
+	return bytes
+}
+
+func (v Value) serializeMap(proto int) []byte {
+	return v.serializeAggregate(MAP, len(v.array)/2, proto)
+}
+
+func (v Value) serializeSet(proto int) []byte {
+	return v.serializeAggregate(SET, len(v.array), proto)
+}
+
+func (v Value) serializePush(proto int) []byte {
+	return v.serializeAggregate(PUSH, len(v.array), proto)
+}
+
+func (v Value) serializeAttribute(proto int) []byte {
+	return v.serializeAggregate(ATTRIBUTE, len(v.array)/2, proto)
+}
+
+func formatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
 }
 
+func (v Value) serializeDouble() []byte {
+	var bytes []byte
+	bytes = append(bytes, DOUBLE)
+	bytes = append(bytes, formatDouble(v.double)...)
+	bytes = append(bytes, '\r', '\n')
+
+	return bytes
+}
+
+func (v Value) serializeBoolean() []byte {
+	if v.boolean {
+		return []byte("#t\r\n")
+	}
+	return []byte("#f\r\n")
+}
+
+func (v Value) serializeBigNumber() []byte {
+	bytes := make([]byte, 0, 1+len(v.str)+2)
+	bytes = append(bytes, BIGNUMBER)
+	bytes = append(bytes, v.str...)
+	bytes = append(bytes, '\r', '\n')
+
+	return bytes
+}
+
+func (v Value) serializeVerbatim() []byte {
+	var bytes []byte
+	bytes = append(bytes, VERBATIM)
+	bytes = append(bytes, strconv.Itoa(len(v.str)+1+len(v.bulk))...)
+	bytes = append(bytes, '\r', '\n')
+	bytes = append(bytes, v.str...)
+	bytes = append(bytes, ':')
+	bytes = append(bytes, v.bulk...)
+	bytes = append(bytes, '\r', '\n')
+
+	return bytes
+}
+
+// Serialize encodes v with its native wire type. Nulls keep the RESP2
+// encoding, which every peer understands.
 func (v Value) Serialize() []byte {
+	return v.serialize(0)
+}
+
+// SerializeProto encodes v for a connection that negotiated proto. RESP2
+// connections get RESP3-only types downgraded the same way Redis does it.
+func (v Value) SerializeProto(proto int) []byte {
+	return v.serialize(proto)
+}
+
+func (v Value) serialize(proto int) []byte {
+	if proto == RESP2 {
+		switch v.typ {
+		case "map", "set", "push":
+			return v.serializeArray(proto)
+		case "double":
+			return MakeBulkValue(formatDouble(v.double)).serializeBulk()
+		case "boolean":
+			if v.boolean {
+				return MakeIntValue(1).serializeInteger()
+			}
+			return MakeIntValue(0).serializeInteger()
+		case "bignumber":
+			return MakeBulkValue(v.str).serializeBulk()
+		case "verbatim":
+			return v.serializeBulk()
+		case "attribute":
+			return []byte{}
+		}
+	}
+
 	switch v.typ {
 	case "bulk":
 		return v.serializeBulk()
 	case "array":
-		return v.serializeArray()
+		return v.serializeArray(proto)
 	case "integer":
 		return v.serializeInteger()
 	case "string":
 		return v.serializeString()
-	case "null":
-		return v.serializeNull()
+	case "null", "nullarray":
+		return v.serializeNull(proto)
 	case "error":
 		return v.serializeError()
 	case "map":
-		return v.serializeMap()
+		return v.serializeMap(proto)
+	case "set":
+		return v.serializeSet(proto)
+	case "double":
+		return v.serializeDouble()
+	case "boolean":
+		return v.serializeBoolean()
+	case "bignumber":
+		return v.serializeBigNumber()
+	case "verbatim":
+		return v.serializeVerbatim()
+	case "push":
+		return v.serializePush(proto)
+	case "attribute":
+		return v.serializeAttribute(proto)
 	default:
 		return []byte{}
 	}
@@ -115,18 +276,41 @@ func NewRespReader(conn io.Reader) *RespReader {
 	}
 }
 
+// Buffered returns the number of bytes that were already received but not
+// yet parsed, i.e. how much of a pipeline is still waiting to be served.
+func (r *RespReader) Buffered() int {
+	return r.reader.Buffered()
+}
+
+// WaitForData waits for more bytes than the buffered ones, without parsing
+// them. It fails with bufio.ErrBufferFull once there is no room left for
+// them, and with the read error if the connection fails first.
+func (r *RespReader) WaitForData() error {
+	_, err := r.reader.Peek(r.reader.Buffered() + 1)
+	return err
+}
+
+// RespWriter buffers replies so a whole pipeline can be answered with a
+// single write. Callers must Flush once they run out of requests to serve.
 type RespWriter struct {
-	writer io.Writer
+	writer *bufio.Writer
+	proto  int
 }
 
 func NewRespWriter(conn io.Writer) *RespWriter {
 	return &RespWriter{
-		writer: conn,
+		writer: bufio.NewWriter(conn),
+		proto:  RESP2,
 	}
 }
 
+// SetProtocol selects the protocol version used to encode replies.
+func (w *RespWriter) SetProtocol(proto int) {
+	w.proto = proto
+}
+
 func (w *RespWriter) Write(v Value) error {
-	bytes := v.Serialize()
+	bytes := v.SerializeProto(w.proto)
 
 	_, err := w.writer.Write(bytes)
 	if err != nil {
@@ -136,6 +320,10 @@ func (w *RespWriter) Write(v Value) error {
 	return nil
 }
 
+func (w *RespWriter) Flush() error {
+	return w.writer.Flush()
+}
+
 func (r *RespReader) readLine() (line []byte, err error) {
 	for {
 		b, err := r.reader.ReadByte()
@@ -159,7 +347,7 @@ func (r *RespReader) readInteger() (Value, error) {
 
 	i64, err := strconv.ParseInt(string(line), 10, 64)
 	if err != nil {
-		return Value{}, err
+		return Value{}, &ProtocolError{message: "invalid integer"}
 	}
 
 	v.num = int(i64)
@@ -167,45 +355,67 @@ func (r *RespReader) readInteger() (Value, error) {
 	return v, nil
 }
 
-func (r *RespReader) readBulk() (Value, error) {
-	v := Value{}
-	v.typ = "bulk"
-
+func (r *RespReader) readLength(what string) (int, error) {
 	line, err := r.readLine()
 	if err != nil {
-		return Value{}, err
+		return 0, err
 	}
 
 	len, err := strconv.ParseInt(string(line), 10, 64)
+	if err != nil || len > maxBulkLength {
+		return 0, &ProtocolError{message: "invalid " + what + " length"}
+	}
+
+	return int(len), nil
+}
+
+func (r *RespReader) readBlob() ([]byte, bool, error) {
+	len, err := r.readLength("bulk")
 	if err != nil {
-		return Value{}, err
+		return nil, false, err
 	}
 
-	bulk := make([]byte, len)
-	io.ReadFull(r.reader, bulk)
+	if len < 0 {
+		return nil, false, nil
+	}
 
-	v.bulk = string(bulk)
+	blob := make([]byte, len)
+	if _, err := io.ReadFull(r.reader, blob); err != nil {
+		return nil, false, err
+	}
 
 	_, err = r.readLine() // flush the input buffer
+	if err != nil {
+		return nil, false, err
+	}
+
+	return blob, true, nil
+}
+
+func (r *RespReader) readBulk() (Value, error) {
+	bulk, ok, err := r.readBlob()
 	if err != nil {
 		return Value{}, err
 	}
 
-	return v, nil
+	if !ok {
+		return MakeNilValue(), nil
+	}
+
+	return Value{typ: "bulk", bulk: string(bulk)}, nil
 }
 
 func (r *RespReader) readArray() (Value, error) {
 	v := Value{}
 	v.typ = "array"
 
-	line, err := r.readLine()
+	len, err := r.readLength("multibulk")
 	if err != nil {
 		return Value{}, err
 	}
 
-	len, err := strconv.ParseInt(string(line), 10, 64)
-	if err != nil {
-		return Value{}, err
+	if len < 0 {
+		return MakeNilValue(), nil
 	}
 
 	if len == 0 {
@@ -213,8 +423,8 @@ func (r *RespReader) readArray() (Value, error) {
 	}
 
 	v.array = make([]Value, len)
-	for i := 0; i < int(len); i++ {
-		elem, err := r.Read()
+	for i := 0; i < len; i++ {
+		elem, err := r.readValue(false)
 		if err != nil {
 			return Value{}, err
 		}
@@ -224,7 +434,126 @@ func (r *RespReader) readArray() (Value, error) {
 	return v, nil
 }
 
+// readAggregate reads a map, set, push or attribute frame. Maps and
+// attributes announce the number of pairs, so twice as many elements follow.
+func (r *RespReader) readAggregate(typ string, pairs bool) (Value, error) {
+	len, err := r.readLength(typ)
+	if err != nil {
+		return Value{}, err
+	}
+
+	if pairs {
+		len *= 2
+	}
+
+	v := Value{typ: typ, array: make([]Value, 0, max(len, 0))}
+	for i := 0; i < len; i++ {
+		elem, err := r.readValue(false)
+		if err != nil {
+			return Value{}, err
+		}
+		v.array = append(v.array, elem)
+	}
+
+	return v, nil
+}
+
+func (r *RespReader) readString() (Value, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+
+	return Value{typ: "string", str: string(line)}, nil
+}
+
+func (r *RespReader) readError() (Value, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+
+	return Value{typ: "error", str: string(line)}, nil
+}
+
+func (r *RespReader) readBlobError() (Value, error) {
+	blob, _, err := r.readBlob()
+	if err != nil {
+		return Value{}, err
+	}
+
+	return Value{typ: "error", str: string(blob)}, nil
+}
+
+func (r *RespReader) readNull() (Value, error) {
+	if _, err := r.readLine(); err != nil {
+		return Value{}, err
+	}
+
+	return MakeNilValue(), nil
+}
+
+func (r *RespReader) readDouble() (Value, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+
+	f, err := strconv.ParseFloat(string(line), 64)
+	if err != nil {
+		return Value{}, &ProtocolError{message: "invalid double"}
+	}
+
+	return Value{typ: "double", double: f}, nil
+}
+
+func (r *RespReader) readBoolean() (Value, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+
+	switch string(line) {
+	case "t":
+		return Value{typ: "boolean", boolean: true}, nil
+	case "f":
+		return Value{typ: "boolean", boolean: false}, nil
+	default:
+		return Value{}, &ProtocolError{message: "invalid boolean"}
+	}
+}
+
+func (r *RespReader) readBigNumber() (Value, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+
+	return Value{typ: "bignumber", str: string(line)}, nil
+}
+
+func (r *RespReader) readVerbatim() (Value, error) {
+	blob, _, err := r.readBlob()
+	if err != nil {
+		return Value{}, err
+	}
+
+	if len(blob) < 4 || blob[3] != ':' {
+		return Value{}, &ProtocolError{message: "invalid verbatim string"}
+	}
+
+	return Value{typ: "verbatim", str: string(blob[:3]), bulk: string(blob[4:])}, nil
+}
+
+// Read reads the next value. A line that doesn't start with a type byte is
+// an inline command.
 func (r *RespReader) Read() (Value, error) {
+	return r.readValue(true)
+}
+
+// readValue reads the next value. Inline commands are only read at the top
+// level: inside an aggregate, a missing type byte is a protocol error.
+func (r *RespReader) readValue(inline bool) (Value, error) {
 	t, err := r.reader.ReadByte()
 	if err != nil {
 		return Value{}, err
@@ -237,8 +566,183 @@ func (r *RespReader) Read() (Value, error) {
 		return r.readBulk()
 	case ARRAY:
 		return r.readArray()
+	case STRING:
+		return r.readString()
+	case ERROR:
+		return r.readError()
+	case BLOBERROR:
+		return r.readBlobError()
+	case NULL:
+		return r.readNull()
+	case DOUBLE:
+		return r.readDouble()
+	case BOOLEAN:
+		return r.readBoolean()
+	case BIGNUMBER:
+		return r.readBigNumber()
+	case VERBATIM:
+		return r.readVerbatim()
+	case MAP:
+		return r.readAggregate("map", true)
+	case SET:
+		return r.readAggregate("set", false)
+	case PUSH:
+		return r.readAggregate("push", false)
+	case ATTRIBUTE:
+		return r.readAggregate("attribute", true)
 	default:
-		log.Printf("Error: unknown type %v", string(t))
-		return Value{}, nil
+		if !inline {
+			return Value{}, &ProtocolError{message: "expected '$', got '" + string(t) + "'"}
+		}
+		if err := r.reader.UnreadByte(); err != nil {
+			return Value{}, err
+		}
+		return r.readInline()
+	}
+}
+
+// readInline reads a command typed by hand, e.g. through telnet or netcat.
+// Blank lines are skipped, as they carry no command.
+func (r *RespReader) readInline() (Value, error) {
+	for {
+		line, err := r.readInlineLine()
+		if err != nil {
+			return Value{}, err
+		}
+
+		args, err := splitArgs(strings.TrimSuffix(line[:len(line)-1], "\r"))
+		if err != nil {
+			return Value{}, err
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		v := Value{typ: "array", array: make([]Value, 0, len(args))}
+		for _, arg := range args {
+			v.array = append(v.array, MakeBulkValue(arg))
+		}
+
+		return v, nil
+	}
+}
+
+// readInlineLine reads up to and including the next newline, failing once
+// the line grows past maxInlineLength.
+func (r *RespReader) readInlineLine() (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.reader.ReadSlice('\n')
+		if len(line)+len(chunk) > maxInlineLength {
+			return "", errInlineTooBig
+		}
+		line = append(line, chunk...)
+
+		if err != bufio.ErrBufferFull {
+			return string(line), err
+		}
+	}
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f'
+}
+
+func isHexDigit(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
+
+// splitArgs tokenizes an inline command the way redis-cli does. Tokens are
+// separated by whitespace, double quoted tokens understand \n, \r, \t, \b,
+// \a and \xHH escapes, and single quoted tokens only understand \'.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+
+		var token []byte
+		inDouble, inSingle := false, false
+		done := false
+
+		for !done {
+			if inDouble {
+				if i == len(line) {
+					return nil, errUnbalancedQuotes
+				}
+				switch {
+				case line[i] == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]):
+					b, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+					token = append(token, byte(b))
+					i += 3
+				case line[i] == '\\' && i+1 < len(line):
+					i++
+					switch line[i] {
+					case 'n':
+						token = append(token, '\n')
+					case 'r':
+						token = append(token, '\r')
+					case 't':
+						token = append(token, '\t')
+					case 'b':
+						token = append(token, '\b')
+					case 'a':
+						token = append(token, '\a')
+					default:
+						token = append(token, line[i])
+					}
+				case line[i] == '"':
+					// the closing quote must be followed by a space or nothing
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				default:
+					token = append(token, line[i])
+				}
+			} else if inSingle {
+				if i == len(line) {
+					return nil, errUnbalancedQuotes
+				}
+				switch {
+				case line[i] == '\\' && i+1 < len(line) && line[i+1] == '\'':
+					token = append(token, '\'')
+					i++
+				case line[i] == '\'':
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				default:
+					token = append(token, line[i])
+				}
+			} else {
+				if i == len(line) {
+					break
+				}
+				switch line[i] {
+				case ' ', '\t', '\n', '\r', '\v', '\f':
+					done = true
+				case '"':
+					inDouble = true
+				case '\'':
+					inSingle = true
+				default:
+					token = append(token, line[i])
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+
+		args = append(args, string(token))
 	}
 }
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"math"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -306,3 +309,175 @@ func TestRespWriteError(t *testing.T) {
 		t.Errorf("expected %s, got %s", expected, result)
 	}
 }
+
+func TestRespResp3RoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    Value
+		expected string
+	}{
+		{
+			name:     "map",
+			input:    MakeMapValue(MakeBulkValue("first"), MakeIntValue(1), MakeBulkValue("second"), MakeIntValue(2)),
+			expected: "%2\r\n$5\r\nfirst\r\n:1\r\n$6\r\nsecond\r\n:2\r\n",
+		},
+		{
+			name:     "set",
+			input:    MakeSetValue(MakeBulkValue("a"), MakeBulkValue("b")),
+			expected: "~2\r\n$1\r\na\r\n$1\r\nb\r\n",
+		},
+		{name: "double", input: MakeDoubleValue(1.23), expected: ",1.23\r\n"},
+		{name: "positive infinity", input: MakeDoubleValue(math.Inf(1)), expected: ",inf\r\n"},
+		{name: "negative infinity", input: MakeDoubleValue(math.Inf(-1)), expected: ",-inf\r\n"},
+		{name: "true", input: MakeBooleanValue(true), expected: "#t\r\n"},
+		{name: "false", input: MakeBooleanValue(false), expected: "#f\r\n"},
+		{
+			name:     "big number",
+			input:    MakeBigNumberValue("3492890328409238509324850943850943825024385"),
+			expected: "(3492890328409238509324850943850943825024385\r\n",
+		},
+		{name: "verbatim", input: MakeVerbatimValue("txt", "Some string"), expected: "=15\r\ntxt:Some string\r\n"},
+		{name: "null", input: MakeNilValue(), expected: "$-1\r\n"},
+		{
+			name:     "push",
+			input:    MakePushValue(MakeBulkValue("message"), MakeBulkValue("channel")),
+			expected: ">2\r\n$7\r\nmessage\r\n$7\r\nchannel\r\n",
+		},
+		{
+			name:     "attribute",
+			input:    Value{typ: "attribute", array: []Value{MakeBulkValue("ttl"), MakeIntValue(3600)}},
+			expected: "|1\r\n$3\r\nttl\r\n:3600\r\n",
+		},
+		{name: "error", input: MakeErrorValue("ERR something"), expected: "-ERR something\r\n"},
+		{name: "simple string", input: MakeStringValue("OK"), expected: "+OK\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := string(tt.input.Serialize())
+			if result != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, result)
+			}
+
+			output, err := RespReaderFromString(result).Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(output, tt.input) {
+				t.Errorf("expected %+v, got %+v", tt.input, output)
+			}
+		})
+	}
+}
+
+func TestRespReadNull(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "resp3 null", input: "_\r\n"},
+		{name: "null bulk", input: "$-1\r\n"},
+		{name: "null array", input: "*-1\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := RespReaderFromString(tt.input).Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if output.typ != "null" {
+				t.Errorf("expected null, got %s", output.typ)
+			}
+		})
+	}
+}
+
+func TestRespReadBlobError(t *testing.T) {
+	output, err := RespReaderFromString("!21\r\nSYNTAX invalid syntax\r\n").Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output.typ != "error" || output.str != "SYNTAX invalid syntax" {
+		t.Errorf("expected SYNTAX invalid syntax error, got %+v", output)
+	}
+}
+
+func TestRespSerializeResp2(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    Value
+		expected string
+	}{
+		{
+			name:     "map flattens to array",
+			input:    MakeMapValue(MakeBulkValue("key"), MakeIntValue(1)),
+			expected: "*2\r\n$3\r\nkey\r\n:1\r\n",
+		},
+		{name: "set becomes array", input: MakeSetValue(MakeBulkValue("a")), expected: "*1\r\n$1\r\na\r\n"},
+		{name: "double becomes bulk", input: MakeDoubleValue(1.5), expected: "$3\r\n1.5\r\n"},
+		{name: "boolean becomes integer", input: MakeBooleanValue(true), expected: ":1\r\n"},
+		{name: "verbatim becomes bulk", input: MakeVerbatimValue("txt", "hi"), expected: "$2\r\nhi\r\n"},
+		{name: "null stays null bulk", input: MakeNilValue(), expected: "$-1\r\n"},
+		{name: "null array stays null array", input: MakeNilArrayValue(), expected: "*-1\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := string(tt.input.SerializeProto(RESP2))
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestRespReadInline(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{name: "single token", input: "PING\r\n", expected: []string{"PING"}},
+		{name: "newline only terminator", input: "PING\n", expected: []string{"PING"}},
+		{name: "extra whitespace", input: "  SET   key \t value  \r\n", expected: []string{"SET", "key", "value"}},
+		{name: "skips blank lines", input: "\r\n\r\nGET key\r\n", expected: []string{"GET", "key"}},
+		{name: "double quotes", input: "SET key \"hello world\"\r\n", expected: []string{"SET", "key", "hello world"}},
+		{name: "escapes", input: "SET key \"a\\tb\\n\\x41\\\"\"\r\n", expected: []string{"SET", "key", "a\tb\nA\""}},
+		{name: "single quotes", input: "SET key 'it\\'s \\n'\r\n", expected: []string{"SET", "key", "it's \\n"}},
+		{name: "empty quoted string", input: "SET key \"\"\r\n", expected: []string{"SET", "key", ""}},
+		{name: "longer than the read buffer", input: "SET key " + strings.Repeat("v", 10000) + "\r\n", expected: []string{"SET", "key", strings.Repeat("v", 10000)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := RespReaderFromString(tt.input).Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if output.typ != "array" || len(output.array) != len(tt.expected) {
+				t.Fatalf("expected %d element array, got %+v", len(tt.expected), output)
+			}
+
+			for i, arg := range tt.expected {
+				if output.array[i].typ != "bulk" || output.array[i].bulk != arg {
+					t.Errorf("expected %q at index %d, got %+v", arg, i, output.array[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRespReadInlineUnbalancedQuotes(t *testing.T) {
+	inputs := []string{"SET key \"value\r\n", "SET key 'value\r\n", "SET key \"value\"x\r\n"}
+
+	for _, input := range inputs {
+		if _, err := RespReaderFromString(input).Read(); err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+}
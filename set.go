@@ -0,0 +1,911 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func registerSetCommands(commands map[string]Command) {
+	commands["SADD"] = Command{
+		details: Details{
+			name:              "sadd",
+			arity:             -3,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@set", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: sadd,
+	}
+
+	commands["SREM"] = Command{
+		details: Details{
+			name:              "srem",
+			arity:             -3,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@set", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: srem,
+	}
+
+	commands["SMEMBERS"] = Command{
+		details: Details{
+			name:              "smembers",
+			arity:             2,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@set", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: smembers,
+	}
+
+	commands["SISMEMBER"] = Command{
+		details: Details{
+			name:              "sismember",
+			arity:             3,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@set", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: sismember,
+	}
+
+	commands["SMISMEMBER"] = Command{
+		details: Details{
+			name:              "smismember",
+			arity:             -3,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@set", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: smismember,
+	}
+
+	commands["SCARD"] = Command{
+		details: Details{
+			name:              "scard",
+			arity:             2,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@set", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: scard,
+	}
+
+	commands["SPOP"] = Command{
+		details: Details{
+			name:              "spop",
+			arity:             -2,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@set", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: spop,
+	}
+
+	commands["SRANDMEMBER"] = Command{
+		details: Details{
+			name:              "srandmember",
+			arity:             -2,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@set", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: srandmember,
+	}
+
+	commands["SMOVE"] = Command{
+		details: Details{
+			name:              "smove",
+			arity:             4,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           2,
+			step:              1,
+			aclCategories:     []string{"@write", "@set", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: smove,
+	}
+
+	commands["SINTER"] = Command{
+		details: Details{
+			name:              "sinter",
+			arity:             -2,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           -1,
+			step:              1,
+			aclCategories:     []string{"@read", "@set", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: sinter,
+	}
+
+	commands["SINTERCARD"] = Command{
+		details: Details{
+			name:              "sintercard",
+			arity:             -3,
+			flags:             []string{"readonly", "movablekeys"},
+			firstKey:          0,
+			lastKey:           0,
+			step:              0,
+			aclCategories:     []string{"@read", "@set", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: sintercard,
+	}
+
+	commands["SINTERSTORE"] = Command{
+		details: Details{
+			name:              "sinterstore",
+			arity:             -3,
+			flags:             []string{"write", "denyoom"},
+			firstKey:          1,
+			lastKey:           -1,
+			step:              1,
+			aclCategories:     []string{"@write", "@set", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: sinterstore,
+	}
+
+	commands["SUNION"] = Command{
+		details: Details{
+			name:              "sunion",
+			arity:             -2,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           -1,
+			step:              1,
+			aclCategories:     []string{"@read", "@set", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: sunion,
+	}
+
+	commands["SUNIONSTORE"] = Command{
+		details: Details{
+			name:              "sunionstore",
+			arity:             -3,
+			flags:             []string{"write", "denyoom"},
+			firstKey:          1,
+			lastKey:           -1,
+			step:              1,
+			aclCategories:     []string{"@write", "@set", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: sunionstore,
+	}
+
+	commands["SDIFF"] = Command{
+		details: Details{
+			name:              "sdiff",
+			arity:             -2,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           -1,
+			step:              1,
+			aclCategories:     []string{"@read", "@set", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: sdiff,
+	}
+
+	commands["SDIFFSTORE"] = Command{
+		details: Details{
+			name:              "sdiffstore",
+			arity:             -3,
+			flags:             []string{"write", "denyoom"},
+			firstKey:          1,
+			lastKey:           -1,
+			step:              1,
+			aclCategories:     []string{"@write", "@set", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: sdiffstore,
+	}
+
+	commands["SSCAN"] = Command{
+		details: Details{
+			name:              "sscan",
+			arity:             -3,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@set", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: sscan,
+	}
+}
+
+// setMaxIntsetEntries is the size past which a set of integers is converted
+// from the intset encoding to a hash set, as set-max-intset-entries.
+const setMaxIntsetEntries = 512
+
+const (
+	EncodingIntset    = "intset"
+	EncodingHashtable = "hashtable"
+)
+
+// Set is the value of a set key. Small sets of integers are stored as an
+// Intset, anything else in a hash set. The hash set keeps its members in a
+// slice too, indexed by the map, so picking a random member is O(1). Reading
+// from a nil *Set behaves like reading from an empty set.
+type Set struct {
+	intset  *Intset
+	index   *Dict[int]
+	members []string
+}
+
+func NewSet() *Set {
+	return &Set{intset: NewIntset()}
+}
+
+func (s *Set) Encoding() string {
+	if s.intset != nil {
+		return EncodingIntset
+	}
+	return EncodingHashtable
+}
+
+// Add inserts member and reports whether it is new. Adding a member that is
+// not an integer, or one too many, converts an intset to a hash set.
+func (s *Set) Add(member string) bool {
+	if s.intset != nil {
+		if n, ok := parseInteger(member); ok {
+			if !s.intset.Add(n) {
+				return false
+			}
+			if s.intset.Len() > setMaxIntsetEntries {
+				s.convertToHashtable()
+			}
+			return true
+		}
+		s.convertToHashtable()
+	}
+
+	if !s.index.Set(member, len(s.members)) {
+		return false
+	}
+
+	s.members = append(s.members, member)
+	return true
+}
+
+func (s *Set) Remove(member string) bool {
+	if s.intset != nil {
+		n, ok := parseInteger(member)
+		return ok && s.intset.Remove(n)
+	}
+
+	i, ok := s.index.Get(member)
+	if !ok {
+		return false
+	}
+
+	// The last member takes the place of the removed one.
+	last := len(s.members) - 1
+	s.members[i] = s.members[last]
+	s.index.Set(s.members[i], i)
+	s.members = s.members[:last]
+	s.index.Delete(member)
+	return true
+}
+
+func (s *Set) Contains(member string) bool {
+	if s == nil {
+		return false
+	}
+
+	if s.intset != nil {
+		n, ok := parseInteger(member)
+		return ok && s.intset.Contains(n)
+	}
+
+	_, ok := s.index.Get(member)
+	return ok
+}
+
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+
+	if s.intset != nil {
+		return s.intset.Len()
+	}
+	return len(s.members)
+}
+
+// Clone returns a copy of the set, in the same encoding.
+func (s *Set) Clone() *Set {
+	if s.intset != nil {
+		return &Set{intset: s.intset.Clone()}
+	}
+
+	return &Set{index: s.index.Clone(), members: slices.Clone(s.members)}
+}
+
+// Random returns a random member of a non empty set.
+func (s *Set) Random() string {
+	return s.member(rand.IntN(s.Len()))
+}
+
+// Members returns every member of the set, in no particular order.
+func (s *Set) Members() []string {
+	members := make([]string, s.Len())
+	for i := range members {
+		members[i] = s.member(i)
+	}
+
+	return members
+}
+
+func (s *Set) member(i int) string {
+	if s.intset != nil {
+		return strconv.FormatInt(s.intset.Get(i), 10)
+	}
+	return s.members[i]
+}
+
+func (s *Set) convertToHashtable() {
+	members := s.Members()
+
+	s.intset = nil
+	s.members = members
+	s.index = NewDict[int]()
+	for i, member := range members {
+		s.index.Set(member, i)
+	}
+}
+
+// lookupSet returns the set stored at key, or nil if there is none. The
+// error is set when the key holds another type.
+func lookupSet(key string) (*Set, *RespError) {
+	obj := keyspace.Lookup(key)
+	if obj == nil {
+		return nil, nil
+	}
+	if obj.typ != TypeSet {
+		return nil, ErrWrongType
+	}
+
+	return obj.value.(*Set), nil
+}
+
+// lookupSetForWrite is lookupSet, except that a missing set is created.
+func lookupSetForWrite(key string) (*Set, *RespError) {
+	set, err := lookupSet(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if set == nil {
+		set = NewSet()
+		keyspace.Set(key, &Object{typ: TypeSet, value: set})
+	}
+
+	return set, nil
+}
+
+func deleteIfEmptySet(key string, set *Set) {
+	if set.Len() == 0 {
+		keyspace.Delete(key)
+	}
+}
+
+func bulkValues(members []string) []Value {
+	values := make([]Value, len(members))
+	for i, member := range members {
+		values[i] = MakeBulkValue(member)
+	}
+
+	return values
+}
+
+func sadd(c *Client, args []Value) Value {
+	set, err := lookupSetForWrite(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	added := 0
+	for _, arg := range args[1:] {
+		if set.Add(arg.bulk) {
+			added++
+		}
+	}
+	if added > 0 {
+		keyspace.dirty++
+	}
+
+	return MakeIntValue(added)
+}
+
+func srem(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	set, err := lookupSet(key)
+	if err != nil {
+		return err.Value()
+	}
+	if set == nil {
+		return MakeIntValue(0)
+	}
+
+	removed := 0
+	for _, arg := range args[1:] {
+		if set.Remove(arg.bulk) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		deleteIfEmptySet(key, set)
+		keyspace.dirty++
+	}
+
+	return MakeIntValue(removed)
+}
+
+func smembers(c *Client, args []Value) Value {
+	set, err := lookupSet(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	return MakeSetValue(bulkValues(set.Members())...)
+}
+
+func sismember(c *Client, args []Value) Value {
+	set, err := lookupSet(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	if set.Contains(args[1].bulk) {
+		return MakeIntValue(1)
+	}
+	return MakeIntValue(0)
+}
+
+func smismember(c *Client, args []Value) Value {
+	set, err := lookupSet(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	result := make([]Value, len(args)-1)
+	for i, arg := range args[1:] {
+		if set.Contains(arg.bulk) {
+			result[i] = MakeIntValue(1)
+		} else {
+			result[i] = MakeIntValue(0)
+		}
+	}
+
+	return Value{typ: "array", array: result}
+}
+
+func scard(c *Client, args []Value) Value {
+	set, err := lookupSet(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	return MakeIntValue(set.Len())
+}
+
+// spop removes random members. It is propagated as the SREM of the members
+// it actually removed, so the AOF replays to the same set.
+func spop(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	if len(args) > 2 {
+		return ErrSyntax.Value()
+	}
+
+	count, hasCount := 1, len(args) == 2
+	if hasCount {
+		var err *RespError
+		if count, err = parsePositiveCount(args[1].bulk); err != nil {
+			return err.Value()
+		}
+	}
+
+	set, err := lookupSet(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	if set == nil || count == 0 {
+		if hasCount {
+			return MakeSetValue()
+		}
+		return MakeNilValue()
+	}
+
+	popped := make([]string, 0, min(count, set.Len()))
+	for len(popped) < count && set.Len() > 0 {
+		member := set.Random()
+		set.Remove(member)
+		popped = append(popped, member)
+	}
+	deleteIfEmptySet(key, set)
+	keyspace.dirty++
+	c.rewriteCommand(append([]string{"SREM", key}, popped...)...)
+
+	if !hasCount {
+		return MakeBulkValue(popped[0])
+	}
+	return MakeSetValue(bulkValues(popped)...)
+}
+
+// srandmember follows Redis: a positive count returns distinct members, at
+// most as many as the set has, while a negative count may return the same
+// member several times and always returns exactly -count members.
+func srandmember(c *Client, args []Value) Value {
+	if len(args) > 2 {
+		return ErrSyntax.Value()
+	}
+
+	set, err := lookupSet(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	if len(args) == 1 {
+		if set.Len() == 0 {
+			return MakeNilValue()
+		}
+		return MakeBulkValue(set.Random())
+	}
+
+	count, ok := parseInteger(args[1].bulk)
+	if !ok {
+		return ErrNotInteger.Value()
+	}
+	if count < -math.MaxInt64/2 {
+		return NewErr("value is out of range").Value()
+	}
+
+	var picked []string
+	switch {
+	case count == 0 || set.Len() == 0:
+	case count < 0:
+		picked = make([]string, 0, min(-count, randomPickPrealloc))
+		for range -count {
+			picked = append(picked, set.Random())
+		}
+	default:
+		members := set.Members()
+		rand.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+		picked = members[:min(int(count), len(members))]
+	}
+
+	return Value{typ: "array", array: bulkValues(picked)}
+}
+
+// smove moves member between two sets. Moving it to the set it is already in
+// succeeds without changing anything.
+func smove(c *Client, args []Value) Value {
+	src, dst, member := args[0].bulk, args[1].bulk, args[2].bulk
+
+	srcSet, err := lookupSet(src)
+	if err != nil {
+		return err.Value()
+	}
+	if _, err := lookupSet(dst); err != nil {
+		return err.Value()
+	}
+
+	if !srcSet.Contains(member) {
+		return MakeIntValue(0)
+	}
+	if src == dst {
+		return MakeIntValue(1)
+	}
+
+	srcSet.Remove(member)
+	deleteIfEmptySet(src, srcSet)
+
+	dstSet, _ := lookupSetForWrite(dst)
+	dstSet.Add(member)
+	keyspace.dirty++
+
+	return MakeIntValue(1)
+}
+
+// Set algebra operations, as SET_OP_UNION, SET_OP_DIFF and SET_OP_INTER.
+const (
+	setOpUnion = iota
+	setOpDiff
+	setOpInter
+)
+
+// lookupSets returns the sets stored at keys, with nil for missing keys,
+// which act as empty sets. Any key of another type is an error.
+func lookupSets(keys []Value) ([]*Set, *RespError) {
+	sets := make([]*Set, len(keys))
+	for i, key := range keys {
+		set, err := lookupSet(key.bulk)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+
+	return sets, nil
+}
+
+// setIntersection iterates the smallest set and checks its members
+// against the others, from the smallest up, so a member is discarded as
+// early as possible. It stops once limit members are found, unless limit is
+// zero. fn is called with every member of the intersection.
+func setIntersection(sets []*Set, limit int, fn func(member string)) int {
+	sets = slices.Clone(sets)
+	slices.SortFunc(sets, func(a, b *Set) int { return a.Len() - b.Len() })
+	if sets[0].Len() == 0 {
+		return 0
+	}
+
+	// The members are read one at a time rather than copied up front, so
+	// reaching limit early leaves the rest of the set untouched.
+	found := 0
+	for i := range sets[0].Len() {
+		member := sets[0].member(i)
+		if !allContain(sets[1:], member) {
+			continue
+		}
+
+		fn(member)
+		found++
+		if found == limit {
+			break
+		}
+	}
+
+	return found
+}
+
+func allContain(sets []*Set, member string) bool {
+	for _, set := range sets {
+		if !set.Contains(member) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setOperation computes the union, difference or intersection of sets into
+// a new set. The difference is the members of the first set found in none
+// of the others.
+func setOperation(sets []*Set, op int) *Set {
+	result := NewSet()
+
+	switch op {
+	case setOpInter:
+		setIntersection(sets, 0, func(member string) { result.Add(member) })
+	case setOpUnion:
+		for _, set := range sets {
+			for _, member := range set.Members() {
+				result.Add(member)
+			}
+		}
+	case setOpDiff:
+		for _, member := range sets[0].Members() {
+			contained := false
+			for _, other := range sets[1:] {
+				if other.Contains(member) {
+					contained = true
+					break
+				}
+			}
+			if !contained {
+				result.Add(member)
+			}
+		}
+	}
+
+	return result
+}
+
+func setOperationGeneric(c *Client, args []Value, op int) Value {
+	sets, err := lookupSets(args)
+	if err != nil {
+		return err.Value()
+	}
+
+	return MakeSetValue(bulkValues(setOperation(sets, op).Members())...)
+}
+
+// setOperationStoreGeneric stores the result of the operation at the
+// destination, replacing whatever it held. An empty result deletes it.
+func setOperationStoreGeneric(c *Client, args []Value, op int) Value {
+	dst := args[0].bulk
+
+	sets, err := lookupSets(args[1:])
+	if err != nil {
+		return err.Value()
+	}
+
+	result := setOperation(sets, op)
+	if result.Len() == 0 {
+		if keyspace.Delete(dst) {
+			keyspace.dirty++
+		}
+		return MakeIntValue(0)
+	}
+
+	keyspace.Set(dst, &Object{typ: TypeSet, value: result})
+	keyspace.dirty++
+
+	return MakeIntValue(result.Len())
+}
+
+func sinter(c *Client, args []Value) Value {
+	return setOperationGeneric(c, args, setOpInter)
+}
+
+func sinterstore(c *Client, args []Value) Value {
+	return setOperationStoreGeneric(c, args, setOpInter)
+}
+
+func sunion(c *Client, args []Value) Value {
+	return setOperationGeneric(c, args, setOpUnion)
+}
+
+func sunionstore(c *Client, args []Value) Value {
+	return setOperationStoreGeneric(c, args, setOpUnion)
+}
+
+func sdiff(c *Client, args []Value) Value {
+	return setOperationGeneric(c, args, setOpDiff)
+}
+
+func sdiffstore(c *Client, args []Value) Value {
+	return setOperationStoreGeneric(c, args, setOpDiff)
+}
+
+// sintercard returns the cardinality of the intersection without building
+// it, stopping as soon as LIMIT members are found.
+func sintercard(c *Client, args []Value) Value {
+	numKeys, ok := parseInteger(args[0].bulk)
+	if !ok {
+		return ErrNotInteger.Value()
+	}
+	if numKeys <= 0 {
+		return NewErr("numkeys should be greater than 0").Value()
+	}
+	if numKeys > int64(len(args)-1) {
+		return NewErr("Number of keys can't be greater than number of args").Value()
+	}
+
+	limit := int64(0)
+	for i := int(numKeys) + 1; i < len(args); i += 2 {
+		if !strings.EqualFold(args[i].bulk, "LIMIT") || i+1 >= len(args) {
+			return ErrSyntax.Value()
+		}
+
+		n, ok := parseInteger(args[i+1].bulk)
+		if !ok {
+			return ErrNotInteger.Value()
+		}
+		if n < 0 {
+			return NewErr("LIMIT can't be negative").Value()
+		}
+		limit = n
+	}
+
+	sets, err := lookupSets(args[1 : numKeys+1])
+	if err != nil {
+		return err.Value()
+	}
+
+	return MakeIntValue(setIntersection(sets, int(limit), func(string) {}))
+}
+
+// sscan scans a hash set with a cursor, while an intset, being small, is
+// returned whole at once.
+func sscan(c *Client, args []Value) Value {
+	cursor, err := parseScanCursor(args[1].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	opts, err := parseScanOptions(args[2:], "sscan")
+	if err != nil {
+		return err.Value()
+	}
+
+	set, err := lookupSet(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	elements := []Value{}
+	if set == nil {
+		return scanReply(0, elements)
+	}
+
+	if set.intset != nil {
+		for _, member := range set.Members() {
+			if opts.match(member) {
+				elements = append(elements, MakeBulkValue(member))
+			}
+		}
+		return scanReply(0, elements)
+	}
+
+	cursor = scanDict(set.index, cursor, opts.count, func(member string, _ int) {
+		if opts.match(member) {
+			elements = append(elements, MakeBulkValue(member))
+		}
+	})
+
+	return scanReply(cursor, elements)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestSetCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{name: "sadd counts new members", input: []Value{makeCommand("SADD", "set:add", "a", "b", "a")}, expected: ":2\r\n"},
+		{
+			name:     "smembers of an intset is sorted",
+			input:    []Value{makeCommand("SADD", "set:ints", "3", "1", "2"), makeCommand("SMEMBERS", "set:ints")},
+			expected: "*3\r\n$1\r\n1\r\n$1\r\n2\r\n$1\r\n3\r\n",
+		},
+		{name: "smembers missing key", input: []Value{makeCommand("SMEMBERS", "set:missing")}, expected: "*0\r\n"},
+		{
+			name:     "srem",
+			input:    []Value{makeCommand("SADD", "set:rem", "a", "b", "c"), makeCommand("SREM", "set:rem", "a", "x", "c")},
+			expected: ":2\r\n",
+		},
+		{
+			name:     "srem last member deletes key",
+			input:    []Value{makeCommand("SADD", "set:rem2", "1"), makeCommand("SREM", "set:rem2", "1"), makeCommand("TYPE", "set:rem2")},
+			expected: "+none\r\n",
+		},
+		{
+			name:     "sismember",
+			input:    []Value{makeCommand("SADD", "set:is", "a"), makeCommand("SISMEMBER", "set:is", "a")},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "sismember does not match integers loosely",
+			input:    []Value{makeCommand("SADD", "set:is2", "1"), makeCommand("SISMEMBER", "set:is2", "01")},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "smismember",
+			input:    []Value{makeCommand("SADD", "set:mis", "a", "1"), makeCommand("SMISMEMBER", "set:mis", "a", "b", "1")},
+			expected: "*3\r\n:1\r\n:0\r\n:1\r\n",
+		},
+		{
+			name:     "scard",
+			input:    []Value{makeCommand("SADD", "set:card", "a", "b"), makeCommand("SCARD", "set:card")},
+			expected: ":2\r\n",
+		},
+		{
+			name:     "spop with count larger than the set",
+			input:    []Value{makeCommand("SADD", "set:pop", "1", "2"), makeCommand("SPOP", "set:pop", "5"), makeCommand("TYPE", "set:pop")},
+			expected: "+none\r\n",
+		},
+		{name: "spop missing key", input: []Value{makeCommand("SPOP", "set:pop2")}, expected: "$-1\r\n"},
+		{name: "spop missing key with count", input: []Value{makeCommand("SPOP", "set:pop2", "3")}, expected: "*0\r\n"},
+		{name: "spop negative count", input: []Value{makeCommand("SPOP", "set:pop2", "-1")}, expected: "-ERR value is out of range, must be positive\r\n"},
+		{
+			name:     "srandmember negative count repeats",
+			input:    []Value{makeCommand("SADD", "set:rand", "a"), makeCommand("SRANDMEMBER", "set:rand", "-3")},
+			expected: "*3\r\n$1\r\na\r\n$1\r\na\r\n$1\r\na\r\n",
+		},
+		{
+			name:     "srandmember positive count is capped",
+			input:    []Value{makeCommand("SADD", "set:rand2", "a"), makeCommand("SRANDMEMBER", "set:rand2", "3")},
+			expected: "*1\r\n$1\r\na\r\n",
+		},
+		{name: "srandmember missing key", input: []Value{makeCommand("SRANDMEMBER", "set:rand3")}, expected: "$-1\r\n"},
+		{
+			name:     "srandmember count out of range",
+			input:    []Value{makeCommand("SADD", "set:rand4", "a"), makeCommand("SRANDMEMBER", "set:rand4", "-9223372036854775807")},
+			expected: "-ERR value is out of range\r\n",
+		},
+		{
+			name:     "srandmember smallest count",
+			input:    []Value{makeCommand("SADD", "set:rand5", "a"), makeCommand("SRANDMEMBER", "set:rand5", "-9223372036854775808")},
+			expected: "-ERR value is out of range\r\n",
+		},
+		{
+			name:     "smove",
+			input:    []Value{makeCommand("SADD", "set:src", "a", "b"), makeCommand("SMOVE", "set:src", "set:dst", "a"), makeCommand("SMEMBERS", "set:dst")},
+			expected: "*1\r\n$1\r\na\r\n",
+		},
+		{
+			name:     "smove missing member",
+			input:    []Value{makeCommand("SADD", "set:src2", "a"), makeCommand("SMOVE", "set:src2", "set:dst2", "x")},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "smove to wrong type",
+			input:    []Value{makeCommand("SADD", "set:src3", "a"), makeCommand("SET", "set:str", "v"), makeCommand("SMOVE", "set:src3", "set:str", "a")},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+		{
+			name:     "sadd on a list",
+			input:    []Value{makeCommand("RPUSH", "set:list", "a"), makeCommand("SADD", "set:list", "a")},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCommands(t, tt.input...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestSetEncoding(t *testing.T) {
+	set := NewSet()
+	for i := 0; i < setMaxIntsetEntries; i++ {
+		set.Add(strconv.Itoa(i))
+	}
+	if set.Encoding() != EncodingIntset {
+		t.Fatalf("expected %s, got %s", EncodingIntset, set.Encoding())
+	}
+
+	set.Add(strconv.Itoa(setMaxIntsetEntries))
+	if set.Encoding() != EncodingHashtable {
+		t.Fatalf("expected %s past %d entries, got %s", EncodingHashtable, setMaxIntsetEntries, set.Encoding())
+	}
+
+	set = NewSet()
+	set.Add("1")
+	set.Add("a")
+	if set.Encoding() != EncodingHashtable || !set.Contains("1") || !set.Contains("a") || set.Len() != 2 {
+		t.Fatalf("expected a hashtable with both members, got %s with %v", set.Encoding(), set.Members())
+	}
+
+	set.Remove("1")
+	if set.Contains("1") || !set.Contains("a") || set.Len() != 1 {
+		t.Fatalf("expected only a to be left, got %v", set.Members())
+	}
+}
+
+func TestSetRandmemberDistinct(t *testing.T) {
+	runCommands(t, makeCommand("SADD", "set:distinct", "a", "b", "c", "d", "e"))
+
+	cmdHandler := NewCommandHandler()
+	for i := 0; i < 20; i++ {
+		val, err := cmdHandler.Handle("SRANDMEMBER", makeCommand("set:distinct", "4").array)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		seen := map[string]bool{}
+		for _, member := range val.array {
+			if seen[member.bulk] {
+				t.Fatalf("expected distinct members, got %q twice", member.bulk)
+			}
+			seen[member.bulk] = true
+		}
+		if len(seen) != 4 {
+			t.Fatalf("expected 4 members, got %d", len(seen))
+		}
+	}
+}
+
+func TestSetPopPropagation(t *testing.T) {
+	logged := propagated(t,
+		makeCommand("SADD", "set:aof", "a"),
+		makeCommand("SPOP", "set:aof"),
+		makeCommand("SPOP", "set:aof:missing"),
+	)
+
+	expected := []Value{
+		makeCommand("SADD", "set:aof", "a"),
+		makeCommand("SREM", "set:aof", "a"),
+	}
+	assertPropagated(t, logged, expected)
+}
+
+func TestSetAlgebra(t *testing.T) {
+	setup := []Value{
+		makeCommand("SADD", "algebra:a", "1", "2", "3", "4"),
+		makeCommand("SADD", "algebra:b", "2", "3", "5"),
+		makeCommand("SADD", "algebra:c", "3", "x"),
+		makeCommand("SET", "algebra:str", "v"),
+	}
+
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{name: "sinter", input: []Value{makeCommand("SINTER", "algebra:a", "algebra:b")}, expected: "*2\r\n$1\r\n2\r\n$1\r\n3\r\n"},
+		{name: "sinter three sets", input: []Value{makeCommand("SINTER", "algebra:a", "algebra:b", "algebra:c")}, expected: "*1\r\n$1\r\n3\r\n"},
+		{name: "sinter with missing key", input: []Value{makeCommand("SINTER", "algebra:a", "algebra:missing")}, expected: "*0\r\n"},
+		{
+			name:     "sinter wrong type after missing key",
+			input:    []Value{makeCommand("SINTER", "algebra:missing", "algebra:str")},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+		{
+			name:     "sunion",
+			input:    []Value{makeCommand("SUNION", "algebra:a", "algebra:b", "algebra:missing")},
+			expected: "*5\r\n$1\r\n1\r\n$1\r\n2\r\n$1\r\n3\r\n$1\r\n4\r\n$1\r\n5\r\n",
+		},
+		{name: "sdiff", input: []Value{makeCommand("SDIFF", "algebra:a", "algebra:b", "algebra:c")}, expected: "*2\r\n$1\r\n1\r\n$1\r\n4\r\n"},
+		{name: "sdiff missing first key", input: []Value{makeCommand("SDIFF", "algebra:missing", "algebra:a")}, expected: "*0\r\n"},
+		{
+			name:     "sinterstore replaces the destination",
+			input:    []Value{makeCommand("SET", "algebra:dst", "v"), makeCommand("SINTERSTORE", "algebra:dst", "algebra:a", "algebra:b"), makeCommand("SMEMBERS", "algebra:dst")},
+			expected: "*2\r\n$1\r\n2\r\n$1\r\n3\r\n",
+		},
+		{
+			name:     "sunionstore counts members",
+			input:    []Value{makeCommand("SUNIONSTORE", "algebra:dst2", "algebra:b", "algebra:c")},
+			expected: ":4\r\n",
+		},
+		{
+			name:     "sdiffstore empty result deletes the destination",
+			input:    []Value{makeCommand("SADD", "algebra:dst3", "a"), makeCommand("SDIFFSTORE", "algebra:dst3", "algebra:b", "algebra:a", "algebra:b"), makeCommand("TYPE", "algebra:dst3")},
+			expected: "+none\r\n",
+		},
+		{name: "sintercard", input: []Value{makeCommand("SINTERCARD", "2", "algebra:a", "algebra:b")}, expected: ":2\r\n"},
+		{name: "sintercard limit", input: []Value{makeCommand("SINTERCARD", "2", "algebra:a", "algebra:b", "LIMIT", "1")}, expected: ":1\r\n"},
+		{name: "sintercard zero numkeys", input: []Value{makeCommand("SINTERCARD", "0", "algebra:a")}, expected: "-ERR numkeys should be greater than 0\r\n"},
+		{
+			name:     "sintercard too many numkeys",
+			input:    []Value{makeCommand("SINTERCARD", "3", "algebra:a", "algebra:b")},
+			expected: "-ERR Number of keys can't be greater than number of args\r\n",
+		},
+		{
+			name:     "sintercard negative limit",
+			input:    []Value{makeCommand("SINTERCARD", "1", "algebra:a", "LIMIT", "-1")},
+			expected: "-ERR LIMIT can't be negative\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCommands(t, append(setup, tt.input...)...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestSetScan(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{
+			name:     "intset is returned at once",
+			input:    []Value{makeCommand("SADD", "set:scan:ints", "3", "1", "2"), makeCommand("SSCAN", "set:scan:ints", "0", "COUNT", "1")},
+			expected: "*2\r\n$1\r\n0\r\n*3\r\n$1\r\n1\r\n$1\r\n2\r\n$1\r\n3\r\n",
+		},
+		{
+			name:     "match",
+			input:    []Value{makeCommand("SADD", "set:scan:match", "apple", "banana"), makeCommand("SSCAN", "set:scan:match", "0", "MATCH", "b*")},
+			expected: "*2\r\n$1\r\n0\r\n*1\r\n$6\r\nbanana\r\n",
+		},
+		{name: "missing key", input: []Value{makeCommand("SSCAN", "set:scan:missing", "0")}, expected: "*2\r\n$1\r\n0\r\n*0\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := runCommands(t, tt.input...); result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+
+	input := makeCommand("SADD", "set:scan")
+	for i := 0; i < 200; i++ {
+		input.array = append(input.array, MakeBulkValue("m"+strconv.Itoa(i)))
+	}
+	runCommands(t, input)
+
+	members := scanAll(t, []string{"SSCAN", "set:scan"})
+	slices.Sort(members)
+	if members = slices.Compact(members); len(members) != 200 {
+		t.Errorf("expected the 200 members, got %d", len(members))
+	}
+}
+
+func TestSetIntersectionLimit(t *testing.T) {
+	a, b := NewSet(), NewSet()
+	for i := 0; i < 1000; i++ {
+		a.Add("m" + strconv.Itoa(i))
+		b.Add("m" + strconv.Itoa(i))
+	}
+
+	calls := 0
+	if found := setIntersection([]*Set{a, b}, 3, func(string) { calls++ }); found != 3 || calls != 3 {
+		t.Errorf("expected the intersection to stop at 3 members, found %d with %d calls", found, calls)
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"strings"
+)
+
+const (
+	zskiplistMaxLevel = 32
+	zskiplistP        = 0.25
+)
+
+type zskiplistLevel struct {
+	forward *zskiplistNode
+
+	// span is the number of nodes the forward link skips, which is what
+	// makes rank queries O(log N).
+	span int
+}
+
+type zskiplistNode struct {
+	member   string
+	score    float64
+	backward *zskiplistNode
+	level    []zskiplistLevel
+}
+
+// zskiplist orders the members of a sorted set by score, then by member. It
+// is the Redis skiplist: nodes have a random number of levels, and every
+// link knows how many nodes it spans.
+type zskiplist struct {
+	header *zskiplistNode
+	tail   *zskiplistNode
+	length int
+	level  int
+}
+
+func newZskiplist() *zskiplist {
+	return &zskiplist{
+		header: &zskiplistNode{level: make([]zskiplistLevel, zskiplistMaxLevel)},
+		level:  1,
+	}
+}
+
+// zslRandomLevel returns a level between 1 and zskiplistMaxLevel, with a
+// powerlaw-alike distribution where higher levels are less likely.
+func zslRandomLevel() int {
+	level := 1
+	for level < zskiplistMaxLevel && rand.Float64() < zskiplistP {
+		level++
+	}
+
+	return level
+}
+
+// zslLess reports whether the (score, member) pair sorts before the node.
+func zslLess(node *zskiplistNode, score float64, member string) bool {
+	return node.score < score || (node.score == score && node.member < member)
+}
+
+// insert adds a new node. The member must not be in the skiplist already.
+func (zsl *zskiplist) insert(score float64, member string) *zskiplistNode {
+	var update [zskiplistMaxLevel]*zskiplistNode
+	var rank [zskiplistMaxLevel]int
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		if i < zsl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && zslLess(x.level[i].forward, score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := zslRandomLevel()
+	if level > zsl.level {
+		for i := zsl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = zsl.header
+			update[i].level[i].span = zsl.length
+		}
+		zsl.level = level
+	}
+
+	x = &zskiplistNode{member: member, score: score, level: make([]zskiplistLevel, level)}
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+
+	// The levels above the new node now span it too.
+	for i := level; i < zsl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != zsl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+	zsl.length++
+
+	return x
+}
+
+func (zsl *zskiplist) deleteNode(x *zskiplistNode, update []*zskiplistNode) {
+	for i := 0; i < zsl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+
+	for zsl.level > 1 && zsl.header.level[zsl.level-1].forward == nil {
+		zsl.level--
+	}
+	zsl.length--
+}
+
+// delete removes the node with the given score and member, and reports
+// whether it was found.
+func (zsl *zskiplist) delete(score float64, member string) bool {
+	update := make([]*zskiplistNode, zskiplistMaxLevel)
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && zslLess(x.level[i].forward, score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+
+	zsl.deleteNode(x, update)
+	return true
+}
+
+// updateScore changes the score of a member. When the node stays in place
+// its score is updated directly, otherwise it is removed and reinserted.
+func (zsl *zskiplist) updateScore(score float64, member string, newScore float64) *zskiplistNode {
+	update := make([]*zskiplistNode, zskiplistMaxLevel)
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && zslLess(x.level[i].forward, score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	x = x.level[0].forward
+
+	if (x.backward == nil || x.backward.score < newScore) &&
+		(x.level[0].forward == nil || x.level[0].forward.score > newScore) {
+		x.score = newScore
+		return x
+	}
+
+	zsl.deleteNode(x, update)
+	return zsl.insert(newScore, member)
+}
+
+// rank returns the 1-based rank of the member with the given score, or 0 if
+// it isn't in the skiplist.
+func (zsl *zskiplist) rank(score float64, member string) int {
+	rank := 0
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(zslLess(x.level[i].forward, score, member) ||
+				(x.level[i].forward.score == score && x.level[i].forward.member == member)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+
+		if x != zsl.header && x.member == member {
+			return rank
+		}
+	}
+
+	return 0
+}
+
+// byRank returns the node at the 1-based rank, or nil if out of range.
+func (zsl *zskiplist) byRank(rank int) *zskiplistNode {
+	traversed := 0
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+
+		if traversed == rank {
+			return x
+		}
+	}
+
+	return nil
+}
+
+// zrangeSpec is a range of a sorted set, either by score or, for members
+// that all have the same score, by member.
+type zrangeSpec interface {
+	// isEmpty reports whether no element can possibly be in the range.
+	isEmpty() bool
+	gteMin(x *zskiplistNode) bool
+	lteMax(x *zskiplistNode) bool
+}
+
+// firstInRange returns the first node in the range, or nil.
+func (zsl *zskiplist) firstInRange(r zrangeSpec) *zskiplistNode {
+	if !zsl.isInRange(r) {
+		return nil
+	}
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !r.gteMin(x.level[i].forward) {
+			x = x.level[i].forward
+		}
+	}
+
+	x = x.level[0].forward
+	if x == nil || !r.lteMax(x) {
+		return nil
+	}
+
+	return x
+}
+
+// lastInRange returns the last node in the range, or nil.
+func (zsl *zskiplist) lastInRange(r zrangeSpec) *zskiplistNode {
+	if !zsl.isInRange(r) {
+		return nil
+	}
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && r.lteMax(x.level[i].forward) {
+			x = x.level[i].forward
+		}
+	}
+
+	if x == zsl.header || !r.gteMin(x) {
+		return nil
+	}
+
+	return x
+}
+
+// isInRange reports whether part of the skiplist may fall in the range.
+func (zsl *zskiplist) isInRange(r zrangeSpec) bool {
+	if r.isEmpty() {
+		return false
+	}
+
+	if zsl.tail == nil || !r.gteMin(zsl.tail) {
+		return false
+	}
+
+	first := zsl.header.level[0].forward
+	return first != nil && r.lteMax(first)
+}
+
+// zrangespec is a score range, each bound optionally exclusive.
+type zrangespec struct {
+	min, max     float64
+	minex, maxex bool
+}
+
+func (r *zrangespec) isEmpty() bool {
+	return r.min > r.max || (r.min == r.max && (r.minex || r.maxex))
+}
+
+func (r *zrangespec) gteMin(x *zskiplistNode) bool {
+	if r.minex {
+		return x.score > r.min
+	}
+	return x.score >= r.min
+}
+
+func (r *zrangespec) lteMax(x *zskiplistNode) bool {
+	if r.maxex {
+		return x.score < r.max
+	}
+	return x.score <= r.max
+}
+
+// zlexBound is a bound of a lex range. inf is -1 for "-", which sorts before
+// every member, and 1 for "+", which sorts after every member.
+type zlexBound struct {
+	value     string
+	exclusive bool
+	inf       int
+}
+
+// compare compares a member with the bound.
+func (b zlexBound) compare(member string) int {
+	if b.inf != 0 {
+		return -b.inf
+	}
+	return strings.Compare(member, b.value)
+}
+
+// zlexrangespec is a range of members, compared byte by byte.
+type zlexrangespec struct {
+	min, max zlexBound
+}
+
+func (r *zlexrangespec) isEmpty() bool {
+	c := cmp.Compare(r.min.inf, r.max.inf)
+	if c == 0 && r.min.inf == 0 {
+		c = strings.Compare(r.min.value, r.max.value)
+	}
+
+	return c > 0 || (c == 0 && (r.min.exclusive || r.max.exclusive))
+}
+
+func (r *zlexrangespec) gteMin(x *zskiplistNode) bool {
+	c := r.min.compare(x.member)
+	if r.min.exclusive {
+		return c > 0
+	}
+	return c >= 0
+}
+
+func (r *zlexrangespec) lteMax(x *zskiplistNode) bool {
+	c := r.max.compare(x.member)
+	if r.max.exclusive {
+		return c < 0
+	}
+	return c <= 0
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+type zslEntry struct {
+	score  float64
+	member string
+}
+
+func compareZslEntries(a, b zslEntry) int {
+	if c := cmp.Compare(a.score, b.score); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.member, b.member)
+}
+
+// TestSkiplistMatchesModel checks the order, ranks and spans of a skiplist
+// against a sorted slice after random inserts, deletes and score updates.
+func TestSkiplistMatchesModel(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 4))
+	zsl := newZskiplist()
+	scores := map[string]float64{}
+
+	for i := 0; i < 5000; i++ {
+		member := strconv.Itoa(r.IntN(500))
+		score := float64(r.IntN(100))
+
+		current, exists := scores[member]
+		switch {
+		case !exists:
+			zsl.insert(score, member)
+			scores[member] = score
+		case r.IntN(2) == 0:
+			if !zsl.delete(current, member) {
+				t.Fatalf("expected %s to be deleted", member)
+			}
+			delete(scores, member)
+		default:
+			zsl.updateScore(current, member, score)
+			scores[member] = score
+		}
+	}
+
+	var model []zslEntry
+	for member, score := range scores {
+		model = append(model, zslEntry{score: score, member: member})
+	}
+	slices.SortFunc(model, compareZslEntries)
+
+	if zsl.length != len(model) {
+		t.Fatalf("expected length %d, got %d", len(model), zsl.length)
+	}
+
+	x := zsl.header.level[0].forward
+	for i, entry := range model {
+		if x == nil || x.member != entry.member || x.score != entry.score {
+			t.Fatalf("expected %v at %d, got %+v", entry, i, x)
+		}
+		if rank := zsl.rank(entry.score, entry.member); rank != i+1 {
+			t.Fatalf("expected rank %d for %v, got %d", i+1, entry, rank)
+		}
+		if node := zsl.byRank(i + 1); node != x {
+			t.Fatalf("expected byRank(%d) to be %v", i+1, entry)
+		}
+		x = x.level[0].forward
+	}
+
+	if len(model) > 0 && zsl.tail.member != model[len(model)-1].member {
+		t.Fatalf("expected tail %v, got %s", model[len(model)-1], zsl.tail.member)
+	}
+}
+
+func TestSkiplistScoreRange(t *testing.T) {
+	zsl := newZskiplist()
+	for i := 1; i <= 10; i++ {
+		zsl.insert(float64(i), strconv.Itoa(i))
+	}
+
+	tests := []struct {
+		name        string
+		r           *zrangespec
+		first, last string
+	}{
+		{name: "inclusive", r: &zrangespec{min: 2, max: 4}, first: "2", last: "4"},
+		{name: "exclusive", r: &zrangespec{min: 2, max: 4, minex: true, maxex: true}, first: "3", last: "3"},
+		{name: "outside", r: &zrangespec{min: 11, max: 20}},
+		{name: "empty exclusive", r: &zrangespec{min: 3, max: 3, minex: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, last := zsl.firstInRange(tt.r), zsl.lastInRange(tt.r)
+			if tt.first == "" {
+				if first != nil || last != nil {
+					t.Fatalf("expected an empty range, got %+v and %+v", first, last)
+				}
+				return
+			}
+
+			if first == nil || first.member != tt.first || last == nil || last.member != tt.last {
+				t.Errorf("expected %s..%s, got %+v..%+v", tt.first, tt.last, first, last)
+			}
+		})
+	}
+}
@@ -0,0 +1,1198 @@
+package main
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func registerStreamCommands(commands map[string]Command) {
+	commands["XADD"] = Command{
+		details: Details{
+			name:              "xadd",
+			arity:             -5,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@stream", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: xadd,
+	}
+
+	commands["XRANGE"] = Command{
+		details: Details{
+			name:              "xrange",
+			arity:             -4,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@stream", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: xrange,
+	}
+
+	commands["XREVRANGE"] = Command{
+		details: Details{
+			name:              "xrevrange",
+			arity:             -4,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@stream", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: xrevrange,
+	}
+
+	commands["XLEN"] = Command{
+		details: Details{
+			name:              "xlen",
+			arity:             2,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@stream", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: xlen,
+	}
+
+	commands["XDEL"] = Command{
+		details: Details{
+			name:              "xdel",
+			arity:             -3,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@stream", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: xdel,
+	}
+
+	commands["XTRIM"] = Command{
+		details: Details{
+			name:              "xtrim",
+			arity:             -4,
+			flags:             []string{"write"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@stream", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: xtrim,
+	}
+
+	commands["XREAD"] = Command{
+		details: Details{
+			name:              "xread",
+			arity:             -4,
+			flags:             []string{"readonly", "blocking", "movablekeys"},
+			firstKey:          0,
+			lastKey:           0,
+			step:              0,
+			aclCategories:     []string{"@read", "@stream", "@slow", "@blocking"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: xread,
+	}
+}
+
+// StreamID identifies a stream entry: the milliseconds time the entry was
+// added at, and a sequence number for the entries added within the same
+// millisecond.
+type StreamID struct {
+	ms  uint64
+	seq uint64
+}
+
+var maxStreamID = StreamID{ms: math.MaxUint64, seq: math.MaxUint64}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.ms, 10) + "-" + strconv.FormatUint(id.seq, 10)
+}
+
+func (id StreamID) Compare(other StreamID) int {
+	if c := cmp.Compare(id.ms, other.ms); c != 0 {
+		return c
+	}
+	return cmp.Compare(id.seq, other.seq)
+}
+
+// Incr returns the ID following id, and false if id is the last possible
+// one.
+func (id StreamID) Incr() (StreamID, bool) {
+	switch {
+	case id.seq < math.MaxUint64:
+		id.seq++
+	case id.ms < math.MaxUint64:
+		id.ms, id.seq = id.ms+1, 0
+	default:
+		return id, false
+	}
+
+	return id, true
+}
+
+// Decr returns the ID preceding id, and false if id is 0-0.
+func (id StreamID) Decr() (StreamID, bool) {
+	switch {
+	case id.seq > 0:
+		id.seq--
+	case id.ms > 0:
+		id.ms, id.seq = id.ms-1, math.MaxUint64
+	default:
+		return id, false
+	}
+
+	return id, true
+}
+
+// parseStreamID parses an ID of the form "ms-seq", or "ms" alone in which
+// case the sequence is missingSeq. Unless strict is set, "-" and "+" are the
+// smallest and greatest IDs.
+func parseStreamID(s string, missingSeq uint64, strict bool) (StreamID, bool) {
+	if len(s) > 127 {
+		return StreamID{}, false
+	}
+
+	if !strict {
+		switch s {
+		case "-":
+			return StreamID{}, true
+		case "+":
+			return maxStreamID, true
+		}
+	}
+
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, false
+	}
+
+	seq := missingSeq
+	if hasSeq {
+		if seq, err = strconv.ParseUint(seqPart, 10, 64); err != nil {
+			return StreamID{}, false
+		}
+	}
+
+	return StreamID{ms: ms, seq: seq}, true
+}
+
+// streamNodeMaxEntries is the maximum number of entries a stream node holds.
+const streamNodeMaxEntries = 100
+
+type streamEntry struct {
+	id StreamID
+
+	// fields holds the field value pairs of the entry, flattened.
+	fields []string
+
+	deleted bool
+}
+
+// streamNode is a block of consecutive entries. Deleting an entry only marks
+// it as deleted, and the node goes away with its last live entry.
+type streamNode struct {
+	entries []streamEntry
+	live    int
+}
+
+// Stream is the value of a stream key. Like the Redis radix tree of
+// listpacks, it keeps the entries in blocks ordered by ID, so appending is
+// O(1) while finding an ID takes two binary searches, one over the blocks
+// and one within the block. A stream, unlike the other aggregates, stays
+// around when it becomes empty.
+type Stream struct {
+	nodes  []*streamNode
+	length int
+
+	// lastID is the ID of the last entry ever added, which new IDs must be
+	// greater than, even if that entry was deleted since.
+	lastID StreamID
+
+	maxDeletedID StreamID
+	entriesAdded uint64
+
+	// groups holds the consumer groups of the stream, nil until the first
+	// one is created.
+	groups map[string]*streamCG
+}
+
+func NewStream() *Stream {
+	return &Stream{}
+}
+
+func (s *Stream) Len() int {
+	if s == nil {
+		return 0
+	}
+
+	return s.length
+}
+
+// Clone returns a copy of the stream, consumer groups included.
+func (s *Stream) Clone() *Stream {
+	clone := *s
+
+	clone.nodes = make([]*streamNode, len(s.nodes))
+	for i, n := range s.nodes {
+		entries := slices.Clone(n.entries)
+		for j := range entries {
+			entries[j].fields = slices.Clone(entries[j].fields)
+		}
+		clone.nodes[i] = &streamNode{entries: entries, live: n.live}
+	}
+
+	if s.groups != nil {
+		clone.groups = make(map[string]*streamCG, len(s.groups))
+		for name, cg := range s.groups {
+			clone.groups[name] = cg.clone()
+		}
+	}
+
+	return &clone
+}
+
+// nextID returns the ID of an entry added at now, which is the next ID after
+// the last one if the clock didn't move forward since.
+func (s *Stream) nextID(now uint64) (StreamID, bool) {
+	if now > s.lastID.ms {
+		return StreamID{ms: now}, true
+	}
+
+	return s.lastID.Incr()
+}
+
+// Append adds an entry at the end of the stream. id must be greater than
+// the last ID of the stream.
+func (s *Stream) Append(id StreamID, fields []string) {
+	var node *streamNode
+	if len(s.nodes) > 0 {
+		node = s.nodes[len(s.nodes)-1]
+	}
+	if node == nil || len(node.entries) >= streamNodeMaxEntries {
+		node = &streamNode{}
+		s.nodes = append(s.nodes, node)
+	}
+
+	node.entries = append(node.entries, streamEntry{id: id, fields: fields})
+	node.live++
+	s.length++
+	s.lastID = id
+	s.entriesAdded++
+}
+
+// seek returns the position of the first entry whose ID is greater than or
+// equal to id, or only greater when after is set. The position is past the
+// last node when there is no such entry.
+func (s *Stream) seek(id StreamID, after bool) (int, int) {
+	past := func(entry *streamEntry) bool {
+		c := entry.id.Compare(id)
+		return c > 0 || (c == 0 && !after)
+	}
+
+	n := sort.Search(len(s.nodes), func(i int) bool {
+		entries := s.nodes[i].entries
+		return past(&entries[len(entries)-1])
+	})
+	if n == len(s.nodes) {
+		return n, 0
+	}
+
+	entries := s.nodes[n].entries
+	return n, sort.Search(len(entries), func(i int) bool { return past(&entries[i]) })
+}
+
+// Get returns the entry with the given ID, and false if there is none.
+func (s *Stream) Get(id StreamID) (*streamEntry, bool) {
+	n, e := s.seek(id, false)
+	if n == len(s.nodes) {
+		return nil, false
+	}
+
+	entry := &s.nodes[n].entries[e]
+	if entry.id != id || entry.deleted {
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// Delete removes the entry with the given ID and reports whether it existed.
+func (s *Stream) Delete(id StreamID) bool {
+	n, e := s.seek(id, false)
+	if n == len(s.nodes) {
+		return false
+	}
+
+	node := s.nodes[n]
+	entry := &node.entries[e]
+	if entry.id != id || entry.deleted {
+		return false
+	}
+
+	s.deleteEntry(n, entry)
+	if id.Compare(s.maxDeletedID) > 0 {
+		s.maxDeletedID = id
+	}
+
+	return true
+}
+
+// deleteEntry marks the entry, which belongs to the n-th node, as deleted,
+// and removes the node when it was its last live entry.
+func (s *Stream) deleteEntry(n int, entry *streamEntry) {
+	entry.deleted = true
+	entry.fields = nil
+	s.length--
+
+	node := s.nodes[n]
+	node.live--
+	if node.live == 0 {
+		s.nodes = slices.Delete(s.nodes, n, n+1)
+	}
+}
+
+// FirstID returns the ID of the first entry, and false if the stream is
+// empty.
+func (s *Stream) FirstID() (StreamID, bool) {
+	if s.Len() == 0 {
+		return StreamID{}, false
+	}
+
+	entry, _ := s.Iterator(StreamID{}, maxStreamID, false).Next()
+	return entry.id, true
+}
+
+// Range returns the entries with IDs between start and end, both included,
+// from the last one when reverse is set. A positive count limits how many
+// entries are returned.
+func (s *Stream) Range(start, end StreamID, reverse bool, count int) []streamEntry {
+	if s.Len() == 0 {
+		return nil
+	}
+
+	var entries []streamEntry
+	it := s.Iterator(start, end, reverse)
+	for entry, ok := it.Next(); ok; entry, ok = it.Next() {
+		entries = append(entries, *entry)
+		if len(entries) == count {
+			break
+		}
+	}
+
+	return entries
+}
+
+// Iterator returns an iterator over the entries with IDs between start and
+// end, both included, walking backwards when reverse is set. The stream must
+// not be modified while iterating.
+func (s *Stream) Iterator(start, end StreamID, reverse bool) *StreamIterator {
+	it := &StreamIterator{stream: s, start: start, end: end, reverse: reverse}
+	if !reverse {
+		it.node, it.entry = s.seek(start, false)
+		return it
+	}
+
+	it.node, it.entry = s.seek(end, true)
+	it.back()
+	return it
+}
+
+type StreamIterator struct {
+	stream      *Stream
+	node, entry int
+	start, end  StreamID
+	reverse     bool
+}
+
+func (it *StreamIterator) Next() (*streamEntry, bool) {
+	nodes := it.stream.nodes
+	for it.node >= 0 && it.node < len(nodes) {
+		entry := &nodes[it.node].entries[it.entry]
+		if it.reverse {
+			if entry.id.Compare(it.start) < 0 {
+				break
+			}
+			it.back()
+		} else {
+			if entry.id.Compare(it.end) > 0 {
+				break
+			}
+			it.entry++
+			if it.entry == len(nodes[it.node].entries) {
+				it.node, it.entry = it.node+1, 0
+			}
+		}
+
+		if !entry.deleted {
+			return entry, true
+		}
+	}
+
+	it.node = -1
+	return nil, false
+}
+
+func (it *StreamIterator) back() {
+	if it.entry > 0 {
+		it.entry--
+		return
+	}
+
+	it.node--
+	if it.node >= 0 {
+		it.entry = len(it.stream.nodes[it.node].entries) - 1
+	}
+}
+
+// Trimming strategies of XADD and XTRIM.
+const (
+	streamTrimNone = iota
+	streamTrimMaxLen
+	streamTrimMinID
+)
+
+// streamAddTrimArgs are the arguments of XADD and XTRIM, which share the
+// trimming options.
+type streamAddTrimArgs struct {
+	strategy int
+	maxLen   int64
+	minID    StreamID
+	approx   bool
+
+	// limit is the maximum number of entries to delete, zero meaning no
+	// limit.
+	limit int64
+
+	// thresholdIndex and limitIndex are where the threshold and the LIMIT
+	// option are in the arguments, for rewriteApproxTrim. limitIndex is -1
+	// when there is no LIMIT.
+	thresholdIndex int
+	limitIndex     int
+
+	// The XADD only arguments. seqGiven is false for an ID of the form
+	// "ms-*", and idGiven false for "*". idIndex is where the ID is in the
+	// arguments, followed by the fields.
+	noMkStream bool
+	id         StreamID
+	idGiven    bool
+	seqGiven   bool
+	idIndex    int
+}
+
+// Trim deletes entries from the head of the stream, until it has at most
+// maxLen entries or until the first one isn't below minID. An approximate
+// trim only removes whole nodes, and so may leave a few more entries than
+// asked. It returns how many entries it deleted.
+func (s *Stream) Trim(args *streamAddTrimArgs) int64 {
+	var deleted int64
+	for len(s.nodes) > 0 {
+		if args.strategy == streamTrimMaxLen && int64(s.length) <= args.maxLen {
+			break
+		}
+
+		node := s.nodes[0]
+		live := int64(node.live)
+		if args.limit > 0 && deleted+live > args.limit {
+			break
+		}
+
+		var removeNode bool
+		if args.strategy == streamTrimMaxLen {
+			removeNode = int64(s.length)-live >= args.maxLen
+		} else {
+			removeNode = node.entries[len(node.entries)-1].id.Compare(args.minID) < 0
+		}
+
+		if removeNode {
+			s.nodes = slices.Delete(s.nodes, 0, 1)
+			s.length -= node.live
+			deleted += live
+			continue
+		}
+
+		if args.approx {
+			break
+		}
+
+		// The node is only partly trimmed, and it is the last one to be.
+		for i := range node.entries {
+			entry := &node.entries[i]
+			if args.strategy == streamTrimMaxLen && int64(s.length) <= args.maxLen {
+				break
+			}
+			if args.strategy == streamTrimMinID && entry.id.Compare(args.minID) >= 0 {
+				break
+			}
+			if entry.deleted {
+				continue
+			}
+
+			s.deleteEntry(0, entry)
+			deleted++
+		}
+		break
+	}
+
+	return deleted
+}
+
+// parseStreamAddTrimArgs parses the arguments of XADD, or of XTRIM unless
+// xadd is set, past the key.
+func parseStreamAddTrimArgs(args []Value, xadd bool) (*streamAddTrimArgs, *RespError) {
+	parsed := &streamAddTrimArgs{limitIndex: -1}
+	limitGiven := false
+
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		moreArgs := len(args) - 1 - i
+		switch opt := strings.ToUpper(args[i].bulk); {
+		case xadd && opt == "*":
+			break options
+		case (opt == "MAXLEN" || opt == "MINID") && moreArgs > 0:
+			if parsed.strategy != streamTrimNone {
+				return nil, NewErr("syntax error, MAXLEN and MINID options at the same time are not compatible")
+			}
+
+			parsed.approx = false
+			if next := args[i+1].bulk; moreArgs >= 2 && (next == "~" || next == "=") {
+				parsed.approx = next == "~"
+				i++
+			}
+			i++
+			parsed.thresholdIndex = i
+
+			if opt == "MAXLEN" {
+				maxLen, ok := parseInteger(args[i].bulk)
+				if !ok {
+					return nil, ErrNotInteger
+				}
+				if maxLen < 0 {
+					return nil, NewErr("The MAXLEN argument must be >= 0.")
+				}
+				parsed.strategy, parsed.maxLen = streamTrimMaxLen, maxLen
+			} else {
+				minID, ok := parseStreamID(args[i].bulk, 0, true)
+				if !ok {
+					return nil, ErrInvalidStreamID
+				}
+				parsed.strategy, parsed.minID = streamTrimMinID, minID
+			}
+		case opt == "LIMIT" && moreArgs > 0:
+			limit, ok := parseInteger(args[i+1].bulk)
+			if !ok {
+				return nil, ErrNotInteger
+			}
+			if limit < 0 {
+				return nil, NewErr("The LIMIT argument must be >= 0.")
+			}
+			parsed.limit, parsed.limitIndex, limitGiven = limit, i, true
+			i++
+		case xadd && opt == "NOMKSTREAM":
+			parsed.noMkStream = true
+		case xadd:
+			// Anything else has to be the ID.
+			arg, seqGiven := args[i].bulk, true
+			if ms, ok := strings.CutSuffix(arg, "-*"); ok {
+				arg, seqGiven = ms, false
+			}
+
+			id, ok := parseStreamID(arg, 0, true)
+			if !ok {
+				return nil, ErrInvalidStreamID
+			}
+			parsed.id, parsed.idGiven, parsed.seqGiven = id, true, seqGiven
+			break options
+		default:
+			return nil, ErrSyntax
+		}
+	}
+	parsed.idIndex = i
+
+	switch {
+	case limitGiven && parsed.strategy == streamTrimNone:
+		return nil, NewErr("syntax error, LIMIT cannot be used without specifying a trimming strategy")
+	case !xadd && parsed.strategy == streamTrimNone:
+		return nil, NewErr("syntax error, XTRIM must be called with a trimming strategy")
+	case limitGiven && !parsed.approx:
+		return nil, NewErr("syntax error, LIMIT cannot be used without the special ~ option")
+	}
+
+	// Unless told otherwise, approximate trimming is bounded so it can't
+	// take too long. Exact trimming never is.
+	if !limitGiven && parsed.approx {
+		parsed.limit = 100 * streamNodeMaxEntries
+	}
+
+	return parsed, nil
+}
+
+// rewriteApproxTrim makes an approximate trim deterministic for propagation:
+// how much it trimmed depends on how the entries were laid out in nodes, so
+// it is propagated as the exact trim it amounted to. argv holds the command
+// arguments past its name.
+func (args *streamAddTrimArgs) rewriteApproxTrim(argv []string, s *Stream) []string {
+	if !args.approx {
+		return argv
+	}
+
+	argv[args.thresholdIndex-1] = "="
+	if firstID, ok := s.FirstID(); ok && args.strategy == streamTrimMinID {
+		argv[args.thresholdIndex] = firstID.String()
+	} else {
+		argv[args.thresholdIndex-2] = "MAXLEN"
+		argv[args.thresholdIndex] = strconv.Itoa(s.Len())
+	}
+
+	if args.limitIndex >= 0 {
+		argv = slices.Delete(argv, args.limitIndex, args.limitIndex+2)
+	}
+
+	return argv
+}
+
+func lookupStream(key string) (*Stream, *RespError) {
+	obj := keyspace.Lookup(key)
+	if obj == nil {
+		return nil, nil
+	}
+	if obj.typ != TypeStream {
+		return nil, ErrWrongType
+	}
+
+	return obj.value.(*Stream), nil
+}
+
+func streamEntryValue(entry *streamEntry) Value {
+	return Value{typ: "array", array: []Value{
+		MakeBulkValue(entry.id.String()),
+		{typ: "array", array: bulkValues(entry.fields)},
+	}}
+}
+
+func streamEntriesValue(entries []streamEntry) Value {
+	result := make([]Value, len(entries))
+	for i := range entries {
+		result[i] = streamEntryValue(&entries[i])
+	}
+
+	return Value{typ: "array", array: result}
+}
+
+// xadd appends an entry, and propagates the ID it was actually given so the
+// AOF reproduces the same stream.
+func xadd(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	parsed, err := parseStreamAddTrimArgs(args, true)
+	if err != nil {
+		return err.Value()
+	}
+
+	fieldsCount := len(args) - parsed.idIndex - 1
+	if fieldsCount < 2 || fieldsCount%2 != 0 {
+		return ErrWrongArity("xadd").Value()
+	}
+
+	// Returning before the stream gets created.
+	if parsed.idGiven && parsed.seqGiven && parsed.id == (StreamID{}) {
+		return NewErr("The ID specified in XADD must be greater than 0-0").Value()
+	}
+
+	stream, err := lookupStream(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	created := stream == nil
+	if created {
+		if parsed.noMkStream {
+			return MakeNilValue()
+		}
+		stream = NewStream()
+	}
+
+	if stream.lastID == maxStreamID {
+		return NewErr("The stream has exhausted the last possible ID, unable to add more items").Value()
+	}
+
+	var id StreamID
+	switch {
+	case !parsed.idGiven:
+		id, _ = stream.nextID(uint64(nowMs()))
+	case parsed.seqGiven:
+		id = parsed.id
+	case parsed.id.ms == stream.lastID.ms:
+		// The sequence is the next one of the last entry, unless that
+		// would overflow.
+		if stream.lastID.seq == math.MaxUint64 {
+			return NewErr("The ID specified in XADD is equal or smaller than the target stream top item").Value()
+		}
+		id = StreamID{ms: parsed.id.ms, seq: stream.lastID.seq + 1}
+	default:
+		id = parsed.id
+	}
+
+	if id.Compare(stream.lastID) <= 0 {
+		return NewErr("The ID specified in XADD is equal or smaller than the target stream top item").Value()
+	}
+
+	if created {
+		keyspace.Set(key, &Object{typ: TypeStream, value: stream})
+	}
+	stream.Append(id, argStrings(args[parsed.idIndex+1:]))
+	keyspace.dirty++
+
+	argv := argStrings(args)
+	argv[parsed.idIndex] = id.String()
+	if parsed.strategy != streamTrimNone {
+		stream.Trim(parsed)
+		argv = parsed.rewriteApproxTrim(argv, stream)
+	}
+	c.rewriteCommand(append([]string{"XADD"}, argv...)...)
+
+	// New entries can serve the clients blocked reading the stream.
+	keyspace.signalKeyAsReady(key)
+
+	return MakeBulkValue(id.String())
+}
+
+// xrangeGeneric implements XRANGE and XREVRANGE, which takes the end of
+// the range first. Either bound can be an incomplete "ms" ID, and exclusive
+// when it starts with '('.
+func xrangeGeneric(c *Client, args []Value, reverse bool) Value {
+	startArg, endArg := args[1].bulk, args[2].bulk
+	if reverse {
+		startArg, endArg = endArg, startArg
+	}
+
+	start, end, err := parseStreamInterval(startArg, endArg)
+	if err != nil {
+		return err.Value()
+	}
+
+	count := int64(-1)
+	for i := 3; i < len(args); i++ {
+		if !strings.EqualFold(args[i].bulk, "COUNT") || i+1 >= len(args) {
+			return ErrSyntax.Value()
+		}
+
+		i++
+		n, ok := parseInteger(args[i].bulk)
+		if !ok {
+			return ErrNotInteger.Value()
+		}
+		count = max(n, 0)
+	}
+
+	stream, err := lookupStream(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	// Like in Redis, a missing key is an empty array whatever the count,
+	// while COUNT 0 on a stream is a null array.
+	if stream == nil {
+		return Value{typ: "array"}
+	}
+	if count == 0 {
+		return MakeNilArrayValue()
+	}
+
+	return streamEntriesValue(stream.Range(start, end, reverse, int(max(count, 0))))
+}
+
+// parseStreamInterval parses the bounds of XRANGE-like commands into an
+// inclusive range of IDs.
+func parseStreamInterval(startArg, endArg string) (StreamID, StreamID, *RespError) {
+	start, exclusive, ok := parseStreamIntervalID(startArg, 0)
+	if !ok {
+		return StreamID{}, StreamID{}, ErrInvalidStreamID
+	}
+	if exclusive {
+		if start, ok = start.Incr(); !ok {
+			return StreamID{}, StreamID{}, NewErr("invalid start ID for the interval")
+		}
+	}
+
+	end, exclusive, ok := parseStreamIntervalID(endArg, math.MaxUint64)
+	if !ok {
+		return StreamID{}, StreamID{}, ErrInvalidStreamID
+	}
+	if exclusive {
+		if end, ok = end.Decr(); !ok {
+			return StreamID{}, StreamID{}, NewErr("invalid end ID for the interval")
+		}
+	}
+
+	return start, end, nil
+}
+
+// parseStreamIntervalID parses a bound of XRANGE, which is exclusive when it
+// starts with '('.
+func parseStreamIntervalID(s string, missingSeq uint64) (StreamID, bool, bool) {
+	if len(s) > 1 && s[0] == '(' {
+		id, ok := parseStreamID(s[1:], missingSeq, true)
+		return id, true, ok
+	}
+
+	id, ok := parseStreamID(s, missingSeq, false)
+	return id, false, ok
+}
+
+func xrange(c *Client, args []Value) Value {
+	return xrangeGeneric(c, args, false)
+}
+
+func xrevrange(c *Client, args []Value) Value {
+	return xrangeGeneric(c, args, true)
+}
+
+func xlen(c *Client, args []Value) Value {
+	stream, err := lookupStream(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	return MakeIntValue(stream.Len())
+}
+
+func xdel(c *Client, args []Value) Value {
+	stream, err := lookupStream(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	// Every ID is validated before deleting any entry.
+	ids := make([]StreamID, len(args)-1)
+	for i, arg := range args[1:] {
+		id, ok := parseStreamID(arg.bulk, 0, true)
+		if !ok {
+			return ErrInvalidStreamID.Value()
+		}
+		ids[i] = id
+	}
+
+	if stream == nil {
+		return MakeIntValue(0)
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		if stream.Delete(id) {
+			deleted++
+		}
+	}
+
+	if deleted > 0 {
+		keyspace.dirty++
+	}
+
+	return MakeIntValue(deleted)
+}
+
+func xtrim(c *Client, args []Value) Value {
+	stream, err := lookupStream(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	parsed, err := parseStreamAddTrimArgs(args, false)
+	if err != nil {
+		return err.Value()
+	}
+
+	if stream == nil {
+		return MakeIntValue(0)
+	}
+
+	deleted := stream.Trim(parsed)
+	if deleted > 0 {
+		keyspace.dirty++
+		c.rewriteCommand(append([]string{"XTRIM"}, parsed.rewriteApproxTrim(argStrings(args), stream)...)...)
+	}
+
+	return MakeIntValue(int(deleted))
+}
+
+// streamRead is a stream XREAD or XREADGROUP reads from, and what from.
+type streamRead struct {
+	key    string
+	stream *Stream
+	cg     *streamCG
+
+	// id is the ID entries are read after. For groups, newEntries means
+	// reading what wasn't delivered to the group yet, and otherwise the
+	// history of the consumer is read.
+	id         StreamID
+	newEntries bool
+}
+
+// xreadGeneric implements XREAD and XREADGROUP, which replies with the
+// entries of each stream that had any, or blocks when none had and BLOCK
+// was given. Deliveries to groups are propagated as the XCLAIM and XGROUP
+// commands that recreate them, XREADGROUP itself is not.
+func xreadGeneric(c *Client, args []Value, xreadgroup bool) Value {
+	name, newEntriesID := "xread", "$"
+	if xreadgroup {
+		name, newEntriesID = "xreadgroup", ">"
+	}
+
+	var timeout time.Duration
+	block, noack := false, false
+	count := int64(0)
+	group, consumerName := "", ""
+	streamsIndex := -1
+
+options:
+	for i := 0; i < len(args); i++ {
+		moreArgs := len(args) - 1 - i
+		switch opt := strings.ToUpper(args[i].bulk); {
+		case opt == "BLOCK" && moreArgs > 0:
+			i++
+			var err *RespError
+			if timeout, err = parseTimeoutMs(args[i].bulk); err != nil {
+				return err.Value()
+			}
+			block = true
+		case opt == "COUNT" && moreArgs > 0:
+			i++
+			n, ok := parseInteger(args[i].bulk)
+			if !ok {
+				return ErrNotInteger.Value()
+			}
+			count = max(n, 0)
+		case opt == "STREAMS" && moreArgs > 0:
+			streamsIndex = i + 1
+			break options
+		case opt == "GROUP" && moreArgs >= 2 && xreadgroup:
+			group, consumerName = args[i+1].bulk, args[i+2].bulk
+			i += 2
+		case opt == "NOACK" && xreadgroup:
+			noack = true
+		default:
+			return ErrSyntax.Value()
+		}
+	}
+
+	if streamsIndex == -1 {
+		return ErrSyntax.Value()
+	}
+	if (len(args)-streamsIndex)%2 != 0 {
+		return NewErr("Unbalanced '%s' list of streams: for each stream key an ID or '%s' must be specified.", name, newEntriesID).Value()
+	}
+	if xreadgroup && group == "" {
+		return NewErr("Missing GROUP option for XREADGROUP").Value()
+	}
+
+	numStreams := (len(args) - streamsIndex) / 2
+	keys := argStrings(args[streamsIndex : streamsIndex+numStreams])
+	reads := make([]streamRead, numStreams)
+	for i, key := range keys {
+		read := &reads[i]
+		read.key = key
+
+		stream, err := lookupStream(key)
+		if err != nil {
+			return err.Value()
+		}
+		read.stream = stream
+
+		if xreadgroup {
+			if read.cg = stream.Group(group); read.cg == nil {
+				return NewRespError("NOGROUP", "No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, group).Value()
+			}
+		}
+
+		arg := args[streamsIndex+numStreams+i].bulk
+		switch {
+		case arg == ">":
+			if !xreadgroup {
+				return NewErr("The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.").Value()
+			}
+			read.id, read.newEntries = read.cg.lastID, true
+		case arg == "$" && xreadgroup:
+			return NewErr("The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.").Value()
+		case arg == "+" && xreadgroup:
+			return NewErr("The + ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The + ID would just return an empty result set.").Value()
+		case arg == "$":
+			if stream != nil {
+				read.id = stream.lastID
+			}
+		case arg == "+":
+			// Reading after the ID preceding the last entry serves it. The
+			// last ID may belong to a deleted entry, so the last one left
+			// is looked up.
+			if stream != nil {
+				if last := stream.lastValidID(); last != (StreamID{}) {
+					read.id, _ = last.Decr()
+				}
+			}
+		default:
+			id, ok := parseStreamID(arg, 0, true)
+			if !ok {
+				return ErrInvalidStreamID.Value()
+			}
+			read.id = id
+		}
+	}
+
+	if xreadgroup {
+		c.preventPropagation()
+	}
+
+	now := nowMs()
+	var served []Value
+	for i := range reads {
+		read := &reads[i]
+
+		var entries Value
+		if read.cg != nil {
+			consumer, created := read.cg.CreateConsumer(consumerName, now)
+			if created {
+				propagateConsumerCreation(c, read.key, group, consumerName)
+				keyspace.dirty++
+			}
+			consumer.seenTime = now
+
+			if !read.newEntries {
+				// The history of the consumer is served even when empty,
+				// as there is nothing to wait for.
+				entries = xreadConsumerHistory(c, read, group, consumer, count, now)
+			} else if read.stream.lastID.Compare(read.id) > 0 {
+				entries = xreadGroupNewEntries(c, read, group, consumer, count, noack, now)
+			}
+		} else if read.stream != nil && read.stream.lastID.Compare(read.id) > 0 {
+			start, _ := read.id.Incr()
+			if found := read.stream.Range(start, maxStreamID, false, int(count)); len(found) > 0 {
+				entries = streamEntriesValue(found)
+			}
+		}
+
+		if entries.typ != "" {
+			served = append(served, MakeBulkValue(read.key), entries)
+		}
+	}
+
+	if len(served) == 0 {
+		if block {
+			// The IDs are the ones to read after once woken up, so "$" and
+			// "+" must not be resolved again against the new entries.
+			if !xreadgroup {
+				for i := range reads {
+					args[streamsIndex+numStreams+i] = MakeBulkValue(reads[i].id.String())
+				}
+			}
+
+			c.block(keys, TypeStream, timeout, MakeNilArrayValue())
+			return Value{}
+		}
+		return MakeNilArrayValue()
+	}
+
+	if c.proto == RESP3 {
+		return MakeMapValue(served...)
+	}
+
+	result := make([]Value, 0, len(served)/2)
+	for i := 0; i < len(served); i += 2 {
+		result = append(result, Value{typ: "array", array: served[i : i+2]})
+	}
+	return Value{typ: "array", array: result}
+}
+
+// xreadGroupNewEntries delivers to consumer the entries the group didn't
+// deliver yet, adding them to the pending entries unless noack is set. It
+// returns a zero Value when there were none.
+func xreadGroupNewEntries(c *Client, read *streamRead, group string, consumer *streamConsumer, count int64, noack bool, now int64) Value {
+	start, _ := read.id.Incr()
+	entries := read.stream.Range(start, maxStreamID, false, int(count))
+	if len(entries) == 0 {
+		return Value{}
+	}
+
+	cg := read.cg
+	for i := range entries {
+		id := entries[i].id
+		cg.advance(read.stream, id)
+		if !noack {
+			nack := cg.deliver(id, consumer, now)
+			propagateXClaim(c, read.key, group, cg, id, nack)
+		}
+	}
+	consumer.activeTime = now
+
+	propagateGroupID(c, read.key, group, cg)
+	keyspace.dirty++
+
+	return streamEntriesValue(entries)
+}
+
+// xreadConsumerHistory serves the entries pending for consumer after the ID
+// of read, counting them as delivered once more. Entries deleted from the
+// stream are replied with a nil field list.
+func xreadConsumerHistory(c *Client, read *streamRead, group string, consumer *streamConsumer, count int64, now int64) Value {
+	result := []Value{}
+
+	start, ok := read.id.Incr()
+	if !ok {
+		return Value{typ: "array", array: result}
+	}
+
+	for _, id := range consumer.pel.ids[consumer.pel.seek(start):] {
+		if count > 0 && int64(len(result)) == count {
+			break
+		}
+
+		entry, exists := read.stream.Get(id)
+		if !exists {
+			result = append(result, Value{typ: "array", array: []Value{MakeBulkValue(id.String()), MakeNilArrayValue()}})
+			continue
+		}
+
+		nack := consumer.pel.nacks[id]
+		nack.deliveryTime = now
+		nack.deliveryCount++
+		propagateXClaim(c, read.key, group, read.cg, id, nack)
+		keyspace.dirty++
+
+		result = append(result, streamEntryValue(entry))
+	}
+
+	return Value{typ: "array", array: result}
+}
+
+func xread(c *Client, args []Value) Value {
+	return xreadGeneric(c, args, false)
+}
@@ -0,0 +1,1267 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func registerStreamGroupCommands(commands map[string]Command) {
+	commands["XGROUP"] = Command{
+		details: Details{
+			name:              "xgroup",
+			arity:             -2,
+			flags:             []string{"write"},
+			firstKey:          2,
+			lastKey:           2,
+			step:              1,
+			aclCategories:     []string{"@write", "@stream", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: xgroup,
+	}
+
+	commands["XREADGROUP"] = Command{
+		details: Details{
+			name:              "xreadgroup",
+			arity:             -7,
+			flags:             []string{"write", "blocking", "movablekeys"},
+			firstKey:          0,
+			lastKey:           0,
+			step:              0,
+			aclCategories:     []string{"@write", "@stream", "@slow", "@blocking"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: xreadgroup,
+	}
+
+	commands["XACK"] = Command{
+		details: Details{
+			name:              "xack",
+			arity:             -4,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@stream", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: xack,
+	}
+
+	commands["XPENDING"] = Command{
+		details: Details{
+			name:              "xpending",
+			arity:             -3,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@stream", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: xpending,
+	}
+
+	commands["XCLAIM"] = Command{
+		details: Details{
+			name:              "xclaim",
+			arity:             -6,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@stream", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: xclaim,
+	}
+
+	commands["XAUTOCLAIM"] = Command{
+		details: Details{
+			name:              "xautoclaim",
+			arity:             -6,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@stream", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: xautoclaim,
+	}
+
+	commands["XINFO"] = Command{
+		details: Details{
+			name:              "xinfo",
+			arity:             -2,
+			flags:             []string{"readonly"},
+			firstKey:          2,
+			lastKey:           2,
+			step:              1,
+			aclCategories:     []string{"@read", "@stream", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: xinfo,
+	}
+}
+
+// streamInvalidEntriesRead is the entries read counter of a group when it
+// isn't known.
+const streamInvalidEntriesRead = -1
+
+// streamNACK is a pending entry: delivered to a consumer of a group, but
+// not acknowledged yet.
+type streamNACK struct {
+	consumer      *streamConsumer
+	deliveryTime  int64
+	deliveryCount int64
+}
+
+// streamPEL is a pending entries list. Like the intset it keeps the IDs
+// sorted in a slice, since entries are mostly delivered in order and so
+// appended.
+type streamPEL struct {
+	ids   []StreamID
+	nacks map[StreamID]*streamNACK
+}
+
+func newStreamPEL() *streamPEL {
+	return &streamPEL{nacks: make(map[StreamID]*streamNACK)}
+}
+
+func (pel *streamPEL) Len() int {
+	return len(pel.ids)
+}
+
+func (pel *streamPEL) Get(id StreamID) (*streamNACK, bool) {
+	nack, ok := pel.nacks[id]
+	return nack, ok
+}
+
+func (pel *streamPEL) Insert(id StreamID, nack *streamNACK) {
+	if _, ok := pel.nacks[id]; ok {
+		pel.nacks[id] = nack
+		return
+	}
+
+	i := pel.seek(id)
+	pel.ids = slices.Insert(pel.ids, i, id)
+	pel.nacks[id] = nack
+}
+
+func (pel *streamPEL) Remove(id StreamID) bool {
+	if _, ok := pel.nacks[id]; !ok {
+		return false
+	}
+
+	i := pel.seek(id)
+	pel.ids = slices.Delete(pel.ids, i, i+1)
+	delete(pel.nacks, id)
+	return true
+}
+
+// seek returns the index of the first ID greater than or equal to id.
+func (pel *streamPEL) seek(id StreamID) int {
+	return sort.Search(len(pel.ids), func(i int) bool { return pel.ids[i].Compare(id) >= 0 })
+}
+
+type streamConsumer struct {
+	name string
+	pel  *streamPEL
+
+	// seenTime is the last time the consumer interacted with the group,
+	// and activeTime the last time it was delivered or claimed an entry, or
+	// -1 if it never was.
+	seenTime   int64
+	activeTime int64
+}
+
+// streamCG is a consumer group. The entries past lastID are the ones not
+// delivered to any consumer yet.
+type streamCG struct {
+	lastID StreamID
+
+	// entriesRead is the logical counter of the entries the group read, for
+	// computing its lag, or streamInvalidEntriesRead.
+	entriesRead int64
+
+	pel       *streamPEL
+	consumers map[string]*streamConsumer
+}
+
+// Group returns the consumer group called name, or nil.
+func (s *Stream) Group(name string) *streamCG {
+	if s == nil {
+		return nil
+	}
+
+	return s.groups[name]
+}
+
+// CreateGroup creates a consumer group, and reports false if there is one
+// with that name already.
+func (s *Stream) CreateGroup(name string, lastID StreamID, entriesRead int64) bool {
+	if _, ok := s.groups[name]; ok {
+		return false
+	}
+
+	if s.groups == nil {
+		s.groups = make(map[string]*streamCG)
+	}
+	s.groups[name] = &streamCG{
+		lastID:      lastID,
+		entriesRead: entriesRead,
+		pel:         newStreamPEL(),
+		consumers:   make(map[string]*streamConsumer),
+	}
+
+	return true
+}
+
+func (s *Stream) DestroyGroup(name string) bool {
+	if _, ok := s.groups[name]; !ok {
+		return false
+	}
+
+	delete(s.groups, name)
+	return true
+}
+
+// groupNames returns the names of the consumer groups, sorted.
+func (s *Stream) groupNames() []string {
+	names := make([]string, 0, len(s.groups))
+	for name := range s.groups {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// lastValidID returns the ID of the last entry that wasn't deleted, or 0-0.
+func (s *Stream) lastValidID() StreamID {
+	entry, ok := s.Iterator(StreamID{}, maxStreamID, true).Next()
+	if !ok {
+		return StreamID{}
+	}
+
+	return entry.id
+}
+
+// rangeHasTombstones reports whether entries between start and end may
+// have been deleted.
+func (s *Stream) rangeHasTombstones(start, end StreamID) bool {
+	if s.Len() == 0 || s.maxDeletedID == (StreamID{}) {
+		return false
+	}
+
+	if firstID, _ := s.FirstID(); firstID.Compare(s.maxDeletedID) > 0 {
+		return false
+	}
+
+	return start.Compare(s.maxDeletedID) <= 0 && s.maxDeletedID.Compare(end) <= 0
+}
+
+// estimateEntriesRead returns the logical counter of the entry with the
+// given ID, which is how many entries were added up to it, when that can be
+// known without a scan. It returns streamInvalidEntriesRead otherwise.
+func (s *Stream) estimateEntriesRead(id StreamID) int64 {
+	if s.entriesAdded == 0 {
+		return 0
+	}
+
+	if s.Len() == 0 && id.Compare(s.lastID) <= 0 {
+		return int64(s.entriesAdded)
+	}
+
+	switch c := id.Compare(s.lastID); {
+	case c == 0:
+		return int64(s.entriesAdded)
+	case c > 0:
+		return streamInvalidEntriesRead
+	}
+
+	// Without deletions past the first entry, the counters of the entries
+	// still in the stream follow each other.
+	firstID, _ := s.FirstID()
+	if s.maxDeletedID == (StreamID{}) || s.maxDeletedID.Compare(firstID) < 0 {
+		switch c := id.Compare(firstID); {
+		case c < 0:
+			return int64(s.entriesAdded) - int64(s.length)
+		case c == 0:
+			return int64(s.entriesAdded) - int64(s.length) + 1
+		}
+	}
+
+	return streamInvalidEntriesRead
+}
+
+// lag returns how many entries of the stream the group didn't read yet,
+// and false if it can't be known.
+func (cg *streamCG) lag(s *Stream) (int64, bool) {
+	if s.entriesAdded == 0 {
+		return 0, true
+	}
+
+	if cg.entriesRead != streamInvalidEntriesRead && !s.rangeHasTombstones(cg.lastID, maxStreamID) {
+		return int64(s.entriesAdded) - cg.entriesRead, true
+	}
+
+	entriesRead := s.estimateEntriesRead(cg.lastID)
+	if entriesRead == streamInvalidEntriesRead {
+		return 0, false
+	}
+
+	return int64(s.entriesAdded) - entriesRead, true
+}
+
+// advance moves the last delivered ID of the group to id, counting it as
+// read.
+func (cg *streamCG) advance(s *Stream, id StreamID) {
+	if cg.entriesRead != streamInvalidEntriesRead && !s.rangeHasTombstones(id, maxStreamID) {
+		cg.entriesRead++
+	} else if s.entriesAdded > 0 {
+		cg.entriesRead = s.estimateEntriesRead(id)
+	}
+
+	cg.lastID = id
+}
+
+// Consumer returns the consumer called name, and nil if there is none.
+func (cg *streamCG) Consumer(name string) *streamConsumer {
+	return cg.consumers[name]
+}
+
+// CreateConsumer creates a consumer, and reports false if there is one with
+// that name already.
+func (cg *streamCG) CreateConsumer(name string, now int64) (*streamConsumer, bool) {
+	if consumer, ok := cg.consumers[name]; ok {
+		return consumer, false
+	}
+
+	consumer := &streamConsumer{name: name, pel: newStreamPEL(), seenTime: now, activeTime: -1}
+	cg.consumers[name] = consumer
+	return consumer, true
+}
+
+// DeleteConsumer deletes a consumer along with its pending entries, and
+// returns how many it had.
+func (cg *streamCG) DeleteConsumer(name string) int {
+	consumer, ok := cg.consumers[name]
+	if !ok {
+		return 0
+	}
+
+	for _, id := range consumer.pel.ids {
+		cg.pel.Remove(id)
+	}
+	delete(cg.consumers, name)
+
+	return consumer.pel.Len()
+}
+
+// consumerNames returns the names of the consumers, sorted.
+func (cg *streamCG) consumerNames() []string {
+	names := make([]string, 0, len(cg.consumers))
+	for name := range cg.consumers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// clone returns a copy of the group, whose pending entries are shared by
+// the group and the copied consumers like in the original.
+func (cg *streamCG) clone() *streamCG {
+	clone := &streamCG{
+		lastID:      cg.lastID,
+		entriesRead: cg.entriesRead,
+		pel:         newStreamPEL(),
+		consumers:   make(map[string]*streamConsumer, len(cg.consumers)),
+	}
+
+	for name, consumer := range cg.consumers {
+		copied := *consumer
+		copied.pel = newStreamPEL()
+		clone.consumers[name] = &copied
+	}
+
+	for _, id := range cg.pel.ids {
+		nack := *cg.pel.nacks[id]
+		nack.consumer = clone.consumers[nack.consumer.name]
+		clone.pel.Insert(id, &nack)
+		nack.consumer.pel.Insert(id, &nack)
+	}
+
+	return clone
+}
+
+// deliver records the entry as delivered to consumer at now. An entry that
+// is pending already, which can happen after XGROUP SETID moved the group
+// back, is reassigned to consumer.
+func (cg *streamCG) deliver(id StreamID, consumer *streamConsumer, now int64) *streamNACK {
+	nack, ok := cg.pel.Get(id)
+	if !ok {
+		nack = &streamNACK{}
+		cg.pel.Insert(id, nack)
+	}
+
+	cg.assign(id, nack, consumer)
+	nack.deliveryTime, nack.deliveryCount = now, 1
+	consumer.activeTime = now
+
+	return nack
+}
+
+// assign moves the pending entry to consumer.
+func (cg *streamCG) assign(id StreamID, nack *streamNACK, consumer *streamConsumer) {
+	if nack.consumer == consumer {
+		return
+	}
+
+	if nack.consumer != nil {
+		nack.consumer.pel.Remove(id)
+	}
+	nack.consumer = consumer
+	consumer.pel.Insert(id, nack)
+}
+
+// Ack acknowledges the entry, removing it from the pending entries.
+func (cg *streamCG) Ack(id StreamID) bool {
+	nack, ok := cg.pel.Get(id)
+	if !ok {
+		return false
+	}
+
+	cg.pel.Remove(id)
+	nack.consumer.pel.Remove(id)
+	return true
+}
+
+func errNoGroup(key, group string) *RespError {
+	return NewRespError("NOGROUP", "No such key '%s' or consumer group '%s'", key, group)
+}
+
+// lookupStreamGroup returns the stream at key and its consumer group, with
+// the NOGROUP error if either doesn't exist.
+func lookupStreamGroup(key, group string) (*Stream, *streamCG, *RespError) {
+	stream, err := lookupStream(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cg := stream.Group(group)
+	if cg == nil {
+		return nil, nil, errNoGroup(key, group)
+	}
+
+	return stream, cg, nil
+}
+
+// propagateXClaim propagates the state of a pending entry as the XCLAIM
+// that recreates it, which is how the AOF reproduces deliveries and claims.
+// A claim of an entry that no longer exists deletes it from the PEL when
+// replayed.
+func propagateXClaim(c *Client, key, group string, cg *streamCG, id StreamID, nack *streamNACK) {
+	c.alsoPropagate("XCLAIM", key, group, nack.consumer.name, "0", id.String(),
+		"TIME", strconv.FormatInt(nack.deliveryTime, 10),
+		"RETRYCOUNT", strconv.FormatInt(nack.deliveryCount, 10),
+		"FORCE", "JUSTID", "LASTID", cg.lastID.String())
+}
+
+// propagateGroupID propagates the last delivered ID of the group and its
+// entries read counter.
+func propagateGroupID(c *Client, key, group string, cg *streamCG) {
+	c.alsoPropagate("XGROUP", "SETID", key, group, cg.lastID.String(), "ENTRIESREAD", strconv.FormatInt(cg.entriesRead, 10))
+}
+
+func propagateConsumerCreation(c *Client, key, group, consumer string) {
+	c.alsoPropagate("XGROUP", "CREATECONSUMER", key, group, consumer)
+}
+
+// parseGroupID parses the ID of XGROUP CREATE and SETID, where "$" is the
+// last ID of the stream.
+func parseGroupID(arg string, stream *Stream) (StreamID, bool) {
+	if arg == "$" {
+		if stream == nil {
+			return StreamID{}, true
+		}
+		return stream.lastID, true
+	}
+
+	return parseStreamID(arg, 0, true)
+}
+
+var xgroupHelp = []string{
+	"XGROUP <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"CREATE <key> <groupname> <id|$> [option]",
+	"    Create a new consumer group. Options are:",
+	"    * MKSTREAM",
+	"      Create the empty stream if it does not exist.",
+	"    * ENTRIESREAD entries_read",
+	"      Set the group's entries_read counter (internal use).",
+	"CREATECONSUMER <key> <groupname> <consumer>",
+	"    Create a new consumer in the specified group.",
+	"DELCONSUMER <key> <groupname> <consumer>",
+	"    Remove the specified consumer.",
+	"DESTROY <key> <groupname>",
+	"    Remove the specified group.",
+	"SETID <key> <groupname> <id|$> [ENTRIESREAD entries_read]",
+	"    Set the current group ID and entries_read counter.",
+	"HELP",
+	"    Print this help.",
+}
+
+func helpValue(lines []string) Value {
+	result := make([]Value, len(lines))
+	for i, line := range lines {
+		result[i] = Value{typ: "string", str: line}
+	}
+
+	return Value{typ: "array", array: result}
+}
+
+func xgroup(c *Client, args []Value) Value {
+	sub := strings.ToUpper(args[0].bulk)
+
+	// The arity of each subcommand, like in the command table.
+	arity := map[string]int{"HELP": 2, "CREATE": -5, "SETID": -5, "DESTROY": 4, "CREATECONSUMER": 5, "DELCONSUMER": 5}[sub]
+	if arity == 0 {
+		return NewErr("unknown subcommand '%.128s'. Try XGROUP HELP.", args[0].bulk).Value()
+	}
+	if d := (Details{arity: arity}); !d.CheckArity(len(args) + 1) {
+		return ErrWrongArity("xgroup|" + strings.ToLower(sub)).Value()
+	}
+
+	if sub == "HELP" {
+		return helpValue(xgroupHelp)
+	}
+
+	key, group := args[1].bulk, args[2].bulk
+
+	mkStream, entriesRead := false, int64(streamInvalidEntriesRead)
+	if sub == "CREATE" || sub == "SETID" {
+		for i := 4; i < len(args); i++ {
+			switch opt := strings.ToUpper(args[i].bulk); {
+			case opt == "MKSTREAM" && sub == "CREATE":
+				mkStream = true
+			case opt == "ENTRIESREAD" && i+1 < len(args):
+				i++
+				n, ok := parseInteger(args[i].bulk)
+				if !ok {
+					return ErrNotInteger.Value()
+				}
+				if n < 0 && n != streamInvalidEntriesRead {
+					return NewErr("value for ENTRIESREAD must be positive or -1").Value()
+				}
+				entriesRead = n
+			default:
+				return ErrSyntax.Value()
+			}
+		}
+	}
+
+	stream, err := lookupStream(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	if stream == nil && !mkStream {
+		return NewErr("The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.").Value()
+	}
+
+	cg := stream.Group(group)
+	if cg == nil && sub != "CREATE" && sub != "DESTROY" {
+		return NewRespError("NOGROUP", "No such consumer group '%s' for key name '%s'", group, key).Value()
+	}
+
+	switch sub {
+	case "CREATE":
+		id, ok := parseGroupID(args[3].bulk, stream)
+		if !ok {
+			return ErrInvalidStreamID.Value()
+		}
+
+		if cg != nil {
+			return NewRespError("BUSYGROUP", "Consumer Group name already exists").Value()
+		}
+
+		if stream == nil {
+			stream = NewStream()
+			keyspace.Set(key, &Object{typ: TypeStream, value: stream})
+		}
+		stream.CreateGroup(group, id, entriesRead)
+		keyspace.dirty++
+
+		return Value{typ: "string", str: "OK"}
+	case "SETID":
+		id, ok := parseGroupID(args[3].bulk, stream)
+		if !ok {
+			return ErrInvalidStreamID.Value()
+		}
+
+		cg.lastID, cg.entriesRead = id, entriesRead
+		keyspace.dirty++
+
+		return Value{typ: "string", str: "OK"}
+	case "DESTROY":
+		if !stream.DestroyGroup(group) {
+			return MakeIntValue(0)
+		}
+		keyspace.dirty++
+
+		// The clients blocked reading from the group get an error.
+		keyspace.signalKeyAsReady(key)
+
+		return MakeIntValue(1)
+	case "CREATECONSUMER":
+		if _, created := cg.CreateConsumer(args[3].bulk, nowMs()); !created {
+			return MakeIntValue(0)
+		}
+		keyspace.dirty++
+
+		return MakeIntValue(1)
+	default:
+		if cg.Consumer(args[3].bulk) == nil {
+			return MakeIntValue(0)
+		}
+
+		pending := cg.DeleteConsumer(args[3].bulk)
+		keyspace.dirty++
+
+		return MakeIntValue(pending)
+	}
+}
+
+func xreadgroup(c *Client, args []Value) Value {
+	return xreadGeneric(c, args, true)
+}
+
+func xack(c *Client, args []Value) Value {
+	stream, err := lookupStream(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	cg := stream.Group(args[1].bulk)
+	if cg == nil {
+		return MakeIntValue(0)
+	}
+
+	// Every ID is validated before acknowledging any.
+	ids := make([]StreamID, len(args)-2)
+	for i, arg := range args[2:] {
+		id, ok := parseStreamID(arg.bulk, 0, true)
+		if !ok {
+			return ErrInvalidStreamID.Value()
+		}
+		ids[i] = id
+	}
+
+	acked := 0
+	for _, id := range ids {
+		if cg.Ack(id) {
+			acked++
+		}
+	}
+
+	if acked > 0 {
+		keyspace.dirty++
+	}
+
+	return MakeIntValue(acked)
+}
+
+// xpending replies with a summary of the pending entries of a group or,
+// given a range, with the details of the pending entries in it, optionally
+// only those of a consumer and idle for at least some time.
+func xpending(c *Client, args []Value) Value {
+	key, group := args[0].bulk, args[1].bulk
+
+	if len(args) != 2 && (len(args) < 5 || len(args) > 8) {
+		return ErrSyntax.Value()
+	}
+
+	var start, end StreamID
+	var minIdle, count int64
+	var consumerName string
+	if len(args) >= 5 {
+		i := 2
+		if strings.EqualFold(args[2].bulk, "IDLE") {
+			if len(args) < 7 {
+				return ErrSyntax.Value()
+			}
+			n, ok := parseInteger(args[3].bulk)
+			if !ok {
+				return ErrNotInteger.Value()
+			}
+			minIdle = n
+			i += 2
+		}
+
+		n, ok := parseInteger(args[i+2].bulk)
+		if !ok {
+			return ErrNotInteger.Value()
+		}
+		count = max(n, 0)
+
+		var err *RespError
+		if start, end, err = parseStreamInterval(args[i].bulk, args[i+1].bulk); err != nil {
+			return err.Value()
+		}
+
+		if i+3 < len(args) {
+			consumerName = args[i+3].bulk
+		}
+	}
+
+	_, cg, err := lookupStreamGroup(key, group)
+	if err != nil {
+		return err.Value()
+	}
+
+	if len(args) == 2 {
+		if cg.pel.Len() == 0 {
+			return Value{typ: "array", array: []Value{MakeIntValue(0), MakeNilValue(), MakeNilValue(), MakeNilArrayValue()}}
+		}
+
+		var consumers []Value
+		for _, name := range cg.consumerNames() {
+			if pending := cg.consumers[name].pel.Len(); pending > 0 {
+				consumers = append(consumers, Value{typ: "array", array: []Value{MakeBulkValue(name), MakeBulkValue(strconv.Itoa(pending))}})
+			}
+		}
+
+		return Value{typ: "array", array: []Value{
+			MakeIntValue(cg.pel.Len()),
+			MakeBulkValue(cg.pel.ids[0].String()),
+			MakeBulkValue(cg.pel.ids[cg.pel.Len()-1].String()),
+			{typ: "array", array: consumers},
+		}}
+	}
+
+	pel := cg.pel
+	if consumerName != "" {
+		consumer := cg.Consumer(consumerName)
+		if consumer == nil {
+			return Value{typ: "array", array: []Value{}}
+		}
+		pel = consumer.pel
+	}
+
+	now := nowMs()
+	result := []Value{}
+	for _, id := range pel.ids[pel.seek(start):] {
+		if int64(len(result)) == count || id.Compare(end) > 0 {
+			break
+		}
+
+		nack := pel.nacks[id]
+		idle := now - nack.deliveryTime
+		if minIdle > 0 && idle < minIdle {
+			continue
+		}
+
+		result = append(result, Value{typ: "array", array: []Value{
+			MakeBulkValue(id.String()),
+			MakeBulkValue(nack.consumer.name),
+			MakeIntValue(int(idle)),
+			MakeIntValue(int(nack.deliveryCount)),
+		}})
+	}
+
+	return Value{typ: "array", array: result}
+}
+
+// claim assigns the pending entry to the consumer called name, which gets
+// created if needed, and propagates the claim.
+func claim(c *Client, key, group string, cg *streamCG, consumer **streamConsumer, name string, id StreamID, nack *streamNACK, deliveryTime int64, deliveryCount int64) {
+	now := nowMs()
+	if *consumer == nil {
+		*consumer, _ = cg.CreateConsumer(name, now)
+	}
+
+	cg.assign(id, nack, *consumer)
+	nack.deliveryTime, nack.deliveryCount = deliveryTime, deliveryCount
+	(*consumer).seenTime, (*consumer).activeTime = now, now
+
+	propagateXClaim(c, key, group, cg, id, nack)
+	keyspace.dirty++
+}
+
+// dropDeletedPending removes a pending entry whose stream entry was deleted,
+// and propagates the removal as the XCLAIM that does it on replay.
+func dropDeletedPending(c *Client, key, group string, cg *streamCG, id StreamID, nack *streamNACK) {
+	propagateXClaim(c, key, group, cg, id, nack)
+	cg.Ack(id)
+	keyspace.dirty++
+}
+
+// xclaim changes the owner of pending entries idle for at least
+// min-idle-time. It is also how the AOF recreates pending entries, with
+// FORCE creating the ones that aren't pending yet.
+func xclaim(c *Client, args []Value) Value {
+	key, group, name := args[0].bulk, args[1].bulk, args[2].bulk
+
+	stream, cg, err := lookupStreamGroup(key, group)
+	if err != nil {
+		return err.Value()
+	}
+
+	minIdle, ok := parseInteger(args[3].bulk)
+	if !ok {
+		return NewErr("Invalid min-idle-time argument for XCLAIM").Value()
+	}
+	minIdle = max(minIdle, 0)
+
+	// The IDs are all parsed first, as the reply can't be an error once
+	// some entries were claimed. What follows them are options.
+	var ids []StreamID
+	i := 4
+	for ; i < len(args); i++ {
+		id, ok := parseStreamID(args[i].bulk, 0, true)
+		if !ok {
+			break
+		}
+		ids = append(ids, id)
+	}
+
+	now := nowMs()
+	deliveryTime, retryCount := int64(-1), int64(-1)
+	force, justID := false, false
+	var lastID StreamID
+	for ; i < len(args); i++ {
+		moreArgs := len(args) - 1 - i
+		switch opt := strings.ToUpper(args[i].bulk); {
+		case opt == "FORCE":
+			force = true
+		case opt == "JUSTID":
+			justID = true
+		case opt == "IDLE" && moreArgs > 0:
+			i++
+			idle, ok := parseInteger(args[i].bulk)
+			if !ok {
+				return NewErr("Invalid IDLE option argument for XCLAIM").Value()
+			}
+			deliveryTime = now - idle
+		case opt == "TIME" && moreArgs > 0:
+			i++
+			if deliveryTime, ok = parseInteger(args[i].bulk); !ok {
+				return NewErr("Invalid TIME option argument for XCLAIM").Value()
+			}
+		case opt == "RETRYCOUNT" && moreArgs > 0:
+			i++
+			if retryCount, ok = parseInteger(args[i].bulk); !ok {
+				return NewErr("Invalid RETRYCOUNT option argument for XCLAIM").Value()
+			}
+		case opt == "LASTID" && moreArgs > 0:
+			i++
+			if lastID, ok = parseStreamID(args[i].bulk, 0, true); !ok {
+				return ErrInvalidStreamID.Value()
+			}
+		default:
+			return NewErr("Unrecognized XCLAIM option '%s'", args[i].bulk).Value()
+		}
+	}
+
+	c.preventPropagation()
+
+	propagateLastID := false
+	if lastID.Compare(cg.lastID) > 0 {
+		cg.lastID = lastID
+		propagateLastID = true
+	}
+
+	// A bogus delivery time isn't worth an error, as clients may compute it
+	// from a clock a bit ahead of ours.
+	if deliveryTime < 0 || deliveryTime > now {
+		deliveryTime = now
+	}
+
+	var consumer *streamConsumer
+	if existing := cg.Consumer(name); existing != nil {
+		consumer = existing
+	}
+
+	result := []Value{}
+	for _, id := range ids {
+		nack, pending := cg.pel.Get(id)
+
+		entry, exists := stream.Get(id)
+		if !exists {
+			if pending {
+				dropDeletedPending(c, key, group, cg, id, nack)
+				propagateLastID = false
+			}
+			continue
+		}
+
+		// FORCE creates the pending entry from scratch, which is what
+		// lets the AOF recreate the ones delivered by XREADGROUP.
+		if !pending {
+			if !force {
+				continue
+			}
+			nack = &streamNACK{}
+			cg.pel.Insert(id, nack)
+		} else if minIdle > 0 && now-nack.deliveryTime < minIdle {
+			continue
+		}
+
+		deliveryCount := nack.deliveryCount
+		switch {
+		case retryCount >= 0:
+			deliveryCount = retryCount
+		case !justID:
+			deliveryCount++
+		}
+
+		claim(c, key, group, cg, &consumer, name, id, nack, deliveryTime, deliveryCount)
+		propagateLastID = false
+
+		if justID {
+			result = append(result, MakeBulkValue(id.String()))
+		} else {
+			result = append(result, streamEntryValue(entry))
+		}
+	}
+
+	if propagateLastID {
+		propagateGroupID(c, key, group, cg)
+		keyspace.dirty++
+	}
+
+	return Value{typ: "array", array: result}
+}
+
+// xautoclaimAttemptsFactor bounds how many pending entries XAUTOCLAIM looks
+// at, as a multiple of its COUNT.
+const xautoclaimAttemptsFactor = 10
+
+// xautoclaim claims the pending entries idle for at least min-idle-time,
+// scanning the PEL from start. It replies with the ID to continue the scan
+// from, the claimed entries, and the pending entries it found deleted from
+// the stream and dropped.
+func xautoclaim(c *Client, args []Value) Value {
+	key, group, name := args[0].bulk, args[1].bulk, args[2].bulk
+
+	minIdle, ok := parseInteger(args[3].bulk)
+	if !ok {
+		return NewErr("Invalid min-idle-time argument for XAUTOCLAIM").Value()
+	}
+	minIdle = max(minIdle, 0)
+
+	start, exclusive, ok := parseStreamIntervalID(args[4].bulk, 0)
+	if !ok {
+		return ErrInvalidStreamID.Value()
+	}
+	if exclusive {
+		if start, ok = start.Incr(); !ok {
+			return NewErr("invalid start ID for the interval").Value()
+		}
+	}
+
+	count, justID := int64(100), false
+	for i := 5; i < len(args); i++ {
+		moreArgs := len(args) - 1 - i
+		switch opt := strings.ToUpper(args[i].bulk); {
+		case opt == "COUNT" && moreArgs > 0:
+			i++
+			n, ok := parseInteger(args[i].bulk)
+			if !ok || n < 1 || n > math.MaxInt64/xautoclaimAttemptsFactor {
+				return NewErr("COUNT must be > 0").Value()
+			}
+			count = n
+		case opt == "JUSTID":
+			justID = true
+		default:
+			return ErrSyntax.Value()
+		}
+	}
+
+	stream, cg, err := lookupStreamGroup(key, group)
+	if err != nil {
+		return err.Value()
+	}
+
+	c.preventPropagation()
+
+	now := nowMs()
+	consumer := cg.Consumer(name)
+	claimed, deleted := []Value{}, []Value{}
+
+	i := cg.pel.seek(start)
+	for attempts := count * xautoclaimAttemptsFactor; attempts > 0 && count > 0 && i < cg.pel.Len(); attempts-- {
+		id := cg.pel.ids[i]
+		nack := cg.pel.nacks[id]
+
+		entry, exists := stream.Get(id)
+		if !exists {
+			// Dropping the entry shifts the next one to i.
+			dropDeletedPending(c, key, group, cg, id, nack)
+			deleted = append(deleted, MakeBulkValue(id.String()))
+			count--
+			continue
+		}
+		i++
+
+		if minIdle > 0 && now-nack.deliveryTime < minIdle {
+			continue
+		}
+
+		deliveryCount := nack.deliveryCount
+		if !justID {
+			deliveryCount++
+		}
+		claim(c, key, group, cg, &consumer, name, id, nack, now, deliveryCount)
+		count--
+
+		if justID {
+			claimed = append(claimed, MakeBulkValue(id.String()))
+		} else {
+			claimed = append(claimed, streamEntryValue(entry))
+		}
+	}
+
+	next := StreamID{}
+	if i < cg.pel.Len() {
+		next = cg.pel.ids[i]
+	}
+
+	return Value{typ: "array", array: []Value{
+		MakeBulkValue(next.String()),
+		{typ: "array", array: claimed},
+		{typ: "array", array: deleted},
+	}}
+}
+
+var xinfoHelp = []string{
+	"XINFO <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"CONSUMERS <key> <groupname>",
+	"    Show consumers of <groupname>.",
+	"GROUPS <key>",
+	"    Show the stream consumer groups.",
+	"STREAM <key> [FULL [COUNT <count>]",
+	"    Show information about the stream.",
+	"HELP",
+	"    Print this help.",
+}
+
+func xinfo(c *Client, args []Value) Value {
+	sub := strings.ToUpper(args[0].bulk)
+
+	arity := map[string]int{"HELP": 2, "STREAM": -3, "GROUPS": 3, "CONSUMERS": 4}[sub]
+	if arity == 0 {
+		return NewErr("unknown subcommand '%.128s'. Try XINFO HELP.", args[0].bulk).Value()
+	}
+	if d := (Details{arity: arity}); !d.CheckArity(len(args) + 1) {
+		return ErrWrongArity("xinfo|" + strings.ToLower(sub)).Value()
+	}
+
+	if sub == "HELP" {
+		return helpValue(xinfoHelp)
+	}
+
+	key := args[1].bulk
+	stream, err := lookupStream(key)
+	if err != nil {
+		return err.Value()
+	}
+	if stream == nil {
+		return NewErr("no such key").Value()
+	}
+
+	switch sub {
+	case "CONSUMERS":
+		cg := stream.Group(args[2].bulk)
+		if cg == nil {
+			return NewRespError("NOGROUP", "No such consumer group '%s' for key name '%s'", args[2].bulk, key).Value()
+		}
+		return xinfoConsumers(cg)
+	case "GROUPS":
+		groups := make([]Value, 0, len(stream.groups))
+		for _, name := range stream.groupNames() {
+			cg := stream.groups[name]
+			groups = append(groups, MakeMapValue(
+				MakeBulkValue("name"), MakeBulkValue(name),
+				MakeBulkValue("consumers"), MakeIntValue(len(cg.consumers)),
+				MakeBulkValue("pending"), MakeIntValue(cg.pel.Len()),
+				MakeBulkValue("last-delivered-id"), MakeBulkValue(cg.lastID.String()),
+				MakeBulkValue("entries-read"), entriesReadValue(cg.entriesRead),
+				MakeBulkValue("lag"), lagValue(cg, stream),
+			))
+		}
+		return Value{typ: "array", array: groups}
+	}
+
+	full, count := false, int64(10)
+	switch {
+	case len(args) == 2:
+	case strings.EqualFold(args[2].bulk, "FULL") && len(args) == 3:
+		full = true
+	case strings.EqualFold(args[2].bulk, "FULL") && len(args) == 5 && strings.EqualFold(args[3].bulk, "COUNT"):
+		n, ok := parseInteger(args[4].bulk)
+		if !ok {
+			return ErrNotInteger.Value()
+		}
+		if n < 0 {
+			n = 10
+		}
+		full, count = true, n
+	default:
+		return ErrSyntax.Value()
+	}
+
+	firstID, _ := stream.FirstID()
+	info := []Value{
+		MakeBulkValue("length"), MakeIntValue(stream.Len()),
+		MakeBulkValue("radix-tree-keys"), MakeIntValue(len(stream.nodes)),
+		MakeBulkValue("radix-tree-nodes"), MakeIntValue(len(stream.nodes)),
+		MakeBulkValue("last-generated-id"), MakeBulkValue(stream.lastID.String()),
+		MakeBulkValue("max-deleted-entry-id"), MakeBulkValue(stream.maxDeletedID.String()),
+		MakeBulkValue("entries-added"), MakeIntValue(int(stream.entriesAdded)),
+		MakeBulkValue("recorded-first-entry-id"), MakeBulkValue(firstID.String()),
+	}
+
+	if !full {
+		first, last := MakeNilValue(), MakeNilValue()
+		if entries := stream.Range(StreamID{}, maxStreamID, false, 1); len(entries) > 0 {
+			first = streamEntryValue(&entries[0])
+		}
+		if entries := stream.Range(StreamID{}, maxStreamID, true, 1); len(entries) > 0 {
+			last = streamEntryValue(&entries[0])
+		}
+
+		info = append(info,
+			MakeBulkValue("groups"), MakeIntValue(len(stream.groups)),
+			MakeBulkValue("first-entry"), first,
+			MakeBulkValue("last-entry"), last,
+		)
+		return MakeMapValue(info...)
+	}
+
+	groups := make([]Value, 0, len(stream.groups))
+	for _, name := range stream.groupNames() {
+		groups = append(groups, xinfoGroupFull(stream, name, count))
+	}
+
+	info = append(info,
+		MakeBulkValue("entries"), streamEntriesValue(stream.Range(StreamID{}, maxStreamID, false, int(count))),
+		MakeBulkValue("groups"), Value{typ: "array", array: groups},
+	)
+	return MakeMapValue(info...)
+}
+
+func entriesReadValue(entriesRead int64) Value {
+	if entriesRead == streamInvalidEntriesRead {
+		return MakeNilValue()
+	}
+	return MakeIntValue(int(entriesRead))
+}
+
+func lagValue(cg *streamCG, stream *Stream) Value {
+	lag, ok := cg.lag(stream)
+	if !ok {
+		return MakeNilValue()
+	}
+	return MakeIntValue(int(lag))
+}
+
+func xinfoConsumers(cg *streamCG) Value {
+	now := nowMs()
+
+	consumers := make([]Value, 0, len(cg.consumers))
+	for _, name := range cg.consumerNames() {
+		consumer := cg.consumers[name]
+
+		inactive := int64(-1)
+		if consumer.activeTime != -1 {
+			inactive = now - consumer.activeTime
+		}
+
+		consumers = append(consumers, MakeMapValue(
+			MakeBulkValue("name"), MakeBulkValue(name),
+			MakeBulkValue("pending"), MakeIntValue(consumer.pel.Len()),
+			MakeBulkValue("idle"), MakeIntValue(int(now-consumer.seenTime)),
+			MakeBulkValue("inactive"), MakeIntValue(int(inactive)),
+		))
+	}
+
+	return Value{typ: "array", array: consumers}
+}
+
+// xinfoGroupFull describes a group for XINFO STREAM FULL, with up to count
+// of its pending entries, and of the pending entries of each consumer. A
+// zero count means all of them.
+func xinfoGroupFull(stream *Stream, name string, count int64) Value {
+	cg := stream.groups[name]
+
+	limit := func(ids []StreamID) []StreamID {
+		if count > 0 && int64(len(ids)) > count {
+			return ids[:count]
+		}
+		return ids
+	}
+
+	pending := []Value{}
+	for _, id := range limit(cg.pel.ids) {
+		nack := cg.pel.nacks[id]
+		pending = append(pending, Value{typ: "array", array: []Value{
+			MakeBulkValue(id.String()),
+			MakeBulkValue(nack.consumer.name),
+			MakeIntValue(int(nack.deliveryTime)),
+			MakeIntValue(int(nack.deliveryCount)),
+		}})
+	}
+
+	consumers := []Value{}
+	for _, consumerName := range cg.consumerNames() {
+		consumer := cg.consumers[consumerName]
+
+		consumerPending := []Value{}
+		for _, id := range limit(consumer.pel.ids) {
+			nack := consumer.pel.nacks[id]
+			consumerPending = append(consumerPending, Value{typ: "array", array: []Value{
+				MakeBulkValue(id.String()),
+				MakeIntValue(int(nack.deliveryTime)),
+				MakeIntValue(int(nack.deliveryCount)),
+			}})
+		}
+
+		consumers = append(consumers, MakeMapValue(
+			MakeBulkValue("name"), MakeBulkValue(consumerName),
+			MakeBulkValue("seen-time"), MakeIntValue(int(consumer.seenTime)),
+			MakeBulkValue("active-time"), MakeIntValue(int(consumer.activeTime)),
+			MakeBulkValue("pel-count"), MakeIntValue(consumer.pel.Len()),
+			MakeBulkValue("pending"), Value{typ: "array", array: consumerPending},
+		))
+	}
+
+	return MakeMapValue(
+		MakeBulkValue("name"), MakeBulkValue(name),
+		MakeBulkValue("last-delivered-id"), MakeBulkValue(cg.lastID.String()),
+		MakeBulkValue("entries-read"), entriesReadValue(cg.entriesRead),
+		MakeBulkValue("lag"), lagValue(cg, stream),
+		MakeBulkValue("pel-count"), MakeIntValue(cg.pel.Len()),
+		MakeBulkValue("pending"), Value{typ: "array", array: pending},
+		MakeBulkValue("consumers"), Value{typ: "array", array: consumers},
+	)
+}
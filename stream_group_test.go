@@ -0,0 +1,407 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStreamGroupCommands(t *testing.T) {
+	freezeClock(t, 1000)
+
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{
+			name:     "xgroup create on a missing key",
+			input:    []Value{makeCommand("XGROUP", "CREATE", "group:missing", "g", "$")},
+			expected: "-ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.\r\n",
+		},
+		{
+			name:     "xgroup create mkstream",
+			input:    []Value{makeCommand("XGROUP", "CREATE", "group:mk", "g", "$", "MKSTREAM"), makeCommand("XLEN", "group:mk")},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "xgroup create existing group",
+			input:    []Value{makeCommand("XGROUP", "CREATE", "group:busy", "g", "$", "MKSTREAM"), makeCommand("XGROUP", "CREATE", "group:busy", "g", "$")},
+			expected: "-BUSYGROUP Consumer Group name already exists\r\n",
+		},
+		{
+			name:     "xgroup unknown subcommand",
+			input:    []Value{makeCommand("XGROUP", "FOO")},
+			expected: "-ERR unknown subcommand 'FOO'. Try XGROUP HELP.\r\n",
+		},
+		{
+			name:     "xgroup subcommand arity",
+			input:    []Value{makeCommand("XGROUP", "DESTROY", "group:arity")},
+			expected: "-ERR wrong number of arguments for 'xgroup|destroy' command\r\n",
+		},
+		{
+			name: "xreadgroup new entries",
+			input: []Value{
+				makeCommand("XADD", "group:read", "1", "f", "v"),
+				makeCommand("XADD", "group:read", "2", "f", "v"),
+				makeCommand("XGROUP", "CREATE", "group:read", "g", "0"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "COUNT", "1", "STREAMS", "group:read", ">"),
+			},
+			expected: "*1\r\n*2\r\n$10\r\ngroup:read\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n",
+		},
+		{
+			name: "xreadgroup without new entries",
+			input: []Value{
+				makeCommand("XADD", "group:none", "1", "f", "v"),
+				makeCommand("XGROUP", "CREATE", "group:none", "g", "$"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:none", ">"),
+			},
+			expected: "*-1\r\n",
+		},
+		{
+			name: "xreadgroup history",
+			input: []Value{
+				makeCommand("XADD", "group:history", "1", "f", "v"),
+				makeCommand("XADD", "group:history", "2", "f", "v"),
+				makeCommand("XGROUP", "CREATE", "group:history", "g", "0"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:history", ">"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:history", "1"),
+			},
+			expected: "*1\r\n*2\r\n$13\r\ngroup:history\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n",
+		},
+		{
+			name: "xreadgroup history of another consumer",
+			input: []Value{
+				makeCommand("XADD", "group:other", "1", "f", "v"),
+				makeCommand("XGROUP", "CREATE", "group:other", "g", "0"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:other", ">"),
+				makeCommand("XREADGROUP", "GROUP", "g", "d", "STREAMS", "group:other", "0"),
+			},
+			expected: "*1\r\n*2\r\n$11\r\ngroup:other\r\n*0\r\n",
+		},
+		{
+			name: "xreadgroup history of a deleted entry",
+			input: []Value{
+				makeCommand("XADD", "group:deleted", "1", "f", "v"),
+				makeCommand("XGROUP", "CREATE", "group:deleted", "g", "0"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:deleted", ">"),
+				makeCommand("XDEL", "group:deleted", "1"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:deleted", "0"),
+			},
+			expected: "*1\r\n*2\r\n$13\r\ngroup:deleted\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*-1\r\n",
+		},
+		{
+			name:     "xreadgroup missing group",
+			input:    []Value{makeCommand("XADD", "group:nogroup", "1", "f", "v"), makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:nogroup", ">")},
+			expected: "-NOGROUP No such key 'group:nogroup' or consumer group 'g' in XREADGROUP with GROUP option\r\n",
+		},
+		{
+			name:     "xreadgroup without group",
+			input:    []Value{makeCommand("XREADGROUP", "COUNT", "1", "BLOCK", "0", "STREAMS", "group:nogroup", ">")},
+			expected: "-ERR Missing GROUP option for XREADGROUP\r\n",
+		},
+		{
+			name:     "xreadgroup unbalanced streams",
+			input:    []Value{makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:a", "group:b", ">")},
+			expected: "-ERR Unbalanced 'xreadgroup' list of streams: for each stream key an ID or '>' must be specified.\r\n",
+		},
+		{
+			name:     "xreadgroup with $",
+			input:    []Value{makeCommand("XGROUP", "CREATE", "group:dollar", "g", "$", "MKSTREAM"), makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:dollar", "$")},
+			expected: "-ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.\r\n",
+		},
+		{
+			name:     "xreadgroup negative block",
+			input:    []Value{makeCommand("XREADGROUP", "GROUP", "g", "c", "BLOCK", "-1", "STREAMS", "group:block", ">")},
+			expected: "-ERR timeout is negative\r\n",
+		},
+		{
+			name: "xreadgroup noack",
+			input: []Value{
+				makeCommand("XADD", "group:noack", "1", "f", "v"),
+				makeCommand("XGROUP", "CREATE", "group:noack", "g", "0"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "NOACK", "STREAMS", "group:noack", ">"),
+				makeCommand("XPENDING", "group:noack", "g"),
+			},
+			expected: "*4\r\n:0\r\n$-1\r\n$-1\r\n*-1\r\n",
+		},
+		{
+			name: "xgroup setid rereads",
+			input: []Value{
+				makeCommand("XADD", "group:setid", "1", "f", "v"),
+				makeCommand("XGROUP", "CREATE", "group:setid", "g", "$"),
+				makeCommand("XGROUP", "SETID", "group:setid", "g", "0"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:setid", ">"),
+			},
+			expected: "*1\r\n*2\r\n$11\r\ngroup:setid\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n",
+		},
+		{
+			name: "xack",
+			input: []Value{
+				makeCommand("XADD", "group:ack", "1", "f", "v"),
+				makeCommand("XGROUP", "CREATE", "group:ack", "g", "0"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:ack", ">"),
+				makeCommand("XACK", "group:ack", "g", "1", "2"),
+			},
+			expected: ":1\r\n",
+		},
+		{
+			name: "xpending summary",
+			input: []Value{
+				makeCommand("XADD", "group:pending", "1", "f", "v"),
+				makeCommand("XADD", "group:pending", "2", "f", "v"),
+				makeCommand("XGROUP", "CREATE", "group:pending", "g", "0"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:pending", ">"),
+				makeCommand("XPENDING", "group:pending", "g"),
+			},
+			expected: "*4\r\n:2\r\n$3\r\n1-0\r\n$3\r\n2-0\r\n*1\r\n*2\r\n$1\r\nc\r\n$1\r\n2\r\n",
+		},
+		{
+			name: "xpending range",
+			input: []Value{
+				makeCommand("XADD", "group:prange", "1", "f", "v"),
+				makeCommand("XADD", "group:prange", "2", "f", "v"),
+				makeCommand("XGROUP", "CREATE", "group:prange", "g", "0"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:prange", ">"),
+				makeCommand("XPENDING", "group:prange", "g", "(1", "+", "10", "c"),
+			},
+			expected: "*1\r\n*4\r\n$3\r\n2-0\r\n$1\r\nc\r\n:0\r\n:1\r\n",
+		},
+		{
+			name:     "xpending idle without count",
+			input:    []Value{makeCommand("XPENDING", "group:pmissing", "g", "IDLE", "x", "-", "+")},
+			expected: "-ERR syntax error\r\n",
+		},
+		{
+			name:     "xpending invalid idle",
+			input:    []Value{makeCommand("XPENDING", "group:pmissing", "g", "IDLE", "x", "-", "+", "10")},
+			expected: "-ERR value is not an integer or out of range\r\n",
+		},
+		{
+			name:     "xpending missing group",
+			input:    []Value{makeCommand("XPENDING", "group:pmissing", "g")},
+			expected: "-NOGROUP No such key 'group:pmissing' or consumer group 'g'\r\n",
+		},
+		{
+			name: "xclaim",
+			input: []Value{
+				makeCommand("XADD", "group:claim", "1", "f", "v"),
+				makeCommand("XGROUP", "CREATE", "group:claim", "g", "0"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:claim", ">"),
+				makeCommand("XCLAIM", "group:claim", "g", "d", "0", "1", "JUSTID"),
+				makeCommand("XPENDING", "group:claim", "g", "-", "+", "10"),
+			},
+			expected: "*1\r\n*4\r\n$3\r\n1-0\r\n$1\r\nd\r\n:0\r\n:1\r\n",
+		},
+		{
+			name: "xclaim not idle enough",
+			input: []Value{
+				makeCommand("XADD", "group:idle", "1", "f", "v"),
+				makeCommand("XGROUP", "CREATE", "group:idle", "g", "0"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:idle", ">"),
+				makeCommand("XCLAIM", "group:idle", "g", "d", "100", "1"),
+			},
+			expected: "*0\r\n",
+		},
+		{
+			name:     "xclaim unknown option",
+			input:    []Value{makeCommand("XGROUP", "CREATE", "group:copt", "g", "$", "MKSTREAM"), makeCommand("XCLAIM", "group:copt", "g", "d", "0", "1", "FOO")},
+			expected: "-ERR Unrecognized XCLAIM option 'FOO'\r\n",
+		},
+		{
+			name: "xautoclaim",
+			input: []Value{
+				makeCommand("XADD", "group:auto", "1", "f", "v"),
+				makeCommand("XADD", "group:auto", "2", "f", "v"),
+				makeCommand("XADD", "group:auto", "3", "f", "v"),
+				makeCommand("XGROUP", "CREATE", "group:auto", "g", "0"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:auto", ">"),
+				makeCommand("XDEL", "group:auto", "1"),
+				makeCommand("XAUTOCLAIM", "group:auto", "g", "d", "0", "0", "COUNT", "2", "JUSTID"),
+			},
+			expected: "*3\r\n$3\r\n3-0\r\n*1\r\n$3\r\n2-0\r\n*1\r\n$3\r\n1-0\r\n",
+		},
+		{
+			name:     "xautoclaim zero count",
+			input:    []Value{makeCommand("XAUTOCLAIM", "group:auto", "g", "d", "0", "0", "COUNT", "0")},
+			expected: "-ERR COUNT must be > 0\r\n",
+		},
+		{
+			name: "xgroup delconsumer",
+			input: []Value{
+				makeCommand("XADD", "group:delc", "1", "f", "v"),
+				makeCommand("XGROUP", "CREATE", "group:delc", "g", "0"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:delc", ">"),
+				makeCommand("XGROUP", "DELCONSUMER", "group:delc", "g", "c"),
+			},
+			expected: ":1\r\n",
+		},
+		{
+			name: "xinfo groups",
+			input: []Value{
+				makeCommand("XADD", "group:info", "1", "f", "v"),
+				makeCommand("XADD", "group:info", "2", "f", "v"),
+				makeCommand("XGROUP", "CREATE", "group:info", "g", "0"),
+				makeCommand("XREADGROUP", "GROUP", "g", "c", "COUNT", "1", "STREAMS", "group:info", ">"),
+				makeCommand("XINFO", "GROUPS", "group:info"),
+			},
+			expected: "*1\r\n*12\r\n$4\r\nname\r\n$1\r\ng\r\n$9\r\nconsumers\r\n:1\r\n$7\r\npending\r\n:1\r\n" +
+				"$17\r\nlast-delivered-id\r\n$3\r\n1-0\r\n$12\r\nentries-read\r\n:1\r\n$3\r\nlag\r\n:1\r\n",
+		},
+		{
+			name: "xinfo consumers",
+			input: []Value{
+				makeCommand("XGROUP", "CREATE", "group:cinfo", "g", "$", "MKSTREAM"),
+				makeCommand("XGROUP", "CREATECONSUMER", "group:cinfo", "g", "c"),
+				makeCommand("XINFO", "CONSUMERS", "group:cinfo", "g"),
+			},
+			expected: "*1\r\n*8\r\n$4\r\nname\r\n$1\r\nc\r\n$7\r\npending\r\n:0\r\n$4\r\nidle\r\n:0\r\n$8\r\ninactive\r\n:-1\r\n",
+		},
+		{
+			name:     "xinfo on a missing key",
+			input:    []Value{makeCommand("XINFO", "STREAM", "group:nokey")},
+			expected: "-ERR no such key\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCommands(t, tt.input...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestStreamGroupPropagation(t *testing.T) {
+	freezeClock(t, 1000)
+
+	logged := propagated(t,
+		makeCommand("XADD", "group:aof", "1", "f", "v"),
+		makeCommand("XADD", "group:aof", "2", "f", "v"),
+		makeCommand("XGROUP", "CREATE", "group:aof", "g", "0"),
+		makeCommand("XREADGROUP", "GROUP", "g", "c", "COUNT", "1", "STREAMS", "group:aof", ">"),
+		makeCommand("XREADGROUP", "GROUP", "g", "c", "NOACK", "STREAMS", "group:aof", ">"),
+		makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:aof", ">"),
+		makeCommand("XCLAIM", "group:aof", "g", "d", "0", "1", "JUSTID"),
+		makeCommand("XACK", "group:aof", "g", "1"),
+	)
+
+	expected := []Value{
+		makeCommand("XADD", "group:aof", "1-0", "f", "v"),
+		makeCommand("XADD", "group:aof", "2-0", "f", "v"),
+		makeCommand("XGROUP", "CREATE", "group:aof", "g", "0"),
+		makeCommand("XGROUP", "CREATECONSUMER", "group:aof", "g", "c"),
+		makeCommand("XCLAIM", "group:aof", "g", "c", "0", "1-0", "TIME", "1000", "RETRYCOUNT", "1", "FORCE", "JUSTID", "LASTID", "1-0"),
+		makeCommand("XGROUP", "SETID", "group:aof", "g", "1-0", "ENTRIESREAD", "1"),
+		makeCommand("XGROUP", "SETID", "group:aof", "g", "2-0", "ENTRIESREAD", "2"),
+		makeCommand("XCLAIM", "group:aof", "g", "d", "0", "1-0", "TIME", "1000", "RETRYCOUNT", "1", "FORCE", "JUSTID", "LASTID", "2-0"),
+		makeCommand("XACK", "group:aof", "g", "1"),
+	}
+	assertPropagated(t, logged, expected)
+}
+
+// TestStreamGroupReplay checks that replaying what the group commands
+// propagated recreates the same groups, consumers and pending entries.
+func TestStreamGroupReplay(t *testing.T) {
+	freezeClock(t, 1000)
+
+	logged := propagated(t,
+		makeCommand("XADD", "group:replay", "1", "f", "v"),
+		makeCommand("XADD", "group:replay", "2", "f", "v"),
+		makeCommand("XADD", "group:replay", "3", "f", "v"),
+		makeCommand("XGROUP", "CREATE", "group:replay", "g", "0"),
+		makeCommand("XGROUP", "CREATE", "group:replay", "h", "$"),
+		makeCommand("XREADGROUP", "GROUP", "g", "c", "COUNT", "2", "STREAMS", "group:replay", ">"),
+		makeCommand("XREADGROUP", "GROUP", "g", "c", "STREAMS", "group:replay", "0"),
+		makeCommand("XCLAIM", "group:replay", "g", "d", "0", "2", "IDLE", "500"),
+		makeCommand("XDEL", "group:replay", "1"),
+		makeCommand("XAUTOCLAIM", "group:replay", "g", "e", "0", "0", "COUNT", "1"),
+	)
+
+	info := makeCommand("XINFO", "STREAM", "group:replay", "FULL")
+	before := runCommands(t, info)
+
+	keyspace.mutex.Lock()
+	keyspace.Delete("group:replay")
+	keyspace.mutex.Unlock()
+
+	after := runCommands(t, append(logged, info)...)
+	if after != before {
+		t.Errorf("expected the replay to recreate %q, got %q", before, after)
+	}
+}
+
+func TestBlockingXReadGroup(t *testing.T) {
+	runCommands(t, makeCommand("XGROUP", "CREATE", "group:block", "g", "$", "MKSTREAM"))
+	reply := blockOn(t, NewCommandHandler(), makeCommand("XREADGROUP", "GROUP", "g", "c", "BLOCK", "0", "STREAMS", "group:block", ">"))
+
+	runCommands(t, makeCommand("XADD", "group:block", "1", "f", "v"))
+
+	expected := "*1\r\n*2\r\n$11\r\ngroup:block\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n"
+	if result := waitReply(t, reply); result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+
+	// The entry is pending for the consumer that was served.
+	result := runCommands(t, makeCommand("XPENDING", "group:block", "g", "-", "+", "10", "c"))
+	if expected := "*1\r\n*4\r\n$3\r\n1-0\r\n$1\r\nc\r\n"; len(result) < len(expected) || result[:len(expected)] != expected {
+		t.Errorf("expected the entry pending for c, got %q", result)
+	}
+}
+
+func TestBlockingXReadGroupDestroyed(t *testing.T) {
+	runCommands(t, makeCommand("XGROUP", "CREATE", "group:destroy", "g", "$", "MKSTREAM"))
+	reply := blockOn(t, NewCommandHandler(), makeCommand("XREADGROUP", "GROUP", "g", "c", "BLOCK", "0", "STREAMS", "group:destroy", ">"))
+
+	runCommands(t, makeCommand("XGROUP", "DESTROY", "group:destroy", "g"))
+
+	expected := "-NOGROUP No such key 'group:destroy' or consumer group 'g' in XREADGROUP with GROUP option\r\n"
+	if result := waitReply(t, reply); result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestBlockingXReadGroupPropagation(t *testing.T) {
+	freezeClock(t, 1000)
+
+	path := filepath.Join(t.TempDir(), "test.aof")
+	aof, err := NewAof(path)
+	if err != nil {
+		t.Fatalf("failed to create aof: %v", err)
+	}
+
+	runCommands(t, makeCommand("XGROUP", "CREATE", "group:baof", "g", "$", "MKSTREAM"))
+
+	blocked := NewCommandHandler()
+	blocked.aof = aof
+	served := blockOn(t, blocked, makeCommand("XREADGROUP", "GROUP", "g", "c", "BLOCK", "0", "STREAMS", "group:baof", ">"))
+
+	adder := NewCommandHandler()
+	adder.aof = aof
+	add := makeCommand("XADD", "group:baof", "1", "f", "v")
+	if _, err := adder.Handle(add.array[0].bulk, add.array[1:]); err != nil {
+		t.Fatal(err)
+	}
+	waitReply(t, served)
+	aof.Close()
+
+	aof, err = NewAof(path)
+	if err != nil {
+		t.Fatalf("failed to open aof: %v", err)
+	}
+	defer aof.Close()
+
+	var logged []Value
+	aof.Read(func(value Value) {
+		logged = append(logged, value)
+	})
+
+	expected := []Value{
+		makeCommand("XGROUP", "CREATECONSUMER", "group:baof", "g", "c"),
+		makeCommand("XADD", "group:baof", "1-0", "f", "v"),
+		makeCommand("XCLAIM", "group:baof", "g", "c", "0", "1-0", "TIME", "1000", "RETRYCOUNT", "1", "FORCE", "JUSTID", "LASTID", "1-0"),
+		makeCommand("XGROUP", "SETID", "group:baof", "g", "1-0", "ENTRIESREAD", "1"),
+	}
+	assertPropagated(t, logged, expected)
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestStreamCommands(t *testing.T) {
+	freezeClock(t, 1000)
+
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{name: "xadd explicit id", input: []Value{makeCommand("XADD", "stream:add", "1-1", "f", "v")}, expected: "$3\r\n1-1\r\n"},
+		{name: "xadd auto id", input: []Value{makeCommand("XADD", "stream:auto", "*", "f", "v")}, expected: "$6\r\n1000-0\r\n"},
+		{
+			name:     "xadd auto id after a future id",
+			input:    []Value{makeCommand("XADD", "stream:future", "2000-5", "f", "v"), makeCommand("XADD", "stream:future", "*", "f", "v")},
+			expected: "$6\r\n2000-6\r\n",
+		},
+		{
+			name:     "xadd auto sequence",
+			input:    []Value{makeCommand("XADD", "stream:seq", "5-3", "f", "v"), makeCommand("XADD", "stream:seq", "5-*", "f", "v")},
+			expected: "$3\r\n5-4\r\n",
+		},
+		{name: "xadd incomplete id", input: []Value{makeCommand("XADD", "stream:ms", "7", "f", "v")}, expected: "$3\r\n7-0\r\n"},
+		{
+			name:     "xadd smaller id",
+			input:    []Value{makeCommand("XADD", "stream:smaller", "5-0", "f", "v"), makeCommand("XADD", "stream:smaller", "4-*", "f", "v")},
+			expected: "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n",
+		},
+		{name: "xadd 0-0", input: []Value{makeCommand("XADD", "stream:zero", "0-0", "f", "v")}, expected: "-ERR The ID specified in XADD must be greater than 0-0\r\n"},
+		{name: "xadd invalid id", input: []Value{makeCommand("XADD", "stream:bad", "1-x", "f", "v")}, expected: "-ERR Invalid stream ID specified as stream command argument\r\n"},
+		{name: "xadd odd fields", input: []Value{makeCommand("XADD", "stream:odd", "*", "f", "v", "g")}, expected: "-ERR wrong number of arguments for 'xadd' command\r\n"},
+		{
+			name:     "xadd exhausted stream",
+			input:    []Value{makeCommand("XADD", "stream:max", "18446744073709551615-18446744073709551615", "f", "v"), makeCommand("XADD", "stream:max", "*", "f", "v")},
+			expected: "-ERR The stream has exhausted the last possible ID, unable to add more items\r\n",
+		},
+		{
+			name:     "xadd nomkstream",
+			input:    []Value{makeCommand("XADD", "stream:nomk", "NOMKSTREAM", "*", "f", "v"), makeCommand("TYPE", "stream:nomk")},
+			expected: "+none\r\n",
+		},
+		{
+			name: "xadd maxlen",
+			input: []Value{
+				makeCommand("XADD", "stream:maxlen", "1", "f", "v"),
+				makeCommand("XADD", "stream:maxlen", "2", "f", "v"),
+				makeCommand("XADD", "stream:maxlen", "MAXLEN", "1", "3", "f", "v"),
+				makeCommand("XRANGE", "stream:maxlen", "-", "+"),
+			},
+			expected: "*1\r\n*2\r\n$3\r\n3-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n",
+		},
+		{
+			name:     "xadd minid",
+			input:    []Value{makeCommand("XADD", "stream:minid", "1", "f", "v"), makeCommand("XADD", "stream:minid", "MINID", "=", "2", "2", "f", "v"), makeCommand("XLEN", "stream:minid")},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "xadd limit without tilde",
+			input:    []Value{makeCommand("XADD", "stream:limit", "MAXLEN", "1", "LIMIT", "10", "*", "f", "v")},
+			expected: "-ERR syntax error, LIMIT cannot be used without the special ~ option\r\n",
+		},
+		{
+			name:     "xadd maxlen and minid",
+			input:    []Value{makeCommand("XADD", "stream:both", "MAXLEN", "1", "MINID", "1", "*", "f", "v")},
+			expected: "-ERR syntax error, MAXLEN and MINID options at the same time are not compatible\r\n",
+		},
+		{name: "xadd negative maxlen", input: []Value{makeCommand("XADD", "stream:neg", "MAXLEN", "-1", "*", "f", "v")}, expected: "-ERR The MAXLEN argument must be >= 0.\r\n"},
+		{
+			name: "xrange",
+			input: []Value{
+				makeCommand("XADD", "stream:range", "1-0", "a", "1"),
+				makeCommand("XADD", "stream:range", "1-1", "b", "2"),
+				makeCommand("XADD", "stream:range", "2-0", "c", "3"),
+				makeCommand("XRANGE", "stream:range", "1", "1"),
+			},
+			expected: "*2\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		},
+		{
+			name: "xrange exclusive with count",
+			input: []Value{
+				makeCommand("XADD", "stream:range2", "1-0", "a", "1"),
+				makeCommand("XADD", "stream:range2", "1-1", "b", "2"),
+				makeCommand("XADD", "stream:range2", "2-0", "c", "3"),
+				makeCommand("XRANGE", "stream:range2", "(1-0", "+", "COUNT", "1"),
+			},
+			expected: "*1\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		},
+		{
+			name: "xrevrange",
+			input: []Value{
+				makeCommand("XADD", "stream:rev", "1-0", "a", "1"),
+				makeCommand("XADD", "stream:rev", "2-0", "b", "2"),
+				makeCommand("XREVRANGE", "stream:rev", "+", "-", "COUNT", "1"),
+			},
+			expected: "*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		},
+		{name: "xrange missing key", input: []Value{makeCommand("XRANGE", "stream:missing", "-", "+")}, expected: "*0\r\n"},
+		{name: "xrange missing key zero count", input: []Value{makeCommand("XRANGE", "stream:missing", "-", "+", "COUNT", "0")}, expected: "*0\r\n"},
+		{name: "xrange missing key invalid count", input: []Value{makeCommand("XRANGE", "stream:missing", "-", "+", "COUNT", "x")}, expected: "-ERR value is not an integer or out of range\r\n"},
+		{
+			name:     "xrange zero count",
+			input:    []Value{makeCommand("XADD", "stream:count0", "1-1", "f", "v"), makeCommand("XRANGE", "stream:count0", "-", "+", "COUNT", "0")},
+			expected: "*-1\r\n",
+		},
+		{name: "xrange exclusive max", input: []Value{makeCommand("XRANGE", "stream:missing", "(18446744073709551615-18446744073709551615", "+")}, expected: "-ERR invalid start ID for the interval\r\n"},
+		{name: "xrange exclusive special id", input: []Value{makeCommand("XRANGE", "stream:missing", "(-", "+")}, expected: "-ERR Invalid stream ID specified as stream command argument\r\n"},
+		{
+			name: "xdel",
+			input: []Value{
+				makeCommand("XADD", "stream:del", "1", "f", "v"),
+				makeCommand("XADD", "stream:del", "2", "f", "v"),
+				makeCommand("XDEL", "stream:del", "1", "3"),
+			},
+			expected: ":1\r\n",
+		},
+		{
+			name: "xdel keeps the last id",
+			input: []Value{
+				makeCommand("XADD", "stream:del2", "5", "f", "v"),
+				makeCommand("XDEL", "stream:del2", "5"),
+				makeCommand("XADD", "stream:del2", "5", "f", "v"),
+			},
+			expected: "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n",
+		},
+		{
+			name:     "empty stream is kept",
+			input:    []Value{makeCommand("XADD", "stream:empty", "1", "f", "v"), makeCommand("XDEL", "stream:empty", "1"), makeCommand("TYPE", "stream:empty")},
+			expected: "+stream\r\n",
+		},
+		{
+			name: "xtrim",
+			input: []Value{
+				makeCommand("XADD", "stream:trim", "1", "f", "v"),
+				makeCommand("XADD", "stream:trim", "2", "f", "v"),
+				makeCommand("XADD", "stream:trim", "3", "f", "v"),
+				makeCommand("XTRIM", "stream:trim", "MINID", "3"),
+			},
+			expected: ":2\r\n",
+		},
+		{name: "xtrim without strategy", input: []Value{makeCommand("XTRIM", "stream:trim2", "LIMIT", "1")}, expected: "-ERR syntax error, LIMIT cannot be used without specifying a trimming strategy\r\n"},
+		{
+			name:     "xlen on wrong type",
+			input:    []Value{makeCommand("SET", "stream:str", "v"), makeCommand("XLEN", "stream:str")},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCommands(t, tt.input...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestStreamNodes(t *testing.T) {
+	s := NewStream()
+	n := 3*streamNodeMaxEntries + 10
+	for i := 1; i <= n; i++ {
+		s.Append(StreamID{ms: uint64(i)}, []string{"i", strconv.Itoa(i)})
+	}
+
+	if len(s.nodes) != 4 {
+		t.Fatalf("expected 4 nodes, got %d", len(s.nodes))
+	}
+
+	// Deleting a whole node removes it.
+	for i := 1; i <= streamNodeMaxEntries; i++ {
+		s.Delete(StreamID{ms: uint64(i)})
+	}
+	if len(s.nodes) != 3 || s.Len() != n-streamNodeMaxEntries {
+		t.Fatalf("expected 3 nodes and %d entries, got %d and %d", n-streamNodeMaxEntries, len(s.nodes), s.Len())
+	}
+
+	s.Delete(StreamID{ms: 150})
+	entries := s.Range(StreamID{ms: 149}, StreamID{ms: 151}, false, 0)
+	if len(entries) != 2 || entries[0].id.ms != 149 || entries[1].id.ms != 151 {
+		t.Errorf("expected 149 and 151 around the deleted entry, got %v", entries)
+	}
+
+	entries = s.Range(StreamID{}, StreamID{ms: 202}, true, 3)
+	if len(entries) != 3 || entries[0].id.ms != 202 || entries[2].id.ms != 200 {
+		t.Errorf("expected 202 down to 200 across nodes, got %v", entries)
+	}
+
+	if id, _ := s.FirstID(); id.ms != streamNodeMaxEntries+1 {
+		t.Errorf("expected the first ID to be %d, got %v", streamNodeMaxEntries+1, id)
+	}
+}
+
+func TestStreamTrim(t *testing.T) {
+	newStream := func() *Stream {
+		s := NewStream()
+		for i := 1; i <= 3*streamNodeMaxEntries; i++ {
+			s.Append(StreamID{ms: uint64(i)}, []string{"f", "v"})
+		}
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		args    streamAddTrimArgs
+		deleted int64
+	}{
+		{name: "exact maxlen", args: streamAddTrimArgs{strategy: streamTrimMaxLen, maxLen: 150}, deleted: 150},
+		{name: "approximate maxlen keeps whole nodes", args: streamAddTrimArgs{strategy: streamTrimMaxLen, maxLen: 150, approx: true}, deleted: 100},
+		{name: "approximate maxlen with limit", args: streamAddTrimArgs{strategy: streamTrimMaxLen, maxLen: 0, approx: true, limit: 150}, deleted: 100},
+		{name: "exact minid", args: streamAddTrimArgs{strategy: streamTrimMinID, minID: StreamID{ms: 251}}, deleted: 250},
+		{name: "approximate minid", args: streamAddTrimArgs{strategy: streamTrimMinID, minID: StreamID{ms: 251}, approx: true}, deleted: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStream()
+			if deleted := s.Trim(&tt.args); deleted != tt.deleted {
+				t.Fatalf("expected %d deleted, got %d", tt.deleted, deleted)
+			}
+			if s.Len() != 3*streamNodeMaxEntries-int(tt.deleted) {
+				t.Errorf("expected %d entries left, got %d", 3*streamNodeMaxEntries-int(tt.deleted), s.Len())
+			}
+		})
+	}
+}
+
+func TestStreamPropagation(t *testing.T) {
+	freezeClock(t, 1000)
+
+	inputs := []Value{
+		makeCommand("XADD", "stream:aof", "*", "f", "v"),
+		makeCommand("XADD", "stream:aof", "1000-*", "f", "v"),
+	}
+	for i := 0; i < streamNodeMaxEntries; i++ {
+		inputs = append(inputs, makeCommand("XADD", "stream:aof", "*", "f", "v"))
+	}
+	inputs = append(inputs,
+		makeCommand("XADD", "stream:aof", "MAXLEN", "~", "2", "LIMIT", "500", "*", "f", "v"),
+		makeCommand("XTRIM", "stream:aof", "MAXLEN", "~", "0"),
+	)
+
+	logged := propagated(t, inputs...)
+
+	assertPropagated(t, logged[:2], []Value{
+		makeCommand("XADD", "stream:aof", "1000-0", "f", "v"),
+		makeCommand("XADD", "stream:aof", "1000-1", "f", "v"),
+	})
+
+	// The approximate trims are propagated as the exact ones they amounted
+	// to: XADD only removed the first full node, and XTRIM the last one.
+	assertPropagated(t, logged[len(logged)-2:], []Value{
+		makeCommand("XADD", "stream:aof", "MAXLEN", "=", "3", "1000-102", "f", "v"),
+		makeCommand("XTRIM", "stream:aof", "MAXLEN", "=", "0"),
+	})
+}
+
+func TestStreamRead(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{
+			name: "xread after an id",
+			input: []Value{
+				makeCommand("XADD", "stream:read", "1", "f", "v"),
+				makeCommand("XADD", "stream:read", "2", "f", "v"),
+				makeCommand("XREAD", "STREAMS", "stream:read", "1"),
+			},
+			expected: "*1\r\n*2\r\n$11\r\nstream:read\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n",
+		},
+		{
+			name: "xread count",
+			input: []Value{
+				makeCommand("XADD", "stream:rcount", "1", "f", "v"),
+				makeCommand("XADD", "stream:rcount", "2", "f", "v"),
+				makeCommand("XREAD", "COUNT", "1", "STREAMS", "stream:rcount", "0"),
+			},
+			expected: "*1\r\n*2\r\n$13\r\nstream:rcount\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n",
+		},
+		{
+			name: "xread several streams",
+			input: []Value{
+				makeCommand("XADD", "stream:ra", "1", "f", "v"),
+				makeCommand("XADD", "stream:rb", "2", "g", "w"),
+				makeCommand("XREAD", "STREAMS", "stream:ra", "stream:rmissing", "stream:rb", "0", "0", "0"),
+			},
+			expected: "*2\r\n*2\r\n$9\r\nstream:ra\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n" +
+				"*2\r\n$9\r\nstream:rb\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\ng\r\n$1\r\nw\r\n",
+		},
+		{
+			name:     "xread $",
+			input:    []Value{makeCommand("XADD", "stream:rdollar", "1", "f", "v"), makeCommand("XREAD", "STREAMS", "stream:rdollar", "$")},
+			expected: "*-1\r\n",
+		},
+		{
+			name: "xread +",
+			input: []Value{
+				makeCommand("XADD", "stream:rplus", "1", "f", "v"),
+				makeCommand("XADD", "stream:rplus", "2", "g", "w"),
+				makeCommand("XREAD", "STREAMS", "stream:rplus", "+"),
+			},
+			expected: "*1\r\n*2\r\n$12\r\nstream:rplus\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\ng\r\n$1\r\nw\r\n",
+		},
+		{
+			name: "xread + after the last entry was deleted",
+			input: []Value{
+				makeCommand("XADD", "stream:rplus2", "1", "f", "v"),
+				makeCommand("XADD", "stream:rplus2", "2", "g", "w"),
+				makeCommand("XDEL", "stream:rplus2", "2"),
+				makeCommand("XREAD", "STREAMS", "stream:rplus2", "+"),
+			},
+			expected: "*1\r\n*2\r\n$13\r\nstream:rplus2\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n",
+		},
+		{
+			name: "xread + on a stream with every entry deleted",
+			input: []Value{
+				makeCommand("XADD", "stream:rplus3", "1", "f", "v"),
+				makeCommand("XDEL", "stream:rplus3", "1"),
+				makeCommand("XREAD", "STREAMS", "stream:rplus3", "+"),
+			},
+			expected: "*-1\r\n",
+		},
+		{name: "xread + on a missing key", input: []Value{makeCommand("XREAD", "STREAMS", "stream:rnone", "+")}, expected: "*-1\r\n"},
+		{
+			name:     "xread >",
+			input:    []Value{makeCommand("XREAD", "STREAMS", "stream:rgt", ">")},
+			expected: "-ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.\r\n",
+		},
+		{
+			name:     "xread unbalanced streams",
+			input:    []Value{makeCommand("XREAD", "STREAMS", "stream:ra", "stream:rb", "0")},
+			expected: "-ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.\r\n",
+		},
+		{name: "xread group option", input: []Value{makeCommand("XREAD", "GROUP", "g", "c", "STREAMS", "stream:ra", "0")}, expected: "-ERR syntax error\r\n"},
+		{name: "xread invalid id", input: []Value{makeCommand("XREAD", "STREAMS", "stream:ra", "x")}, expected: "-ERR Invalid stream ID specified as stream command argument\r\n"},
+		{name: "xread invalid block", input: []Value{makeCommand("XREAD", "BLOCK", "x", "STREAMS", "stream:ra", "0")}, expected: "-ERR timeout is not an integer or out of range\r\n"},
+		{
+			name:     "xread on a string",
+			input:    []Value{makeCommand("SET", "stream:rstr", "v"), makeCommand("XREAD", "STREAMS", "stream:rstr", "0")},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCommands(t, tt.input...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestBlockingXRead(t *testing.T) {
+	runCommands(t, makeCommand("XADD", "stream:bdollar", "1", "f", "v"))
+	reply := blockOn(t, NewCommandHandler(), makeCommand("XREAD", "BLOCK", "0", "STREAMS", "stream:bmissing", "stream:bdollar", "0", "$"))
+
+	runCommands(t, makeCommand("XADD", "stream:bdollar", "2", "g", "w"))
+
+	// "$" only waits for the entries added after the client blocked.
+	expected := "*1\r\n*2\r\n$14\r\nstream:bdollar\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\ng\r\n$1\r\nw\r\n"
+	if result := waitReply(t, reply); result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestBlockingXReadBehindListWaiter(t *testing.T) {
+	lpop := blockOn(t, NewCommandHandler(), makeCommand("BLPOP", "stream:bmixed", "0"))
+	xread := blockOn(t, NewCommandHandler(), makeCommand("XREAD", "BLOCK", "0", "STREAMS", "stream:bmixed", "0"))
+
+	runCommands(t, makeCommand("XADD", "stream:bmixed", "1", "f", "v"))
+	expected := "*1\r\n*2\r\n$13\r\nstream:bmixed\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n"
+	if result := waitReply(t, xread); result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+
+	runCommands(t, makeCommand("DEL", "stream:bmixed"), makeCommand("RPUSH", "stream:bmixed", "a"))
+	if result, expected := waitReply(t, lpop), "*2\r\n$13\r\nstream:bmixed\r\n$1\r\na\r\n"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestBlockingXReadSeveralClients(t *testing.T) {
+	runCommands(t, makeCommand("XADD", "stream:bmany", "5", "f", "v"))
+	behind := blockOn(t, NewCommandHandler(), makeCommand("XREAD", "BLOCK", "0", "STREAMS", "stream:bmany", "$"))
+	ahead := blockOn(t, NewCommandHandler(), makeCommand("XREAD", "BLOCK", "0", "STREAMS", "stream:bmany", "10"))
+
+	runCommands(t, makeCommand("XADD", "stream:bmany", "6", "f", "v"))
+
+	// The client waiting for later IDs stays blocked, without keeping the
+	// one after it from being served.
+	expected := "*1\r\n*2\r\n$12\r\nstream:bmany\r\n*1\r\n*2\r\n$3\r\n6-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n"
+	if result := waitReply(t, behind); result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+
+	runCommands(t, makeCommand("XADD", "stream:bmany", "11", "f", "v"))
+	expected = "*1\r\n*2\r\n$12\r\nstream:bmany\r\n*1\r\n*2\r\n$4\r\n11-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n"
+	if result := waitReply(t, ahead); result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestBlockingXReadTimeout(t *testing.T) {
+	reply := blockOn(t, NewCommandHandler(), makeCommand("XREAD", "BLOCK", "10", "STREAMS", "stream:btimeout", "$"))
+
+	if result, expected := waitReply(t, reply), "*-1\r\n"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
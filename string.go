@@ -0,0 +1,999 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+func registerStringCommands(commands map[string]Command) {
+	commands["SET"] = Command{
+		details: Details{
+			name:              "set",
+			arity:             -3,
+			flags:             []string{"write", "denyoom"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@string", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: set,
+	}
+
+	commands["GET"] = Command{
+		details: Details{
+			name:              "get",
+			arity:             2,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@string", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: get,
+	}
+
+	commands["SETNX"] = Command{
+		details: Details{
+			name:              "setnx",
+			arity:             3,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@string", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: setnx,
+	}
+
+	commands["SETEX"] = Command{
+		details: Details{
+			name:              "setex",
+			arity:             4,
+			flags:             []string{"write", "denyoom"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@string", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: setex,
+	}
+
+	commands["PSETEX"] = Command{
+		details: Details{
+			name:              "psetex",
+			arity:             4,
+			flags:             []string{"write", "denyoom"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@string", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: psetex,
+	}
+
+	commands["GETSET"] = Command{
+		details: Details{
+			name:              "getset",
+			arity:             3,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@string", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: getset,
+	}
+
+	commands["GETDEL"] = Command{
+		details: Details{
+			name:              "getdel",
+			arity:             2,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@string", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: getdel,
+	}
+
+	commands["GETEX"] = Command{
+		details: Details{
+			name:              "getex",
+			arity:             -2,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@string", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: getex,
+	}
+
+	commands["APPEND"] = Command{
+		details: Details{
+			name:              "append",
+			arity:             3,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@string", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: appendCommand,
+	}
+
+	commands["STRLEN"] = Command{
+		details: Details{
+			name:              "strlen",
+			arity:             2,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@string", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: strlen,
+	}
+
+	commands["GETRANGE"] = Command{
+		details: Details{
+			name:              "getrange",
+			arity:             4,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@string", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: getrange,
+	}
+
+	commands["SETRANGE"] = Command{
+		details: Details{
+			name:              "setrange",
+			arity:             4,
+			flags:             []string{"write", "denyoom"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@string", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: setrange,
+	}
+
+	commands["MSET"] = Command{
+		details: Details{
+			name:              "mset",
+			arity:             -3,
+			flags:             []string{"write", "denyoom"},
+			firstKey:          1,
+			lastKey:           -1,
+			step:              2,
+			aclCategories:     []string{"@write", "@string", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: mset,
+	}
+
+	commands["MSETNX"] = Command{
+		details: Details{
+			name:              "msetnx",
+			arity:             -3,
+			flags:             []string{"write", "denyoom"},
+			firstKey:          1,
+			lastKey:           -1,
+			step:              2,
+			aclCategories:     []string{"@write", "@string", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: msetnx,
+	}
+
+	commands["MGET"] = Command{
+		details: Details{
+			name:              "mget",
+			arity:             -2,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           -1,
+			step:              1,
+			aclCategories:     []string{"@read", "@string", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: mget,
+	}
+
+	commands["LCS"] = Command{
+		details: Details{
+			name:              "lcs",
+			arity:             -3,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           2,
+			step:              1,
+			aclCategories:     []string{"@read", "@string", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: lcs,
+	}
+
+	commands["INCR"] = Command{
+		details: Details{
+			name:              "incr",
+			arity:             2,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@string", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: incr,
+	}
+
+	commands["DECR"] = Command{
+		details: Details{
+			name:              "decr",
+			arity:             2,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@string", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: decr,
+	}
+
+	commands["INCRBY"] = Command{
+		details: Details{
+			name:              "incrby",
+			arity:             3,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@string", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: incrby,
+	}
+
+	commands["DECRBY"] = Command{
+		details: Details{
+			name:              "decrby",
+			arity:             3,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@string", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: decrby,
+	}
+
+	commands["INCRBYFLOAT"] = Command{
+		details: Details{
+			name:              "incrbyfloat",
+			arity:             3,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@string", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: incrbyfloat,
+	}
+}
+
+// lookupString returns the string stored at key. The error is set when the
+// key holds another type.
+func lookupString(key string) (string, bool, *RespError) {
+	obj := keyspace.Lookup(key)
+	if obj == nil {
+		return "", false, nil
+	}
+	if obj.typ != TypeString {
+		return "", false, ErrWrongType
+	}
+
+	return obj.value.(string), true, nil
+}
+
+const (
+	setNX = 1 << iota
+	setXX
+	setGet
+	setKeepTTL
+	setPersist
+	setExpire
+)
+
+// stringOptions are the options shared by SET and GETEX. expire holds the
+// absolute expire time in milliseconds when the setExpire flag is set.
+type stringOptions struct {
+	flags  int
+	expire int64
+}
+
+// parseExpireArgument converts a relative or absolute expire time expressed
+// in unit milliseconds into an absolute unix time in milliseconds.
+func parseExpireArgument(arg string, name string, unit int64, absolute bool) (int64, *RespError) {
+	when, ok := parseInteger(arg)
+	if !ok {
+		return 0, ErrNotInteger
+	}
+
+	if when <= 0 || when > math.MaxInt64/unit {
+		return 0, NewErr("invalid expire time in '%s' command", name)
+	}
+	when *= unit
+
+	if !absolute {
+		now := nowMs()
+		if when > math.MaxInt64-now {
+			return 0, NewErr("invalid expire time in '%s' command", name)
+		}
+		when += now
+	}
+
+	return when, nil
+}
+
+// parseStringOptions parses the extended arguments of SET (getex false) or
+// GETEX (getex true), following Redis' rules about which options exclude
+// each other.
+func parseStringOptions(args []Value, name string, getex bool) (stringOptions, *RespError) {
+	var opts stringOptions
+
+	for i := 0; i < len(args); i++ {
+		opt := strings.ToUpper(args[i].bulk)
+		hasNext := i+1 < len(args)
+
+		switch {
+		case opt == "NX" && !getex && opts.flags&setXX == 0:
+			opts.flags |= setNX
+		case opt == "XX" && !getex && opts.flags&setNX == 0:
+			opts.flags |= setXX
+		case opt == "GET" && !getex:
+			opts.flags |= setGet
+		case opt == "KEEPTTL" && !getex && opts.flags&setExpire == 0:
+			opts.flags |= setKeepTTL
+		case opt == "PERSIST" && getex && opts.flags&setExpire == 0:
+			opts.flags |= setPersist
+		case (opt == "EX" || opt == "PX" || opt == "EXAT" || opt == "PXAT") && hasNext &&
+			opts.flags&(setKeepTTL|setPersist|setExpire) == 0:
+			unit := int64(1000)
+			if opt[0] == 'P' {
+				unit = 1
+			}
+
+			when, err := parseExpireArgument(args[i+1].bulk, name, unit, strings.HasSuffix(opt, "AT"))
+			if err != nil {
+				return opts, err
+			}
+
+			opts.flags |= setExpire
+			opts.expire = when
+			i++
+		default:
+			return opts, ErrSyntax
+		}
+	}
+
+	return opts, nil
+}
+
+// setGeneric implements SET and its legacy variants. okReply is sent when
+// the key was set, abortReply when NX or XX prevented it, unless GET was
+// requested, in which case the old value is sent either way.
+func setGeneric(c *Client, key, val string, opts stringOptions, okReply, abortReply Value) Value {
+	old, found, err := "", false, (*RespError)(nil)
+	if opts.flags&setGet != 0 {
+		old, found, err = lookupString(key)
+		if err != nil {
+			return err.Value()
+		}
+	} else {
+		found = keyspace.Exists(key)
+	}
+
+	reply := okReply
+	if opts.flags&setGet != 0 {
+		reply = MakeNilValue()
+		if found {
+			reply = MakeBulkValue(old)
+		}
+	}
+
+	if (found && opts.flags&setNX != 0) || (!found && opts.flags&setXX != 0) {
+		if opts.flags&setGet != 0 {
+			return reply
+		}
+		return abortReply
+	}
+
+	obj := &Object{typ: TypeString, value: val}
+	if opts.flags&setKeepTTL != 0 {
+		keyspace.SetKeepTTL(key, obj)
+	} else {
+		keyspace.Set(key, obj)
+	}
+	keyspace.dirty++
+
+	// Relative expire times would be extended by a replay, so the absolute
+	// time is propagated instead.
+	if opts.flags&setExpire != 0 {
+		c.rewriteCommand("SET", key, val, "PXAT", strconv.FormatInt(opts.expire, 10))
+
+		// An expire time already in the past means the key is gone right away.
+		if opts.expire <= nowMs() {
+			keyspace.Delete(key)
+			return reply
+		}
+		keyspace.SetExpire(key, opts.expire)
+	}
+
+	return reply
+}
+
+func set(c *Client, args []Value) Value {
+	key := args[0].bulk
+	val := args[1].bulk
+
+	opts, err := parseStringOptions(args[2:], "set", false)
+	if err != nil {
+		return err.Value()
+	}
+
+	return setGeneric(c, key, val, opts, Value{typ: "string", str: "OK"}, MakeNilValue())
+}
+
+func setnx(c *Client, args []Value) Value {
+	return setGeneric(c, args[0].bulk, args[1].bulk, stringOptions{flags: setNX}, MakeIntValue(1), MakeIntValue(0))
+}
+
+func setexGeneric(c *Client, args []Value, name string, unit int64) Value {
+	when, err := parseExpireArgument(args[1].bulk, name, unit, false)
+	if err != nil {
+		return err.Value()
+	}
+
+	opts := stringOptions{flags: setExpire, expire: when}
+	return setGeneric(c, args[0].bulk, args[2].bulk, opts, Value{typ: "string", str: "OK"}, MakeNilValue())
+}
+
+func setex(c *Client, args []Value) Value {
+	return setexGeneric(c, args, "setex", 1000)
+}
+
+func psetex(c *Client, args []Value) Value {
+	return setexGeneric(c, args, "psetex", 1)
+}
+
+func getset(c *Client, args []Value) Value {
+	return setGeneric(c, args[0].bulk, args[1].bulk, stringOptions{flags: setGet}, MakeNilValue(), MakeNilValue())
+}
+
+func get(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	val, ok, err := lookupString(key)
+	if err != nil {
+		return err.Value()
+	}
+	if !ok {
+		return Value{typ: "null"}
+	}
+
+	return Value{typ: "bulk", bulk: val}
+}
+
+func getdel(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	val, ok, err := lookupString(key)
+	if err != nil {
+		return err.Value()
+	}
+	if !ok {
+		return Value{typ: "null"}
+	}
+
+	keyspace.Delete(key)
+	keyspace.dirty++
+
+	return Value{typ: "bulk", bulk: val}
+}
+
+func getex(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	opts, respErr := parseStringOptions(args[1:], "getex", true)
+	if respErr != nil {
+		return respErr.Value()
+	}
+
+	val, ok, err := lookupString(key)
+	if err != nil {
+		return err.Value()
+	}
+	if !ok {
+		return Value{typ: "null"}
+	}
+
+	switch {
+	case opts.flags&setExpire != 0:
+		keyspace.dirty++
+		c.rewriteCommand("PEXPIREAT", key, strconv.FormatInt(opts.expire, 10))
+
+		if opts.expire <= nowMs() {
+			keyspace.Delete(key)
+		} else {
+			keyspace.SetExpire(key, opts.expire)
+		}
+	case opts.flags&setPersist != 0:
+		if keyspace.RemoveExpire(key) {
+			keyspace.dirty++
+			c.rewriteCommand("PERSIST", key)
+		}
+	}
+
+	return Value{typ: "bulk", bulk: val}
+}
+
+// checkStringLength refuses to grow a string of size bytes by append bytes
+// past the largest bulk string the protocol accepts. The sum is never
+// computed, as it could overflow for a huge size.
+func checkStringLength(size, append int64) *RespError {
+	if size > maxBulkLength-append {
+		return NewErr("string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+	return nil
+}
+
+func appendCommand(c *Client, args []Value) Value {
+	key := args[0].bulk
+	val := args[1].bulk
+
+	old, _, err := lookupString(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	if err := checkStringLength(int64(len(old)), int64(len(val))); err != nil {
+		return err.Value()
+	}
+
+	keyspace.SetKeepTTL(key, &Object{typ: TypeString, value: old + val})
+	keyspace.dirty++
+
+	return MakeIntValue(len(old) + len(val))
+}
+
+func strlen(c *Client, args []Value) Value {
+	val, _, err := lookupString(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	return MakeIntValue(len(val))
+}
+
+func getrange(c *Client, args []Value) Value {
+	start, ok1 := parseInteger(args[1].bulk)
+	end, ok2 := parseInteger(args[2].bulk)
+	if !ok1 || !ok2 {
+		return ErrNotInteger.Value()
+	}
+
+	val, _, err := lookupString(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	if start < 0 && end < 0 && start > end {
+		return MakeBulkValue("")
+	}
+
+	strlen := int64(len(val))
+	if start < 0 {
+		start = strlen + start
+	}
+	if end < 0 {
+		end = strlen + end
+	}
+	start, end = max(start, 0), max(end, 0)
+	if end >= strlen {
+		end = strlen - 1
+	}
+
+	if start > end || strlen == 0 {
+		return MakeBulkValue("")
+	}
+
+	return MakeBulkValue(val[start : end+1])
+}
+
+func setrange(c *Client, args []Value) Value {
+	key := args[0].bulk
+	val := args[2].bulk
+
+	offset, ok := parseInteger(args[1].bulk)
+	if !ok {
+		return ErrNotInteger.Value()
+	}
+	if offset < 0 {
+		return NewErr("offset is out of range").Value()
+	}
+
+	old, found, err := lookupString(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	// Nothing to write: report the length without creating the key.
+	if len(val) == 0 {
+		return MakeIntValue(len(old))
+	}
+
+	if err := checkStringLength(offset, int64(len(val))); err != nil {
+		return err.Value()
+	}
+
+	buf := []byte(old)
+	if need := int(offset) + len(val); need > len(buf) {
+		buf = append(buf, make([]byte, need-len(buf))...)
+	}
+	copy(buf[offset:], val)
+
+	if found {
+		keyspace.SetKeepTTL(key, &Object{typ: TypeString, value: string(buf)})
+	} else {
+		keyspace.Set(key, &Object{typ: TypeString, value: string(buf)})
+	}
+	keyspace.dirty++
+
+	return MakeIntValue(len(buf))
+}
+
+func msetGeneric(args []Value, name string, nx bool) (bool, *RespError) {
+	if len(args)%2 != 0 {
+		return false, ErrWrongArity(name)
+	}
+
+	if nx {
+		for i := 0; i < len(args); i += 2 {
+			if keyspace.Exists(args[i].bulk) {
+				return false, nil
+			}
+		}
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		keyspace.Set(args[i].bulk, &Object{typ: TypeString, value: args[i+1].bulk})
+	}
+	keyspace.dirty++
+
+	return true, nil
+}
+
+func mset(c *Client, args []Value) Value {
+	if _, err := msetGeneric(args, "mset", false); err != nil {
+		return err.Value()
+	}
+
+	return Value{typ: "string", str: "OK"}
+}
+
+func msetnx(c *Client, args []Value) Value {
+	ok, err := msetGeneric(args, "msetnx", true)
+	if err != nil {
+		return err.Value()
+	}
+
+	if !ok {
+		return MakeIntValue(0)
+	}
+
+	return MakeIntValue(1)
+}
+
+// mget replies nil for keys that are missing or hold another type, as
+// Redis does, instead of failing the whole command.
+func mget(c *Client, args []Value) Value {
+	result := make([]Value, 0, len(args))
+	for _, arg := range args {
+		val, ok, err := lookupString(arg.bulk)
+		if err != nil || !ok {
+			result = append(result, MakeNilValue())
+			continue
+		}
+		result = append(result, MakeBulkValue(val))
+	}
+
+	return Value{typ: "array", array: result}
+}
+
+// lcs finds the longest common subsequence with the classic dynamic
+// programming table, then walks it back from the end to rebuild the string
+// and the matching ranges, which is why IDX reports them last to first.
+func lcs(c *Client, args []Value) Value {
+	var getLen, getIdx, withMatchLen bool
+	var minMatchLen int64
+
+	for i := 2; i < len(args); i++ {
+		opt := strings.ToUpper(args[i].bulk)
+		switch {
+		case opt == "LEN":
+			getLen = true
+		case opt == "IDX":
+			getIdx = true
+		case opt == "WITHMATCHLEN":
+			withMatchLen = true
+		case opt == "MINMATCHLEN" && i+1 < len(args):
+			n, ok := parseInteger(args[i+1].bulk)
+			if !ok {
+				return ErrNotInteger.Value()
+			}
+			minMatchLen = max(n, 0)
+			i++
+		default:
+			return ErrSyntax.Value()
+		}
+	}
+
+	if getLen && getIdx {
+		return NewErr("If you want both the length and indexes, please just use IDX.").Value()
+	}
+
+	var strs [2]string
+	for i := range strs {
+		obj := keyspace.Lookup(args[i].bulk)
+		if obj == nil {
+			continue
+		}
+		if obj.typ != TypeString {
+			return NewErr("The specified keys must contain string values").Value()
+		}
+		strs[i] = obj.value.(string)
+	}
+	a, b := strs[0], strs[1]
+	alen, blen := len(a), len(b)
+
+	if int64(alen+1)*int64(blen+1)*4 > maxBulkLength {
+		return NewErr("Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len").Value()
+	}
+
+	width := blen + 1
+	table := make([]uint32, (alen+1)*width)
+	for i := 1; i <= alen; i++ {
+		for j := 1; j <= blen; j++ {
+			if a[i-1] == b[j-1] {
+				table[i*width+j] = table[(i-1)*width+j-1] + 1
+			} else {
+				table[i*width+j] = max(table[(i-1)*width+j], table[i*width+j-1])
+			}
+		}
+	}
+
+	idx := int(table[alen*width+blen])
+	if getLen {
+		return MakeIntValue(idx)
+	}
+
+	result := make([]byte, idx)
+	var matches []Value
+
+	// arangeStart == alen means no range is being tracked.
+	arangeStart, arangeEnd, brangeStart, brangeEnd := alen, 0, 0, 0
+	i, j := alen, blen
+	for i > 0 && j > 0 {
+		emitRange := false
+		if a[i-1] == b[j-1] {
+			result[idx-1] = a[i-1]
+
+			if arangeStart == alen {
+				arangeStart, arangeEnd = i-1, i-1
+				brangeStart, brangeEnd = j-1, j-1
+			} else if arangeStart == i && brangeStart == j {
+				// the range is contiguous, extend it backwards
+				arangeStart--
+				brangeStart--
+			} else {
+				emitRange = true
+			}
+
+			if arangeStart == 0 || brangeStart == 0 {
+				emitRange = true
+			}
+			idx--
+			i--
+			j--
+		} else {
+			if table[(i-1)*width+j] > table[i*width+j-1] {
+				i--
+			} else {
+				j--
+			}
+			if arangeStart != alen {
+				emitRange = true
+			}
+		}
+
+		if emitRange {
+			matchLen := arangeEnd - arangeStart + 1
+			if getIdx && (minMatchLen == 0 || int64(matchLen) >= minMatchLen) {
+				match := []Value{
+					{typ: "array", array: []Value{MakeIntValue(arangeStart), MakeIntValue(arangeEnd)}},
+					{typ: "array", array: []Value{MakeIntValue(brangeStart), MakeIntValue(brangeEnd)}},
+				}
+				if withMatchLen {
+					match = append(match, MakeIntValue(matchLen))
+				}
+				matches = append(matches, Value{typ: "array", array: match})
+			}
+			arangeStart = alen
+		}
+	}
+
+	if getIdx {
+		return MakeMapValue(
+			MakeBulkValue("matches"), Value{typ: "array", array: matches},
+			MakeBulkValue("len"), MakeIntValue(len(result)),
+		)
+	}
+
+	return MakeBulkValue(string(result))
+}
+
+// incrDecr adds incr to the integer stored at key, treating a missing key as
+// zero. The TTL of the key is preserved.
+func incrDecr(key string, incr int64) Value {
+	val, found, err := lookupString(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	var current int64
+	if found {
+		var ok bool
+		if current, ok = parseInteger(val); !ok {
+			return ErrNotInteger.Value()
+		}
+	}
+
+	if (incr < 0 && current < 0 && incr < math.MinInt64-current) ||
+		(incr > 0 && current > 0 && incr > math.MaxInt64-current) {
+		return NewErr("increment or decrement would overflow").Value()
+	}
+	current += incr
+
+	keyspace.SetKeepTTL(key, &Object{typ: TypeString, value: strconv.FormatInt(current, 10)})
+	keyspace.dirty++
+
+	return MakeIntValue(int(current))
+}
+
+func incr(c *Client, args []Value) Value {
+	return incrDecr(args[0].bulk, 1)
+}
+
+func decr(c *Client, args []Value) Value {
+	return incrDecr(args[0].bulk, -1)
+}
+
+func incrby(c *Client, args []Value) Value {
+	incr, ok := parseInteger(args[1].bulk)
+	if !ok {
+		return ErrNotInteger.Value()
+	}
+
+	return incrDecr(args[0].bulk, incr)
+}
+
+func decrby(c *Client, args []Value) Value {
+	decr, ok := parseInteger(args[1].bulk)
+	if !ok {
+		return ErrNotInteger.Value()
+	}
+	if decr == math.MinInt64 {
+		return NewErr("decrement would overflow").Value()
+	}
+
+	return incrDecr(args[0].bulk, -decr)
+}
+
+func incrbyfloat(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	incr, ok := parseLongDouble(args[1].bulk)
+	if !ok {
+		return ErrNotFloat.Value()
+	}
+
+	val, found, err := lookupString(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	current := newLongDouble()
+	if found {
+		if current, ok = parseLongDouble(val); !ok {
+			return ErrNotFloat.Value()
+		}
+	}
+
+	if current.IsInf() || incr.IsInf() {
+		return NewErr("increment would produce NaN or Infinity").Value()
+	}
+	current.Add(current, incr)
+
+	result := formatLongDouble(current)
+	keyspace.SetKeepTTL(key, &Object{typ: TypeString, value: result})
+	keyspace.dirty++
+
+	// Floating point math isn't guaranteed to give the same result
+	// everywhere, so replay sets the final value instead of redoing it.
+	c.rewriteCommand("SET", key, result, "KEEPTTL")
+
+	return MakeBulkValue(result)
+}
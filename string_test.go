@@ -0,0 +1,433 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestStringSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{name: "plain set", input: []Value{makeCommand("SET", "set:plain", "v")}, expected: "+OK\r\n"},
+		{name: "nx on missing key", input: []Value{makeCommand("SET", "set:nx", "v", "NX")}, expected: "+OK\r\n"},
+		{
+			name:     "nx on existing key",
+			input:    []Value{makeCommand("SET", "set:nx2", "v"), makeCommand("SET", "set:nx2", "w", "NX")},
+			expected: "$-1\r\n",
+		},
+		{name: "xx on missing key", input: []Value{makeCommand("SET", "set:xx", "v", "XX")}, expected: "$-1\r\n"},
+		{
+			name:     "xx on existing key",
+			input:    []Value{makeCommand("SET", "set:xx2", "v"), makeCommand("SET", "set:xx2", "w", "XX"), makeCommand("GET", "set:xx2")},
+			expected: "$1\r\nw\r\n",
+		},
+		{name: "get on missing key", input: []Value{makeCommand("SET", "set:get", "v", "GET")}, expected: "$-1\r\n"},
+		{
+			name:     "get on existing key",
+			input:    []Value{makeCommand("SET", "set:get2", "old"), makeCommand("SET", "set:get2", "new", "GET")},
+			expected: "$3\r\nold\r\n",
+		},
+		{
+			name:     "nx get on existing key",
+			input:    []Value{makeCommand("SET", "set:nxget", "old"), makeCommand("SET", "set:nxget", "new", "NX", "GET"), makeCommand("GET", "set:nxget")},
+			expected: "$3\r\nold\r\n",
+		},
+		{
+			name:     "get on a hash",
+			input:    []Value{makeCommand("HSET", "set:hash", "f", "v"), makeCommand("SET", "set:hash", "v", "GET")},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+		{
+			name:     "ex",
+			input:    []Value{makeCommand("SET", "set:ex", "v", "EX", "100"), makeCommand("TTL", "set:ex")},
+			expected: ":100\r\n",
+		},
+		{
+			name:     "px",
+			input:    []Value{makeCommand("SET", "set:px", "v", "PX", "1500"), makeCommand("PTTL", "set:px")},
+			expected: ":1500\r\n",
+		},
+		{
+			name:     "exat",
+			input:    []Value{makeCommand("SET", "set:exat", "v", "EXAT", "2000"), makeCommand("PEXPIRETIME", "set:exat")},
+			expected: ":2000000\r\n",
+		},
+		{
+			name:     "pxat in the past",
+			input:    []Value{makeCommand("SET", "set:pxat", "v"), makeCommand("SET", "set:pxat", "v", "PXAT", "1"), makeCommand("TYPE", "set:pxat")},
+			expected: "+none\r\n",
+		},
+		{
+			name:     "keepttl",
+			input:    []Value{makeCommand("SET", "set:keepttl", "v", "EX", "100"), makeCommand("SET", "set:keepttl", "w", "KEEPTTL"), makeCommand("TTL", "set:keepttl")},
+			expected: ":100\r\n",
+		},
+		{
+			name:     "without keepttl",
+			input:    []Value{makeCommand("SET", "set:nokeepttl", "v", "EX", "100"), makeCommand("SET", "set:nokeepttl", "w"), makeCommand("TTL", "set:nokeepttl")},
+			expected: ":-1\r\n",
+		},
+		{name: "nx and xx", input: []Value{makeCommand("SET", "set:err", "v", "NX", "XX")}, expected: "-ERR syntax error\r\n"},
+		{name: "ex and px", input: []Value{makeCommand("SET", "set:err", "v", "EX", "1", "PX", "1")}, expected: "-ERR syntax error\r\n"},
+		{name: "ex and keepttl", input: []Value{makeCommand("SET", "set:err", "v", "EX", "1", "KEEPTTL")}, expected: "-ERR syntax error\r\n"},
+		{name: "ex without value", input: []Value{makeCommand("SET", "set:err", "v", "EX")}, expected: "-ERR syntax error\r\n"},
+		{name: "ex not integer", input: []Value{makeCommand("SET", "set:err", "v", "EX", "x")}, expected: "-ERR value is not an integer or out of range\r\n"},
+		{name: "ex zero", input: []Value{makeCommand("SET", "set:err", "v", "EX", "0")}, expected: "-ERR invalid expire time in 'set' command\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			freezeClock(t, 1_000_000)
+
+			result := runCommands(t, tt.input...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestStringLegacySetters(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{name: "setnx on missing key", input: []Value{makeCommand("SETNX", "legacy:setnx", "v")}, expected: ":1\r\n"},
+		{
+			name:     "setnx on existing key",
+			input:    []Value{makeCommand("SETNX", "legacy:setnx2", "v"), makeCommand("SETNX", "legacy:setnx2", "w")},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "setex",
+			input:    []Value{makeCommand("SETEX", "legacy:setex", "100", "v"), makeCommand("TTL", "legacy:setex")},
+			expected: ":100\r\n",
+		},
+		{name: "setex zero", input: []Value{makeCommand("SETEX", "legacy:setex2", "0", "v")}, expected: "-ERR invalid expire time in 'setex' command\r\n"},
+		{
+			name:     "psetex",
+			input:    []Value{makeCommand("PSETEX", "legacy:psetex", "1500", "v"), makeCommand("PTTL", "legacy:psetex")},
+			expected: ":1500\r\n",
+		},
+		{
+			name:     "getset",
+			input:    []Value{makeCommand("SET", "legacy:getset", "old", "EX", "100"), makeCommand("GETSET", "legacy:getset", "new")},
+			expected: "$3\r\nold\r\n",
+		},
+		{
+			name:     "getset clears ttl",
+			input:    []Value{makeCommand("SET", "legacy:getset2", "old", "EX", "100"), makeCommand("GETSET", "legacy:getset2", "new"), makeCommand("TTL", "legacy:getset2")},
+			expected: ":-1\r\n",
+		},
+		{
+			name:     "getdel",
+			input:    []Value{makeCommand("SET", "legacy:getdel", "v"), makeCommand("GETDEL", "legacy:getdel")},
+			expected: "$1\r\nv\r\n",
+		},
+		{
+			name:     "getdel deletes",
+			input:    []Value{makeCommand("SET", "legacy:getdel2", "v"), makeCommand("GETDEL", "legacy:getdel2"), makeCommand("GET", "legacy:getdel2")},
+			expected: "$-1\r\n",
+		},
+		{
+			name:     "getex sets ttl",
+			input:    []Value{makeCommand("SET", "legacy:getex", "v"), makeCommand("GETEX", "legacy:getex", "EX", "100"), makeCommand("TTL", "legacy:getex")},
+			expected: ":100\r\n",
+		},
+		{
+			name:     "getex persist",
+			input:    []Value{makeCommand("SET", "legacy:getex2", "v", "EX", "100"), makeCommand("GETEX", "legacy:getex2", "PERSIST"), makeCommand("TTL", "legacy:getex2")},
+			expected: ":-1\r\n",
+		},
+		{name: "getex rejects nx", input: []Value{makeCommand("GETEX", "legacy:getex3", "NX")}, expected: "-ERR syntax error\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			freezeClock(t, 1_000_000)
+
+			result := runCommands(t, tt.input...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestStringSetPropagation(t *testing.T) {
+	freezeClock(t, 1_000_000)
+
+	logged := propagated(t,
+		makeCommand("SET", "set:aof", "v", "EX", "100", "GET"),
+		makeCommand("SET", "set:aof", "w", "NX"),
+		makeCommand("SETEX", "set:aof2", "10", "v"),
+	)
+
+	expected := []Value{
+		makeCommand("SET", "set:aof", "v", "PXAT", "1100000"),
+		makeCommand("SET", "set:aof2", "v", "PXAT", "1010000"),
+	}
+	assertPropagated(t, logged, expected)
+}
+
+func TestStringFamily(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{name: "append creates key", input: []Value{makeCommand("APPEND", "family:append", "hello")}, expected: ":5\r\n"},
+		{
+			name:     "append to existing",
+			input:    []Value{makeCommand("SET", "family:append2", "hello"), makeCommand("APPEND", "family:append2", " world"), makeCommand("GET", "family:append2")},
+			expected: "$11\r\nhello world\r\n",
+		},
+		{
+			name:     "append keeps ttl",
+			input:    []Value{makeCommand("SET", "family:append3", "a", "EX", "100"), makeCommand("APPEND", "family:append3", "b"), makeCommand("TTL", "family:append3")},
+			expected: ":100\r\n",
+		},
+		{
+			name:     "append to hash",
+			input:    []Value{makeCommand("HSET", "family:append4", "f", "v"), makeCommand("APPEND", "family:append4", "b")},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+		{name: "strlen of missing key", input: []Value{makeCommand("STRLEN", "family:strlen")}, expected: ":0\r\n"},
+		{
+			name:     "strlen is binary safe",
+			input:    []Value{makeCommand("SET", "family:strlen2", "a\x00b\r\n"), makeCommand("STRLEN", "family:strlen2")},
+			expected: ":5\r\n",
+		},
+		{
+			name:     "getrange",
+			input:    []Value{makeCommand("SET", "family:range", "This is a string"), makeCommand("GETRANGE", "family:range", "0", "3")},
+			expected: "$4\r\nThis\r\n",
+		},
+		{
+			name:     "getrange negative",
+			input:    []Value{makeCommand("SET", "family:range2", "This is a string"), makeCommand("GETRANGE", "family:range2", "-3", "-1")},
+			expected: "$3\r\ning\r\n",
+		},
+		{
+			name:     "getrange whole string",
+			input:    []Value{makeCommand("SET", "family:range3", "This is a string"), makeCommand("GETRANGE", "family:range3", "0", "-1")},
+			expected: "$16\r\nThis is a string\r\n",
+		},
+		{
+			name:     "getrange past the end",
+			input:    []Value{makeCommand("SET", "family:range4", "This is a string"), makeCommand("GETRANGE", "family:range4", "10", "100")},
+			expected: "$6\r\nstring\r\n",
+		},
+		{
+			name:     "getrange inverted negative",
+			input:    []Value{makeCommand("SET", "family:range5", "abc"), makeCommand("GETRANGE", "family:range5", "-1", "-2")},
+			expected: "$0\r\n\r\n",
+		},
+		{
+			name:     "setrange overwrites",
+			input:    []Value{makeCommand("SET", "family:setrange", "Hello World"), makeCommand("SETRANGE", "family:setrange", "6", "Redis"), makeCommand("GET", "family:setrange")},
+			expected: "$11\r\nHello Redis\r\n",
+		},
+		{
+			name:     "setrange pads with zeros",
+			input:    []Value{makeCommand("SETRANGE", "family:setrange2", "3", "ab"), makeCommand("GET", "family:setrange2")},
+			expected: "$5\r\n\x00\x00\x00ab\r\n",
+		},
+		{
+			name:     "setrange with empty value",
+			input:    []Value{makeCommand("SETRANGE", "family:setrange3", "3", ""), makeCommand("TYPE", "family:setrange3")},
+			expected: "+none\r\n",
+		},
+		{name: "setrange negative offset", input: []Value{makeCommand("SETRANGE", "family:setrange4", "-1", "a")}, expected: "-ERR offset is out of range\r\n"},
+		{
+			name:     "setrange offset overflowing the length",
+			input:    []Value{makeCommand("SETRANGE", "family:setrange5", "9223372036854775807", "abc")},
+			expected: "-ERR string exceeds maximum allowed size (proto-max-bulk-len)\r\n",
+		},
+		{
+			name:     "mset and mget",
+			input:    []Value{makeCommand("MSET", "family:m1", "a", "family:m2", "b"), makeCommand("HSET", "family:m3", "f", "v"), makeCommand("MGET", "family:m1", "family:m2", "family:m3", "family:m4")},
+			expected: "*4\r\n$1\r\na\r\n$1\r\nb\r\n$-1\r\n$-1\r\n",
+		},
+		{name: "mset odd arguments", input: []Value{makeCommand("MSET", "family:m5", "a", "family:m6")}, expected: "-ERR wrong number of arguments for 'mset' command\r\n"},
+		{name: "msetnx sets all", input: []Value{makeCommand("MSETNX", "family:nx1", "a", "family:nx2", "b")}, expected: ":1\r\n"},
+		{
+			name:     "msetnx sets none",
+			input:    []Value{makeCommand("SET", "family:nx3", "a"), makeCommand("MSETNX", "family:nx4", "b", "family:nx3", "c"), makeCommand("MGET", "family:nx3", "family:nx4")},
+			expected: "*2\r\n$1\r\na\r\n$-1\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			freezeClock(t, 1_000_000)
+
+			result := runCommands(t, tt.input...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestStringLcs(t *testing.T) {
+	setup := makeCommand("MSET", "lcs:key1", "ohmytext", "lcs:key2", "mynewtext")
+
+	tests := []struct {
+		name     string
+		input    Value
+		expected string
+	}{
+		{name: "string", input: makeCommand("LCS", "lcs:key1", "lcs:key2"), expected: "$6\r\nmytext\r\n"},
+		{name: "len", input: makeCommand("LCS", "lcs:key1", "lcs:key2", "LEN"), expected: ":6\r\n"},
+		{
+			name:     "idx",
+			input:    makeCommand("LCS", "lcs:key1", "lcs:key2", "IDX"),
+			expected: "*4\r\n$7\r\nmatches\r\n*2\r\n*2\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n*2\r\n*2\r\n:2\r\n:3\r\n*2\r\n:0\r\n:1\r\n$3\r\nlen\r\n:6\r\n",
+		},
+		{
+			name:     "idx minmatchlen withmatchlen",
+			input:    makeCommand("LCS", "lcs:key1", "lcs:key2", "IDX", "MINMATCHLEN", "4", "WITHMATCHLEN"),
+			expected: "*4\r\n$7\r\nmatches\r\n*1\r\n*3\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n:4\r\n$3\r\nlen\r\n:6\r\n",
+		},
+		{name: "missing keys", input: makeCommand("LCS", "lcs:missing1", "lcs:missing2"), expected: "$0\r\n\r\n"},
+		{name: "len and idx", input: makeCommand("LCS", "lcs:key1", "lcs:key2", "LEN", "IDX"), expected: "-ERR If you want both the length and indexes, please just use IDX.\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCommands(t, setup, tt.input)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestStringCounters(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{name: "incr missing key", input: []Value{makeCommand("INCR", "counter:incr")}, expected: ":1\r\n"},
+		{
+			name:     "incr existing",
+			input:    []Value{makeCommand("SET", "counter:incr2", "10"), makeCommand("INCR", "counter:incr2")},
+			expected: ":11\r\n",
+		},
+		{name: "decr missing key", input: []Value{makeCommand("DECR", "counter:decr")}, expected: ":-1\r\n"},
+		{name: "incrby", input: []Value{makeCommand("INCRBY", "counter:incrby", "42")}, expected: ":42\r\n"},
+		{
+			name:     "decrby",
+			input:    []Value{makeCommand("SET", "counter:decrby", "10"), makeCommand("DECRBY", "counter:decrby", "15")},
+			expected: ":-5\r\n",
+		},
+		{
+			name:     "not an integer",
+			input:    []Value{makeCommand("SET", "counter:str", "abc"), makeCommand("INCR", "counter:str")},
+			expected: "-ERR value is not an integer or out of range\r\n",
+		},
+		{
+			name:     "spaces are not an integer",
+			input:    []Value{makeCommand("SET", "counter:space", " 1"), makeCommand("INCR", "counter:space")},
+			expected: "-ERR value is not an integer or out of range\r\n",
+		},
+		{
+			name:     "overflow",
+			input:    []Value{makeCommand("SET", "counter:max", "9223372036854775807"), makeCommand("INCR", "counter:max")},
+			expected: "-ERR increment or decrement would overflow\r\n",
+		},
+		{
+			name:     "underflow",
+			input:    []Value{makeCommand("SET", "counter:min", "-9223372036854775808"), makeCommand("DECR", "counter:min")},
+			expected: "-ERR increment or decrement would overflow\r\n",
+		},
+		{
+			name:     "decrby min int",
+			input:    []Value{makeCommand("DECRBY", "counter:minarg", "-9223372036854775808")},
+			expected: "-ERR decrement would overflow\r\n",
+		},
+		{
+			name:     "incr keeps ttl",
+			input:    []Value{makeCommand("SET", "counter:ttl", "1", "EX", "100"), makeCommand("INCR", "counter:ttl"), makeCommand("TTL", "counter:ttl")},
+			expected: ":100\r\n",
+		},
+		{
+			name:     "incr on hash",
+			input:    []Value{makeCommand("HSET", "counter:hash", "f", "1"), makeCommand("INCR", "counter:hash")},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+		{
+			name:     "incrbyfloat",
+			input:    []Value{makeCommand("SET", "counter:float", "10.50"), makeCommand("INCRBYFLOAT", "counter:float", "0.1")},
+			expected: "$4\r\n10.6\r\n",
+		},
+		{
+			name:     "incrbyfloat long double rounding",
+			input:    []Value{makeCommand("SET", "counter:float2", "0.1"), makeCommand("INCRBYFLOAT", "counter:float2", "0.2")},
+			expected: "$3\r\n0.3\r\n",
+		},
+		{
+			name:     "incrbyfloat exponent",
+			input:    []Value{makeCommand("SET", "counter:float3", "5.0e3"), makeCommand("INCRBYFLOAT", "counter:float3", "2.0e2")},
+			expected: "$4\r\n5200\r\n",
+		},
+		{
+			name:     "incrbyfloat negative zero",
+			input:    []Value{makeCommand("SET", "counter:float4", "1"), makeCommand("INCRBYFLOAT", "counter:float4", "-1")},
+			expected: "$1\r\n0\r\n",
+		},
+		{name: "incrbyfloat invalid increment", input: []Value{makeCommand("INCRBYFLOAT", "counter:float5", "abc")}, expected: "-ERR value is not a valid float\r\n"},
+		{name: "incrbyfloat underscores", input: []Value{makeCommand("INCRBYFLOAT", "counter:float7", "1_000")}, expected: "-ERR value is not a valid float\r\n"},
+		{name: "incrbyfloat hex float", input: []Value{makeCommand("INCRBYFLOAT", "counter:float8", "0x1p4")}, expected: "$2\r\n16\r\n"},
+		{name: "incrbyfloat hex mantissa", input: []Value{makeCommand("INCRBYFLOAT", "counter:float9", "0x10")}, expected: "$2\r\n16\r\n"},
+		{name: "incrbyfloat negative hex fraction", input: []Value{makeCommand("INCRBYFLOAT", "counter:float13", "-0X1.8")}, expected: "$4\r\n-1.5\r\n"},
+		{name: "incrbyfloat binary prefix", input: []Value{makeCommand("INCRBYFLOAT", "counter:float10", "0b101")}, expected: "-ERR value is not a valid float\r\n"},
+		{name: "incrbyfloat octal prefix", input: []Value{makeCommand("INCRBYFLOAT", "counter:float14", "0o17")}, expected: "-ERR value is not a valid float\r\n"},
+		{name: "incrbyfloat hex underscores", input: []Value{makeCommand("INCRBYFLOAT", "counter:float15", "0x1_0")}, expected: "-ERR value is not a valid float\r\n"},
+		{name: "incrbyfloat hex garbage", input: []Value{makeCommand("INCRBYFLOAT", "counter:float16", "0x1g")}, expected: "-ERR value is not a valid float\r\n"},
+		{
+			name:     "incrbyfloat hex value",
+			input:    []Value{makeCommand("SET", "counter:float11", "0x1p4"), makeCommand("INCRBYFLOAT", "counter:float11", "1")},
+			expected: "$2\r\n17\r\n",
+		},
+		{
+			name:     "incrbyfloat beyond a double",
+			input:    []Value{makeCommand("SET", "counter:float12", "1e400"), makeCommand("INCRBYFLOAT", "counter:float12", "-1e400")},
+			expected: "$1\r\n0\r\n",
+		},
+		{
+			name:     "incrbyfloat infinity",
+			input:    []Value{makeCommand("INCRBYFLOAT", "counter:float6", "inf")},
+			expected: "-ERR increment would produce NaN or Infinity\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			freezeClock(t, 1_000_000)
+
+			result := runCommands(t, tt.input...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestStringIncrbyfloatPropagation(t *testing.T) {
+	logged := propagated(t,
+		makeCommand("SET", "counter:aof", "1.5"),
+		makeCommand("INCRBYFLOAT", "counter:aof", "0.25"),
+	)
+
+	expected := []Value{
+		makeCommand("SET", "counter:aof", "1.5"),
+		makeCommand("SET", "counter:aof", "1.75", "KEEPTTL"),
+	}
+	assertPropagated(t, logged, expected)
+}
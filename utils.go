@@ -2,7 +2,11 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
 )
 
@@ -38,6 +42,237 @@ func MakeArrayValue(values ...any) Value {
 	return val
 }
 
+// MakeCommandValue builds a command the way clients send it, as an array of
+// bulk strings.
+func MakeCommandValue(argv ...string) Value {
+	val := Value{typ: "array", array: make([]Value, 0, len(argv))}
+	for _, arg := range argv {
+		val.array = append(val.array, MakeBulkValue(arg))
+	}
+
+	return val
+}
+
+// parseInteger parses a base 10 signed 64-bit integer as strictly as Redis
+// does: no leading '+', no spaces and no leading zeros.
+func parseInteger(s string) (int64, bool) {
+	if len(s) == 0 || s[0] == '+' || (len(s) > 1 && s[0] == '0') || (len(s) > 2 && s[0] == '-' && s[1] == '0') || s == "-0" {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return n, true
+}
+
+// longDoublePrec is the mantissa size of the x87 long double Redis uses for
+// INCRBYFLOAT, so sums round exactly the same way.
+const longDoublePrec = 64
+
+func newLongDouble() *big.Float {
+	return new(big.Float).SetPrec(longDoublePrec)
+}
+
+// parseLongDouble parses a float the way Redis parses a long double. Leading
+// spaces, trailing garbage and NaN are rejected.
+func parseLongDouble(s string) (*big.Float, bool) {
+	if len(s) == 0 || isSpace(s[0]) {
+		return nil, false
+	}
+
+	// big.Float also takes Go syntax strtold doesn't: underscores between
+	// digits and the 0b and 0o prefixes. A hex mantissa is valid for both,
+	// but Go requires it a 'p' exponent strtold doesn't, so strconv.ParseFloat
+	// only checks the decimal grammar. A value out of the range of a float64
+	// is still fine for a long double.
+	if strings.Contains(s, "_") {
+		return nil, false
+	}
+	mantissa := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+"))
+	switch {
+	case strings.HasPrefix(mantissa, "0b") || strings.HasPrefix(mantissa, "0o"):
+		return nil, false
+	case !strings.HasPrefix(mantissa, "0x"):
+		if _, err := strconv.ParseFloat(s, 64); err != nil && !errors.Is(err, strconv.ErrRange) {
+			return nil, false
+		}
+	}
+
+	f, ok := newLongDouble().SetString(s)
+	if !ok {
+		return nil, false
+	}
+
+	return f, true
+}
+
+// parseDouble parses a float the way Redis parses scores with strtod.
+// Leading spaces, trailing garbage and NaN are rejected, while inf and -inf
+// are valid.
+func parseDouble(s string) (float64, bool) {
+	if len(s) == 0 || isSpace(s[0]) {
+		return 0, false
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, false
+	}
+
+	return f, true
+}
+
+// formatLongDouble formats f with 17 decimals and strips the trailing
+// zeros, which is the human friendly format of INCRBYFLOAT replies.
+func formatLongDouble(f *big.Float) string {
+	s := f.Text('f', 17)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+
+	if s == "-0" {
+		return "0"
+	}
+
+	return s
+}
+
 func MakeNilValue() Value {
 	return Value{typ: "null"}
 }
+
+func MakeNilArrayValue() Value {
+	return Value{typ: "nullarray"}
+}
+
+func MakeErrorValue(str string) Value {
+	return Value{typ: "error", str: str}
+}
+
+func MakeDoubleValue(f float64) Value {
+	return Value{typ: "double", double: f}
+}
+
+func MakeBooleanValue(b bool) Value {
+	return Value{typ: "boolean", boolean: b}
+}
+
+func MakeBigNumberValue(digits string) Value {
+	return Value{typ: "bignumber", str: digits}
+}
+
+func MakeVerbatimValue(format, text string) Value {
+	return Value{typ: "verbatim", str: format, bulk: text}
+}
+
+// MakeMapValue builds a map from alternating key/value arguments.
+func MakeMapValue(pairs ...Value) Value {
+	return Value{typ: "map", array: pairs}
+}
+
+func MakeSetValue(values ...Value) Value {
+	return Value{typ: "set", array: values}
+}
+
+func MakePushValue(values ...Value) Value {
+	return Value{typ: "push", array: values}
+}
+
+// argStrings returns the bulk strings of args.
+func argStrings(args []Value) []string {
+	argv := make([]string, len(args))
+	for i, arg := range args {
+		argv[i] = arg.bulk
+	}
+
+	return argv
+}
+
+// stringMatch reports whether s matches the glob-style pattern the way Redis
+// matches keys: "*" matches any sequence, "?" any character, "[...]" any
+// character of the set, negated by a leading "^" and with "a-z" ranges, and
+// "\" escapes the character following it. Backtracking only ever resumes
+// from the last star, so a pattern can't take exponential time.
+func stringMatch(pattern, s string) bool {
+	p, i := 0, 0
+	star, starI := -1, 0
+
+	for i < len(s) {
+		if p < len(pattern) {
+			if pattern[p] == '*' {
+				star, starI = p, i
+				p++
+				continue
+			}
+			if width, ok := matchGlobToken(pattern[p:], s[i]); ok {
+				p += width
+				i++
+				continue
+			}
+		}
+
+		// Let the last star swallow one more character.
+		if star == -1 {
+			return false
+		}
+		starI++
+		p, i = star+1, starI
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchGlobToken matches c against the token pattern starts with, which is
+// not a star, and returns how long the token is.
+func matchGlobToken(pattern string, c byte) (int, bool) {
+	switch pattern[0] {
+	case '?':
+		return 1, true
+	case '\\':
+		if len(pattern) >= 2 {
+			return 2, pattern[1] == c
+		}
+		return 1, c == '\\'
+	case '[':
+	default:
+		return 1, pattern[0] == c
+	}
+
+	p := 1
+	not := p < len(pattern) && pattern[p] == '^'
+	if not {
+		p++
+	}
+
+	// Like in Redis, a set missing its closing bracket runs to the end of
+	// the pattern.
+	match := false
+	for ; p < len(pattern) && pattern[p] != ']'; p++ {
+		switch {
+		case pattern[p] == '\\' && p+1 < len(pattern):
+			p++
+			match = match || pattern[p] == c
+		case p+2 < len(pattern) && pattern[p+1] == '-':
+			start, end := pattern[p], pattern[p+2]
+			if start > end {
+				start, end = end, start
+			}
+			match = match || (c >= start && c <= end)
+			p += 2
+		default:
+			match = match || pattern[p] == c
+		}
+	}
+	if p < len(pattern) {
+		p++
+	}
+
+	return p, match != not
+}
@@ -0,0 +1,1627 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func registerZSetCommands(commands map[string]Command) {
+	commands["ZADD"] = Command{
+		details: Details{
+			name:              "zadd",
+			arity:             -4,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@sortedset", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zadd,
+	}
+
+	commands["ZINCRBY"] = Command{
+		details: Details{
+			name:              "zincrby",
+			arity:             4,
+			flags:             []string{"write", "denyoom", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@sortedset", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zincrby,
+	}
+
+	commands["ZREM"] = Command{
+		details: Details{
+			name:              "zrem",
+			arity:             -3,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@sortedset", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zrem,
+	}
+
+	commands["ZSCORE"] = Command{
+		details: Details{
+			name:              "zscore",
+			arity:             3,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@sortedset", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zscore,
+	}
+
+	commands["ZCARD"] = Command{
+		details: Details{
+			name:              "zcard",
+			arity:             2,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@sortedset", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zcard,
+	}
+
+	commands["ZRANK"] = Command{
+		details: Details{
+			name:              "zrank",
+			arity:             -3,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@sortedset", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zrank,
+	}
+
+	commands["ZREVRANK"] = Command{
+		details: Details{
+			name:              "zrevrank",
+			arity:             -3,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@sortedset", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zrevrank,
+	}
+
+	commands["ZCOUNT"] = Command{
+		details: Details{
+			name:              "zcount",
+			arity:             4,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@sortedset", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zcount,
+	}
+
+	commands["ZRANGE"] = Command{
+		details: Details{
+			name:              "zrange",
+			arity:             -4,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@sortedset", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zrange,
+	}
+
+	commands["ZRANGESTORE"] = Command{
+		details: Details{
+			name:              "zrangestore",
+			arity:             -5,
+			flags:             []string{"write", "denyoom"},
+			firstKey:          1,
+			lastKey:           2,
+			step:              1,
+			aclCategories:     []string{"@write", "@sortedset", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zrangestore,
+	}
+
+	commands["ZREMRANGEBYRANK"] = Command{
+		details: Details{
+			name:              "zremrangebyrank",
+			arity:             4,
+			flags:             []string{"write"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@sortedset", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zremrangebyrank,
+	}
+
+	commands["ZREMRANGEBYSCORE"] = Command{
+		details: Details{
+			name:              "zremrangebyscore",
+			arity:             4,
+			flags:             []string{"write"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@sortedset", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zremrangebyscore,
+	}
+
+	commands["ZREMRANGEBYLEX"] = Command{
+		details: Details{
+			name:              "zremrangebylex",
+			arity:             4,
+			flags:             []string{"write"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@sortedset", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zremrangebylex,
+	}
+
+	commands["ZLEXCOUNT"] = Command{
+		details: Details{
+			name:              "zlexcount",
+			arity:             4,
+			flags:             []string{"readonly", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@sortedset", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zlexcount,
+	}
+
+	commands["ZUNIONSTORE"] = Command{
+		details: Details{
+			name:              "zunionstore",
+			arity:             -4,
+			flags:             []string{"write", "denyoom", "movablekeys"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@sortedset", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zunionstore,
+	}
+
+	commands["ZINTERSTORE"] = Command{
+		details: Details{
+			name:              "zinterstore",
+			arity:             -4,
+			flags:             []string{"write", "denyoom", "movablekeys"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@sortedset", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zinterstore,
+	}
+
+	commands["ZDIFFSTORE"] = Command{
+		details: Details{
+			name:              "zdiffstore",
+			arity:             -4,
+			flags:             []string{"write", "denyoom", "movablekeys"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@sortedset", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zdiffstore,
+	}
+
+	commands["ZUNION"] = Command{
+		details: Details{
+			name:              "zunion",
+			arity:             -3,
+			flags:             []string{"readonly", "movablekeys"},
+			firstKey:          0,
+			lastKey:           0,
+			step:              0,
+			aclCategories:     []string{"@read", "@sortedset", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zunion,
+	}
+
+	commands["ZINTER"] = Command{
+		details: Details{
+			name:              "zinter",
+			arity:             -3,
+			flags:             []string{"readonly", "movablekeys"},
+			firstKey:          0,
+			lastKey:           0,
+			step:              0,
+			aclCategories:     []string{"@read", "@sortedset", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zinter,
+	}
+
+	commands["ZDIFF"] = Command{
+		details: Details{
+			name:              "zdiff",
+			arity:             -3,
+			flags:             []string{"readonly", "movablekeys"},
+			firstKey:          0,
+			lastKey:           0,
+			step:              0,
+			aclCategories:     []string{"@read", "@sortedset", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zdiff,
+	}
+
+	commands["ZPOPMIN"] = Command{
+		details: Details{
+			name:              "zpopmin",
+			arity:             -2,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@sortedset", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zpopmin,
+	}
+
+	commands["ZPOPMAX"] = Command{
+		details: Details{
+			name:              "zpopmax",
+			arity:             -2,
+			flags:             []string{"write", "fast"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@write", "@sortedset", "@fast"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zpopmax,
+	}
+
+	commands["ZMPOP"] = Command{
+		details: Details{
+			name:              "zmpop",
+			arity:             -4,
+			flags:             []string{"write", "movablekeys"},
+			firstKey:          0,
+			lastKey:           0,
+			step:              0,
+			aclCategories:     []string{"@write", "@sortedset", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zmpop,
+	}
+
+	commands["BZPOPMIN"] = Command{
+		details: Details{
+			name:              "bzpopmin",
+			arity:             -3,
+			flags:             []string{"write", "fast", "blocking"},
+			firstKey:          1,
+			lastKey:           -2,
+			step:              1,
+			aclCategories:     []string{"@write", "@sortedset", "@fast", "@blocking"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: bzpopmin,
+	}
+
+	commands["BZPOPMAX"] = Command{
+		details: Details{
+			name:              "bzpopmax",
+			arity:             -3,
+			flags:             []string{"write", "fast", "blocking"},
+			firstKey:          1,
+			lastKey:           -2,
+			step:              1,
+			aclCategories:     []string{"@write", "@sortedset", "@fast", "@blocking"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: bzpopmax,
+	}
+
+	commands["BZMPOP"] = Command{
+		details: Details{
+			name:              "bzmpop",
+			arity:             -5,
+			flags:             []string{"write", "blocking", "movablekeys"},
+			firstKey:          0,
+			lastKey:           0,
+			step:              0,
+			aclCategories:     []string{"@write", "@sortedset", "@slow", "@blocking"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: bzmpop,
+	}
+
+	commands["ZSCAN"] = Command{
+		details: Details{
+			name:              "zscan",
+			arity:             -3,
+			flags:             []string{"readonly"},
+			firstKey:          1,
+			lastKey:           1,
+			step:              1,
+			aclCategories:     []string{"@read", "@sortedset", "@slow"},
+			tips:              nil,
+			keySpecifications: nil,
+			subcommands:       nil,
+		},
+		handler: zscan,
+	}
+}
+
+// ZSet is the value of a sorted set key. Like in Redis the members are kept
+// both in a dictionary, for O(1) score lookups, and in a skiplist ordered by
+// score, for ranges and O(log N) ranks. Reading from a nil *ZSet behaves
+// like reading from an empty sorted set.
+type ZSet struct {
+	dict *Dict[float64]
+	zsl  *zskiplist
+}
+
+func NewZSet() *ZSet {
+	return &ZSet{dict: NewDict[float64](), zsl: newZskiplist()}
+}
+
+func (z *ZSet) Len() int {
+	if z == nil {
+		return 0
+	}
+
+	return z.dict.Len()
+}
+
+// Clone returns a copy of the sorted set. The skiplist is rebuilt rather
+// than copied, as its nodes only make sense linked to each other.
+func (z *ZSet) Clone() *ZSet {
+	clone := &ZSet{dict: z.dict.Clone(), zsl: newZskiplist()}
+	for x := z.zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+		clone.zsl.insert(x.score, x.member)
+	}
+
+	return clone
+}
+
+func (z *ZSet) Score(member string) (float64, bool) {
+	if z == nil {
+		return 0, false
+	}
+
+	return z.dict.Get(member)
+}
+
+// Flags of ZSet.Add, as the ZADD options.
+const (
+	zaddNX = 1 << iota
+	zaddXX
+	zaddGT
+	zaddLT
+	zaddCH
+	zaddIncr
+)
+
+// Outcomes of ZSet.Add.
+const (
+	zaddNop = iota
+	zaddAdded
+	zaddUpdated
+	zaddNaN
+)
+
+// Add sets the score of member, or increments it with zaddIncr, honoring
+// the NX, XX, GT and LT flags. It returns the resulting score and what it
+// did.
+func (z *ZSet) Add(score float64, member string, flags int) (float64, int) {
+	current, exists := z.dict.Get(member)
+	if !exists {
+		if flags&zaddXX != 0 {
+			return 0, zaddNop
+		}
+
+		z.dict.Set(member, score)
+		z.zsl.insert(score, member)
+		return score, zaddAdded
+	}
+
+	if flags&zaddNX != 0 {
+		return current, zaddNop
+	}
+
+	if flags&zaddIncr != 0 {
+		score += current
+		if math.IsNaN(score) {
+			return 0, zaddNaN
+		}
+	}
+
+	if (flags&zaddLT != 0 && score >= current) || (flags&zaddGT != 0 && score <= current) {
+		return current, zaddNop
+	}
+
+	if score == current {
+		return current, zaddNop
+	}
+
+	z.zsl.updateScore(current, member, score)
+	z.dict.Set(member, score)
+	return score, zaddUpdated
+}
+
+func (z *ZSet) Remove(member string) bool {
+	score, ok := z.dict.Get(member)
+	if !ok {
+		return false
+	}
+
+	z.dict.Delete(member)
+	z.zsl.delete(score, member)
+	return true
+}
+
+// Rank returns the 0-based rank of member, counting from the highest score
+// when reverse is set.
+func (z *ZSet) Rank(member string, reverse bool) (int, bool) {
+	score, ok := z.Score(member)
+	if !ok {
+		return 0, false
+	}
+
+	rank := z.zsl.rank(score, member)
+	if reverse {
+		return z.Len() - rank, true
+	}
+	return rank - 1, true
+}
+
+// Count returns the number of members in the range.
+func (z *ZSet) Count(r zrangeSpec) int {
+	if z.Len() == 0 {
+		return 0
+	}
+
+	first := z.zsl.firstInRange(r)
+	if first == nil {
+		return 0
+	}
+
+	last := z.zsl.lastInRange(r)
+	return z.zsl.rank(last.score, last.member) - z.zsl.rank(first.score, first.member) + 1
+}
+
+// Pop removes and returns up to count members with the lowest scores, or
+// with the highest scores when reverse is set.
+func (z *ZSet) Pop(count int, reverse bool) []zsetEntry {
+	entries := z.RangeByRank(0, int64(count)-1, reverse)
+	for _, entry := range entries {
+		z.Remove(entry.member)
+	}
+
+	return entries
+}
+
+// parseScoreBound parses one bound of a score range, exclusive when it
+// starts with '('.
+func parseScoreBound(s string) (float64, bool, bool) {
+	if strings.HasPrefix(s, "(") {
+		f, ok := parseDouble(s[1:])
+		return f, true, ok
+	}
+
+	f, ok := parseDouble(s)
+	return f, false, ok
+}
+
+// parseScoreRange parses the min and max arguments of the commands taking a
+// score range, like "-inf" or "(1.5".
+func parseScoreRange(min, max string) (*zrangespec, *RespError) {
+	r := &zrangespec{}
+
+	var okMin, okMax bool
+	r.min, r.minex, okMin = parseScoreBound(min)
+	r.max, r.maxex, okMax = parseScoreBound(max)
+	if !okMin || !okMax {
+		return nil, NewErr("min or max is not a float")
+	}
+
+	return r, nil
+}
+
+// parseLexBound parses one bound of a lex range: "[" or "(" followed by the
+// member for an inclusive or exclusive bound, or "-" and "+" for the ends.
+func parseLexBound(s string) (zlexBound, bool) {
+	switch {
+	case s == "-":
+		return zlexBound{inf: -1}, true
+	case s == "+":
+		return zlexBound{inf: 1}, true
+	case strings.HasPrefix(s, "["):
+		return zlexBound{value: s[1:]}, true
+	case strings.HasPrefix(s, "("):
+		return zlexBound{value: s[1:], exclusive: true}, true
+	}
+
+	return zlexBound{}, false
+}
+
+func parseLexRange(min, max string) (*zlexrangespec, *RespError) {
+	r := &zlexrangespec{}
+
+	var okMin, okMax bool
+	r.min, okMin = parseLexBound(min)
+	r.max, okMax = parseLexBound(max)
+	if !okMin || !okMax {
+		return nil, NewErr("min or max not valid string range item")
+	}
+
+	return r, nil
+}
+
+// zsetEntry is a member of a sorted set with its score.
+type zsetEntry struct {
+	member string
+	score  float64
+}
+
+// RangeByRank returns the members from rank start to stop, both inclusive
+// and counting from the end when negative. Ranks count from the highest
+// score when reverse is set.
+func (z *ZSet) RangeByRank(start, stop int64, reverse bool) []zsetEntry {
+	from, to, ok := normalizeRange(start, stop, z.Len())
+	if !ok {
+		return nil
+	}
+
+	entries := make([]zsetEntry, 0, to-from+1)
+	x := z.zsl.byRank(from + 1)
+	if reverse {
+		x = z.zsl.byRank(z.Len() - from)
+	}
+
+	for range to - from + 1 {
+		entries = append(entries, zsetEntry{member: x.member, score: x.score})
+		if reverse {
+			x = x.backward
+		} else {
+			x = x.level[0].forward
+		}
+	}
+
+	return entries
+}
+
+// RangeBySpec returns the members in the range, from the lowest or, when
+// reverse is set, from the highest. The first offset members are skipped and
+// at most count are returned, all of them when count is negative.
+func (z *ZSet) RangeBySpec(r zrangeSpec, reverse bool, offset, count int64) []zsetEntry {
+	if z.Len() == 0 || offset < 0 {
+		return nil
+	}
+
+	var x *zskiplistNode
+	if reverse {
+		x = z.zsl.lastInRange(r)
+	} else {
+		x = z.zsl.firstInRange(r)
+	}
+
+	var entries []zsetEntry
+	for x != nil && count != 0 {
+		if (reverse && !r.gteMin(x)) || (!reverse && !r.lteMax(x)) {
+			break
+		}
+
+		if offset > 0 {
+			offset--
+		} else {
+			entries = append(entries, zsetEntry{member: x.member, score: x.score})
+			count--
+		}
+
+		if reverse {
+			x = x.backward
+		} else {
+			x = x.level[0].forward
+		}
+	}
+
+	return entries
+}
+
+// zsetEntriesValue replies with the members of entries, and their scores
+// too with withScores: as [member, score] pairs on RESP3, flattened on RESP2.
+func zsetEntriesValue(c *Client, entries []zsetEntry, withScores bool) Value {
+	result := make([]Value, 0, len(entries))
+	for _, entry := range entries {
+		switch {
+		case !withScores:
+			result = append(result, MakeBulkValue(entry.member))
+		case c.proto == RESP3:
+			result = append(result, Value{typ: "array", array: []Value{MakeBulkValue(entry.member), MakeDoubleValue(entry.score)}})
+		default:
+			result = append(result, MakeBulkValue(entry.member), MakeDoubleValue(entry.score))
+		}
+	}
+
+	return Value{typ: "array", array: result}
+}
+
+// storeZSetEntries replaces the sorted set at dst with entries, deleting it
+// when there are none, and replies with the new cardinality.
+func storeZSetEntries(dst string, entries []zsetEntry) Value {
+	zset := NewZSet()
+	for _, entry := range entries {
+		zset.Add(entry.score, entry.member, 0)
+	}
+
+	return storeZSet(dst, zset)
+}
+
+// storeZSet is storeZSetEntries for a sorted set already built.
+func storeZSet(dst string, zset *ZSet) Value {
+	if zset.Len() == 0 {
+		if keyspace.Delete(dst) {
+			keyspace.dirty++
+		}
+		return MakeIntValue(0)
+	}
+
+	keyspace.Set(dst, &Object{typ: TypeZSet, value: zset})
+	keyspace.dirty++
+
+	return MakeIntValue(zset.Len())
+}
+
+// lookupZSet returns the sorted set stored at key, or nil if there is none.
+// The error is set when the key holds another type.
+func lookupZSet(key string) (*ZSet, *RespError) {
+	obj := keyspace.Lookup(key)
+	if obj == nil {
+		return nil, nil
+	}
+	if obj.typ != TypeZSet {
+		return nil, ErrWrongType
+	}
+
+	return obj.value.(*ZSet), nil
+}
+
+// lookupZSetForWrite is lookupZSet, except that a missing sorted set is
+// created.
+func lookupZSetForWrite(key string) (*ZSet, *RespError) {
+	zset, err := lookupZSet(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if zset == nil {
+		zset = NewZSet()
+		keyspace.Set(key, &Object{typ: TypeZSet, value: zset})
+	}
+
+	return zset, nil
+}
+
+func deleteIfEmptyZSet(key string, zset *ZSet) {
+	if zset.Len() == 0 {
+		keyspace.Delete(key)
+	}
+}
+
+// zaddGeneric implements ZADD and ZINCRBY, which is ZADD with INCR.
+func zaddGeneric(c *Client, args []Value, flags int) Value {
+	key := args[0].bulk
+
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i].bulk) {
+		case "NX":
+			flags |= zaddNX
+		case "XX":
+			flags |= zaddXX
+		case "GT":
+			flags |= zaddGT
+		case "LT":
+			flags |= zaddLT
+		case "CH":
+			flags |= zaddCH
+		case "INCR":
+			flags |= zaddIncr
+		default:
+			break options
+		}
+	}
+
+	elements := args[i:]
+	if len(elements) == 0 || len(elements)%2 != 0 {
+		return ErrSyntax.Value()
+	}
+
+	if flags&zaddNX != 0 && flags&zaddXX != 0 {
+		return NewErr("XX and NX options at the same time are not compatible").Value()
+	}
+	if (flags&zaddGT != 0 && flags&zaddNX != 0) || (flags&zaddLT != 0 && flags&zaddNX != 0) || (flags&zaddGT != 0 && flags&zaddLT != 0) {
+		return NewErr("GT, LT, and/or NX options at the same time are not compatible").Value()
+	}
+	if flags&zaddIncr != 0 && len(elements) > 2 {
+		return NewErr("INCR option supports a single increment-element pair").Value()
+	}
+
+	scores := make([]float64, len(elements)/2)
+	for j := range scores {
+		score, ok := parseDouble(elements[j*2].bulk)
+		if !ok {
+			return ErrNotFloat.Value()
+		}
+		scores[j] = score
+	}
+
+	zset, err := lookupZSet(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	if zset == nil && flags&zaddXX == 0 {
+		zset, _ = lookupZSetForWrite(key)
+	}
+
+	added, updated, score, outcome := 0, 0, 0.0, zaddNop
+	if zset != nil {
+		for j := range scores {
+			score, outcome = zset.Add(scores[j], elements[j*2+1].bulk, flags)
+			switch outcome {
+			case zaddNaN:
+				return NewErr("resulting score is not a number (NaN)").Value()
+			case zaddAdded:
+				added++
+			case zaddUpdated:
+				updated++
+			}
+		}
+	}
+	keyspace.dirty += added + updated
+
+	if flags&zaddIncr != 0 {
+		if outcome == zaddNop {
+			return MakeNilValue()
+		}
+		return MakeDoubleValue(score)
+	}
+
+	if flags&zaddCH != 0 {
+		return MakeIntValue(added + updated)
+	}
+	return MakeIntValue(added)
+}
+
+func zadd(c *Client, args []Value) Value {
+	return zaddGeneric(c, args, 0)
+}
+
+func zincrby(c *Client, args []Value) Value {
+	return zaddGeneric(c, args, zaddIncr)
+}
+
+func zrem(c *Client, args []Value) Value {
+	key := args[0].bulk
+
+	zset, err := lookupZSet(key)
+	if err != nil {
+		return err.Value()
+	}
+	if zset == nil {
+		return MakeIntValue(0)
+	}
+
+	removed := 0
+	for _, arg := range args[1:] {
+		if zset.Remove(arg.bulk) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		deleteIfEmptyZSet(key, zset)
+		keyspace.dirty++
+	}
+
+	return MakeIntValue(removed)
+}
+
+func zscore(c *Client, args []Value) Value {
+	zset, err := lookupZSet(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	score, ok := zset.Score(args[1].bulk)
+	if !ok {
+		return MakeNilValue()
+	}
+
+	return MakeDoubleValue(score)
+}
+
+func zcard(c *Client, args []Value) Value {
+	zset, err := lookupZSet(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	return MakeIntValue(zset.Len())
+}
+
+// zrankGeneric implements ZRANK and ZREVRANK. WITHSCORE replies with the
+// rank and the score, or a null array when the member doesn't exist.
+func zrankGeneric(c *Client, args []Value, reverse bool) Value {
+	if len(args) > 3 || (len(args) == 3 && !strings.EqualFold(args[2].bulk, "WITHSCORE")) {
+		return ErrSyntax.Value()
+	}
+	withScore := len(args) == 3
+
+	zset, err := lookupZSet(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	rank, ok := zset.Rank(args[1].bulk, reverse)
+	if !ok {
+		if withScore {
+			return MakeNilArrayValue()
+		}
+		return MakeNilValue()
+	}
+
+	if withScore {
+		score, _ := zset.Score(args[1].bulk)
+		return Value{typ: "array", array: []Value{MakeIntValue(rank), MakeDoubleValue(score)}}
+	}
+	return MakeIntValue(rank)
+}
+
+func zrank(c *Client, args []Value) Value {
+	return zrankGeneric(c, args, false)
+}
+
+func zrevrank(c *Client, args []Value) Value {
+	return zrankGeneric(c, args, true)
+}
+
+func zcount(c *Client, args []Value) Value {
+	r, err := parseScoreRange(args[1].bulk, args[2].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	zset, err := lookupZSet(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	return MakeIntValue(zset.Count(r))
+}
+
+// Range types of ZRANGE.
+const (
+	zrangeRank = iota
+	zrangeScore
+	zrangeLex
+)
+
+// zrangeGeneric implements ZRANGE and, when store is set, ZRANGESTORE whose
+// first argument is the destination. BYSCORE and BYLEX ranges are given as
+// max and min with REV, as in ZREVRANGEBYSCORE.
+func zrangeGeneric(c *Client, args []Value, store bool) Value {
+	var dst string
+	if store {
+		dst, args = args[0].bulk, args[1:]
+	}
+	key, start, stop := args[0].bulk, args[1].bulk, args[2].bulk
+
+	rangeType, reverse, withScores := zrangeRank, false, false
+	offset, count, hasLimit := int64(0), int64(-1), false
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i].bulk); {
+		case opt == "WITHSCORES" && !store:
+			withScores = true
+		case opt == "BYSCORE":
+			rangeType = zrangeScore
+		case opt == "BYLEX":
+			rangeType = zrangeLex
+		case opt == "REV":
+			reverse = true
+		case opt == "LIMIT" && i+2 < len(args):
+			var ok bool
+			if offset, ok = parseInteger(args[i+1].bulk); !ok {
+				return ErrNotInteger.Value()
+			}
+			if count, ok = parseInteger(args[i+2].bulk); !ok {
+				return ErrNotInteger.Value()
+			}
+			hasLimit = true
+			i += 2
+		default:
+			return ErrSyntax.Value()
+		}
+	}
+
+	if hasLimit && rangeType == zrangeRank {
+		return NewErr("syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX").Value()
+	}
+	if withScores && rangeType == zrangeLex {
+		return NewErr("syntax error, WITHSCORES not supported in combination with BYLEX").Value()
+	}
+	if reverse && rangeType != zrangeRank {
+		start, stop = stop, start
+	}
+
+	var spec zrangeSpec
+	var startRank, stopRank int64
+	switch rangeType {
+	case zrangeRank:
+		var ok1, ok2 bool
+		startRank, ok1 = parseInteger(start)
+		stopRank, ok2 = parseInteger(stop)
+		if !ok1 || !ok2 {
+			return ErrNotInteger.Value()
+		}
+	case zrangeScore:
+		r, err := parseScoreRange(start, stop)
+		if err != nil {
+			return err.Value()
+		}
+		spec = r
+	case zrangeLex:
+		r, err := parseLexRange(start, stop)
+		if err != nil {
+			return err.Value()
+		}
+		spec = r
+	}
+
+	zset, err := lookupZSet(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	var entries []zsetEntry
+	if rangeType == zrangeRank {
+		entries = zset.RangeByRank(startRank, stopRank, reverse)
+	} else {
+		entries = zset.RangeBySpec(spec, reverse, offset, count)
+	}
+
+	if store {
+		return storeZSetEntries(dst, entries)
+	}
+	return zsetEntriesValue(c, entries, withScores)
+}
+
+func zrange(c *Client, args []Value) Value {
+	return zrangeGeneric(c, args, false)
+}
+
+func zrangestore(c *Client, args []Value) Value {
+	return zrangeGeneric(c, args, true)
+}
+
+// zremrangeGeneric implements the ZREMRANGEBY* commands, replying with the
+// number of members removed.
+func zremrangeGeneric(c *Client, args []Value, rangeType int) Value {
+	key := args[0].bulk
+
+	var spec zrangeSpec
+	var start, stop int64
+	switch rangeType {
+	case zrangeRank:
+		var ok1, ok2 bool
+		start, ok1 = parseInteger(args[1].bulk)
+		stop, ok2 = parseInteger(args[2].bulk)
+		if !ok1 || !ok2 {
+			return ErrNotInteger.Value()
+		}
+	case zrangeScore:
+		r, err := parseScoreRange(args[1].bulk, args[2].bulk)
+		if err != nil {
+			return err.Value()
+		}
+		spec = r
+	case zrangeLex:
+		r, err := parseLexRange(args[1].bulk, args[2].bulk)
+		if err != nil {
+			return err.Value()
+		}
+		spec = r
+	}
+
+	zset, err := lookupZSet(key)
+	if err != nil {
+		return err.Value()
+	}
+	if zset == nil {
+		return MakeIntValue(0)
+	}
+
+	var entries []zsetEntry
+	if rangeType == zrangeRank {
+		entries = zset.RangeByRank(start, stop, false)
+	} else {
+		entries = zset.RangeBySpec(spec, false, 0, -1)
+	}
+
+	for _, entry := range entries {
+		zset.Remove(entry.member)
+	}
+	if len(entries) > 0 {
+		deleteIfEmptyZSet(key, zset)
+		keyspace.dirty += len(entries)
+	}
+
+	return MakeIntValue(len(entries))
+}
+
+func zremrangebyrank(c *Client, args []Value) Value {
+	return zremrangeGeneric(c, args, zrangeRank)
+}
+
+func zremrangebyscore(c *Client, args []Value) Value {
+	return zremrangeGeneric(c, args, zrangeScore)
+}
+
+func zremrangebylex(c *Client, args []Value) Value {
+	return zremrangeGeneric(c, args, zrangeLex)
+}
+
+func zlexcount(c *Client, args []Value) Value {
+	r, err := parseLexRange(args[1].bulk, args[2].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	zset, err := lookupZSet(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	return MakeIntValue(zset.Count(r))
+}
+
+// Aggregate functions of ZUNIONSTORE and ZINTERSTORE, for the scores a
+// member has in the different inputs.
+const (
+	zaggSum = iota
+	zaggMin
+	zaggMax
+)
+
+// zsetOpSource is an input of ZUNION, ZINTER and ZDIFF: a sorted set, or a
+// plain set whose members all score 1. Both are nil for a missing key.
+type zsetOpSource struct {
+	zset   *ZSet
+	set    *Set
+	weight float64
+}
+
+func (s *zsetOpSource) Len() int {
+	if s.set != nil {
+		return s.set.Len()
+	}
+	return s.zset.Len()
+}
+
+func (s *zsetOpSource) Score(member string) (float64, bool) {
+	if s.set != nil {
+		return 1, s.set.Contains(member)
+	}
+	return s.zset.Score(member)
+}
+
+// Entries returns the members of the source, in no particular order.
+func (s *zsetOpSource) Entries() []zsetEntry {
+	if s.set != nil {
+		entries := make([]zsetEntry, 0, s.set.Len())
+		for _, member := range s.set.Members() {
+			entries = append(entries, zsetEntry{member: member, score: 1})
+		}
+		return entries
+	}
+
+	if s.zset == nil {
+		return nil
+	}
+
+	entries := make([]zsetEntry, 0, s.zset.Len())
+	s.zset.dict.ForEach(func(member string, score float64) {
+		entries = append(entries, zsetEntry{member: member, score: score})
+	})
+	return entries
+}
+
+// weighted returns score multiplied by the weight of the source. Like in
+// Redis, the NaN of 0 * inf counts as 0.
+func (s *zsetOpSource) weighted(score float64) float64 {
+	score *= s.weight
+	if math.IsNaN(score) {
+		return 0
+	}
+	return score
+}
+
+func zsetAggregate(aggregate int, target, val float64) float64 {
+	switch aggregate {
+	case zaggMin:
+		return min(target, val)
+	case zaggMax:
+		return max(target, val)
+	}
+
+	// inf + -inf is NaN, which counts as 0 too.
+	if sum := target + val; !math.IsNaN(sum) {
+		return sum
+	}
+	return 0
+}
+
+// lookupZSetOpSources returns the inputs stored at keys. Any key that is
+// neither a sorted set nor a set is an error.
+func lookupZSetOpSources(keys []Value) ([]*zsetOpSource, *RespError) {
+	sources := make([]*zsetOpSource, len(keys))
+	for i, key := range keys {
+		sources[i] = &zsetOpSource{weight: 1}
+
+		obj := keyspace.Lookup(key.bulk)
+		switch {
+		case obj == nil:
+		case obj.typ == TypeZSet:
+			sources[i].zset = obj.value.(*ZSet)
+		case obj.typ == TypeSet:
+			sources[i].set = obj.value.(*Set)
+		default:
+			return nil, ErrWrongType
+		}
+	}
+
+	return sources, nil
+}
+
+// zsetOperation computes the union, intersection or difference of sources
+// into a new sorted set. The difference keeps the scores of the first
+// source, while the other operations weight the scores and aggregate them.
+func zsetOperation(sources []*zsetOpSource, op int, aggregate int) *ZSet {
+	scores := make(map[string]float64)
+
+	switch op {
+	case setOpUnion:
+		for _, src := range sources {
+			for _, entry := range src.Entries() {
+				score := src.weighted(entry.score)
+				if current, ok := scores[entry.member]; ok {
+					score = zsetAggregate(aggregate, current, score)
+				}
+				scores[entry.member] = score
+			}
+		}
+	case setOpInter:
+		// Iterating the smallest input discards members as early as
+		// possible.
+		sources = slices.Clone(sources)
+		slices.SortStableFunc(sources, func(a, b *zsetOpSource) int { return a.Len() - b.Len() })
+
+	members:
+		for _, entry := range sources[0].Entries() {
+			score := sources[0].weighted(entry.score)
+			for _, other := range sources[1:] {
+				val, ok := other.Score(entry.member)
+				if !ok {
+					continue members
+				}
+				score = zsetAggregate(aggregate, score, other.weighted(val))
+			}
+			scores[entry.member] = score
+		}
+	case setOpDiff:
+		for _, entry := range sources[0].Entries() {
+			contained := false
+			for _, other := range sources[1:] {
+				if _, ok := other.Score(entry.member); ok {
+					contained = true
+					break
+				}
+			}
+			if !contained {
+				scores[entry.member] = entry.score
+			}
+		}
+	}
+
+	result := NewZSet()
+	for member, score := range scores {
+		result.Add(score, member, 0)
+	}
+
+	return result
+}
+
+// zsetOperationGeneric implements ZUNION, ZINTER and ZDIFF, and their STORE
+// variants when dst is set. numKeysIndex is the index of the numkeys
+// argument in args.
+func zsetOperationGeneric(c *Client, args []Value, name string, op int, dst string, numKeysIndex int) Value {
+	numKeys, ok := parseInteger(args[numKeysIndex].bulk)
+	if !ok {
+		return ErrNotInteger.Value()
+	}
+	if numKeys < 1 {
+		return NewErr("at least 1 input key is needed for '%s' command", name).Value()
+	}
+	if numKeys > int64(len(args)-numKeysIndex-1) {
+		return ErrSyntax.Value()
+	}
+
+	keysEnd := numKeysIndex + 1 + int(numKeys)
+	sources, err := lookupZSetOpSources(args[numKeysIndex+1 : keysEnd])
+	if err != nil {
+		return err.Value()
+	}
+
+	aggregate, withScores := zaggSum, false
+	for i := keysEnd; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		switch opt := strings.ToUpper(args[i].bulk); {
+		case opt == "WEIGHTS" && op != setOpDiff && remaining >= len(sources):
+			for _, src := range sources {
+				i++
+				weight, ok := parseDouble(args[i].bulk)
+				if !ok {
+					return NewErr("weight value is not a float").Value()
+				}
+				src.weight = weight
+			}
+		case opt == "AGGREGATE" && op != setOpDiff && remaining >= 1:
+			i++
+			switch strings.ToUpper(args[i].bulk) {
+			case "SUM":
+				aggregate = zaggSum
+			case "MIN":
+				aggregate = zaggMin
+			case "MAX":
+				aggregate = zaggMax
+			default:
+				return ErrSyntax.Value()
+			}
+		case opt == "WITHSCORES" && dst == "":
+			withScores = true
+		default:
+			return ErrSyntax.Value()
+		}
+	}
+
+	result := zsetOperation(sources, op, aggregate)
+	if dst != "" {
+		return storeZSet(dst, result)
+	}
+
+	return zsetEntriesValue(c, result.RangeByRank(0, -1, false), withScores)
+}
+
+func zunionstore(c *Client, args []Value) Value {
+	return zsetOperationGeneric(c, args, "zunionstore", setOpUnion, args[0].bulk, 1)
+}
+
+func zinterstore(c *Client, args []Value) Value {
+	return zsetOperationGeneric(c, args, "zinterstore", setOpInter, args[0].bulk, 1)
+}
+
+func zdiffstore(c *Client, args []Value) Value {
+	return zsetOperationGeneric(c, args, "zdiffstore", setOpDiff, args[0].bulk, 1)
+}
+
+func zunion(c *Client, args []Value) Value {
+	return zsetOperationGeneric(c, args, "zunion", setOpUnion, "", 0)
+}
+
+func zinter(c *Client, args []Value) Value {
+	return zsetOperationGeneric(c, args, "zinter", setOpInter, "", 0)
+}
+
+func zdiff(c *Client, args []Value) Value {
+	return zsetOperationGeneric(c, args, "zdiff", setOpDiff, "", 0)
+}
+
+// zpopGeneric implements ZPOPMIN and ZPOPMAX. Without a count the reply is
+// the member and its score, with one it is a list of them, as pairs on
+// RESP3.
+func zpopGeneric(c *Client, args []Value, name string, reverse bool) Value {
+	key := args[0].bulk
+
+	if len(args) > 2 {
+		return ErrWrongArity(name).Value()
+	}
+
+	count, hasCount := 1, len(args) == 2
+	if hasCount {
+		var err *RespError
+		if count, err = parsePositiveCount(args[1].bulk); err != nil {
+			return err.Value()
+		}
+	}
+
+	zset, err := lookupZSet(key)
+	if err != nil {
+		return err.Value()
+	}
+
+	if zset == nil || count == 0 {
+		return Value{typ: "array", array: []Value{}}
+	}
+
+	entries := zset.Pop(count, reverse)
+	deleteIfEmptyZSet(key, zset)
+	keyspace.dirty++
+
+	if !hasCount {
+		return Value{typ: "array", array: []Value{MakeBulkValue(entries[0].member), MakeDoubleValue(entries[0].score)}}
+	}
+	return zsetEntriesValue(c, entries, true)
+}
+
+func zpopmin(c *Client, args []Value) Value {
+	return zpopGeneric(c, args, "zpopmin", false)
+}
+
+func zpopmax(c *Client, args []Value) Value {
+	return zpopGeneric(c, args, "zpopmax", true)
+}
+
+// Where ZMPOP and BZMPOP pop from.
+const (
+	zsetMin = iota
+	zsetMax
+)
+
+func parseZSetWhere(arg string) (int, bool) {
+	switch strings.ToUpper(arg) {
+	case "MIN":
+		return zsetMin, true
+	case "MAX":
+		return zsetMax, true
+	}
+
+	return 0, false
+}
+
+// zpopCommandName returns the non blocking pop that a pop from where amounts
+// to, which is what gets propagated.
+func zpopCommandName(where int) string {
+	if where == zsetMax {
+		return "ZPOPMAX"
+	}
+	return "ZPOPMIN"
+}
+
+// zmpopFromKeys pops from the first non empty sorted set among keys. It
+// replies with the key and the popped [member, score] pairs, and propagates
+// the equivalent ZPOPMIN or ZPOPMAX. ok is false when every sorted set is
+// empty.
+func zmpopFromKeys(c *Client, keys []string, where int, count int) (Value, bool) {
+	for _, key := range keys {
+		zset, err := lookupZSet(key)
+		if err != nil {
+			return err.Value(), true
+		}
+		if zset == nil {
+			continue
+		}
+
+		entries := zset.Pop(count, where == zsetMax)
+		deleteIfEmptyZSet(key, zset)
+		keyspace.dirty++
+
+		c.rewriteCommand(zpopCommandName(where), key, strconv.Itoa(len(entries)))
+
+		pairs := make([]Value, len(entries))
+		for i, entry := range entries {
+			pairs[i] = Value{typ: "array", array: []Value{MakeBulkValue(entry.member), MakeDoubleValue(entry.score)}}
+		}
+		return Value{typ: "array", array: []Value{MakeBulkValue(key), {typ: "array", array: pairs}}}, true
+	}
+
+	return Value{}, false
+}
+
+func zmpop(c *Client, args []Value) Value {
+	keys, where, count, err := parseMpopArgs(args, parseZSetWhere)
+	if err != nil {
+		return err.Value()
+	}
+
+	result, ok := zmpopFromKeys(c, keys, where, count)
+	if !ok {
+		return MakeNilArrayValue()
+	}
+
+	return result
+}
+
+// blockingZPopGeneric implements BZPOPMIN and BZPOPMAX. The first non empty
+// sorted set among the keys is popped from, and the pop is propagated as the
+// ZPOPMIN or ZPOPMAX it amounts to.
+func blockingZPopGeneric(c *Client, args []Value, where int) Value {
+	timeout, err := parseTimeout(args[len(args)-1].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	keys := make([]string, len(args)-1)
+	for i, arg := range args[:len(args)-1] {
+		keys[i] = arg.bulk
+	}
+
+	for _, key := range keys {
+		zset, err := lookupZSet(key)
+		if err != nil {
+			return err.Value()
+		}
+		if zset == nil {
+			continue
+		}
+
+		entry := zset.Pop(1, where == zsetMax)[0]
+		deleteIfEmptyZSet(key, zset)
+		keyspace.dirty++
+
+		c.rewriteCommand(zpopCommandName(where), key)
+
+		return Value{typ: "array", array: []Value{MakeBulkValue(key), MakeBulkValue(entry.member), MakeDoubleValue(entry.score)}}
+	}
+
+	c.block(keys, TypeZSet, timeout, MakeNilArrayValue())
+	return Value{}
+}
+
+func bzpopmin(c *Client, args []Value) Value {
+	return blockingZPopGeneric(c, args, zsetMin)
+}
+
+func bzpopmax(c *Client, args []Value) Value {
+	return blockingZPopGeneric(c, args, zsetMax)
+}
+
+func bzmpop(c *Client, args []Value) Value {
+	timeout, err := parseTimeout(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	keys, where, count, err := parseMpopArgs(args[1:], parseZSetWhere)
+	if err != nil {
+		return err.Value()
+	}
+
+	result, ok := zmpopFromKeys(c, keys, where, count)
+	if !ok {
+		c.block(keys, TypeZSet, timeout, MakeNilArrayValue())
+		return Value{}
+	}
+
+	return result
+}
+
+func zscan(c *Client, args []Value) Value {
+	cursor, err := parseScanCursor(args[1].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	opts, err := parseScanOptions(args[2:], "zscan")
+	if err != nil {
+		return err.Value()
+	}
+
+	zset, err := lookupZSet(args[0].bulk)
+	if err != nil {
+		return err.Value()
+	}
+
+	elements := []Value{}
+	if zset == nil {
+		return scanReply(0, elements)
+	}
+
+	cursor = scanDict(zset.dict, cursor, opts.count, func(member string, score float64) {
+		if opts.match(member) {
+			elements = append(elements, MakeBulkValue(member), MakeBulkValue(formatDouble(score)))
+		}
+	})
+
+	return scanReply(cursor, elements)
+}
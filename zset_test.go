@@ -0,0 +1,353 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestZSetCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{name: "zadd counts new members", input: []Value{makeCommand("ZADD", "zset:add", "1", "a", "2", "b", "3", "a")}, expected: ":2\r\n"},
+		{
+			name:     "zadd ch counts updates",
+			input:    []Value{makeCommand("ZADD", "zset:ch", "1", "a"), makeCommand("ZADD", "zset:ch", "CH", "2", "a", "1", "b")},
+			expected: ":2\r\n",
+		},
+		{
+			name:     "zadd nx keeps the score",
+			input:    []Value{makeCommand("ZADD", "zset:nx", "1", "a"), makeCommand("ZADD", "zset:nx", "NX", "5", "a"), makeCommand("ZSCORE", "zset:nx", "a")},
+			expected: "$1\r\n1\r\n",
+		},
+		{
+			name:     "zadd xx does not add",
+			input:    []Value{makeCommand("ZADD", "zset:xx", "XX", "1", "a"), makeCommand("TYPE", "zset:xx")},
+			expected: "+none\r\n",
+		},
+		{
+			name:     "zadd gt",
+			input:    []Value{makeCommand("ZADD", "zset:gt", "5", "a"), makeCommand("ZADD", "zset:gt", "GT", "3", "a"), makeCommand("ZSCORE", "zset:gt", "a")},
+			expected: "$1\r\n5\r\n",
+		},
+		{
+			name:     "zadd lt adds new members",
+			input:    []Value{makeCommand("ZADD", "zset:lt", "LT", "CH", "3", "a")},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "zadd incr",
+			input:    []Value{makeCommand("ZADD", "zset:incr", "1.5", "a"), makeCommand("ZADD", "zset:incr", "INCR", "2", "a")},
+			expected: "$3\r\n3.5\r\n",
+		},
+		{
+			name:     "zadd incr aborted by nx",
+			input:    []Value{makeCommand("ZADD", "zset:incr2", "1", "a"), makeCommand("ZADD", "zset:incr2", "NX", "INCR", "2", "a")},
+			expected: "$-1\r\n",
+		},
+		{name: "zadd nx and xx", input: []Value{makeCommand("ZADD", "zset:err", "NX", "XX", "1", "a")}, expected: "-ERR XX and NX options at the same time are not compatible\r\n"},
+		{name: "zadd gt and lt", input: []Value{makeCommand("ZADD", "zset:err", "GT", "LT", "1", "a")}, expected: "-ERR GT, LT, and/or NX options at the same time are not compatible\r\n"},
+		{name: "zadd incr pairs", input: []Value{makeCommand("ZADD", "zset:err", "INCR", "1", "a", "2", "b")}, expected: "-ERR INCR option supports a single increment-element pair\r\n"},
+		{name: "zadd odd elements", input: []Value{makeCommand("ZADD", "zset:err", "1", "a", "2")}, expected: "-ERR syntax error\r\n"},
+		{name: "zadd invalid score", input: []Value{makeCommand("ZADD", "zset:err", "nan", "a")}, expected: "-ERR value is not a valid float\r\n"},
+		{
+			name:     "zadd infinite scores",
+			input:    []Value{makeCommand("ZADD", "zset:inf", "-inf", "a", "+inf", "b"), makeCommand("ZSCORE", "zset:inf", "a")},
+			expected: "$4\r\n-inf\r\n",
+		},
+		{
+			name:     "zincrby to nan",
+			input:    []Value{makeCommand("ZADD", "zset:nan", "inf", "a"), makeCommand("ZINCRBY", "zset:nan", "-inf", "a")},
+			expected: "-ERR resulting score is not a number (NaN)\r\n",
+		},
+		{name: "zincrby creates", input: []Value{makeCommand("ZINCRBY", "zset:zincr", "2.5", "a")}, expected: "$3\r\n2.5\r\n"},
+		{
+			name:     "zrem last member deletes key",
+			input:    []Value{makeCommand("ZADD", "zset:rem", "1", "a"), makeCommand("ZREM", "zset:rem", "a", "b"), makeCommand("TYPE", "zset:rem")},
+			expected: "+none\r\n",
+		},
+		{name: "zscore missing", input: []Value{makeCommand("ZSCORE", "zset:missing", "a")}, expected: "$-1\r\n"},
+		{
+			name:     "zcard",
+			input:    []Value{makeCommand("ZADD", "zset:card", "1", "a", "2", "b"), makeCommand("ZCARD", "zset:card")},
+			expected: ":2\r\n",
+		},
+		{
+			name:     "zrank orders ties by member",
+			input:    []Value{makeCommand("ZADD", "zset:rank", "1", "b", "1", "a", "0", "c"), makeCommand("ZRANK", "zset:rank", "b")},
+			expected: ":2\r\n",
+		},
+		{
+			name:     "zrevrank with score",
+			input:    []Value{makeCommand("ZADD", "zset:revrank", "1", "a", "2", "b"), makeCommand("ZREVRANK", "zset:revrank", "a", "WITHSCORE")},
+			expected: "*2\r\n:1\r\n$1\r\n1\r\n",
+		},
+		{name: "zrank missing with score", input: []Value{makeCommand("ZRANK", "zset:missing", "a", "WITHSCORE")}, expected: "*-1\r\n"},
+		{
+			name:     "zcount",
+			input:    []Value{makeCommand("ZADD", "zset:count", "1", "a", "2", "b", "3", "c"), makeCommand("ZCOUNT", "zset:count", "(1", "+inf")},
+			expected: ":2\r\n",
+		},
+		{name: "zcount invalid range", input: []Value{makeCommand("ZCOUNT", "zset:count", "x", "1")}, expected: "-ERR min or max is not a float\r\n"},
+		{
+			name:     "zadd on a set",
+			input:    []Value{makeCommand("SADD", "zset:set", "a"), makeCommand("ZADD", "zset:set", "1", "a")},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCommands(t, tt.input...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestZSetResp3Scores(t *testing.T) {
+	result := runCommands(t,
+		makeCommand("HELLO", "3"),
+		makeCommand("ZADD", "zset:resp3", "1.5", "a"),
+		makeCommand("ZSCORE", "zset:resp3", "a"),
+	)
+
+	if expected := ",1.5\r\n"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestZSetRange(t *testing.T) {
+	setup := []Value{
+		makeCommand("ZADD", "zrange:scores", "1", "a", "2", "b", "3", "c", "4", "d"),
+		makeCommand("ZADD", "zrange:lex", "0", "a", "0", "b", "0", "c", "0", "d"),
+	}
+
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{name: "by rank", input: []Value{makeCommand("ZRANGE", "zrange:scores", "1", "-2")}, expected: "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{name: "by rank reversed", input: []Value{makeCommand("ZRANGE", "zrange:scores", "0", "1", "REV")}, expected: "*2\r\n$1\r\nd\r\n$1\r\nc\r\n"},
+		{
+			name:     "by rank with scores",
+			input:    []Value{makeCommand("ZRANGE", "zrange:scores", "0", "0", "WITHSCORES")},
+			expected: "*2\r\n$1\r\na\r\n$1\r\n1\r\n",
+		},
+		{name: "by rank out of range", input: []Value{makeCommand("ZRANGE", "zrange:scores", "10", "20")}, expected: "*0\r\n"},
+		{name: "by score exclusive", input: []Value{makeCommand("ZRANGE", "zrange:scores", "(1", "3", "BYSCORE")}, expected: "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{
+			name:     "by score reversed takes max first",
+			input:    []Value{makeCommand("ZRANGE", "zrange:scores", "+inf", "(2", "BYSCORE", "REV")},
+			expected: "*2\r\n$1\r\nd\r\n$1\r\nc\r\n",
+		},
+		{
+			name:     "by score with limit",
+			input:    []Value{makeCommand("ZRANGE", "zrange:scores", "-inf", "+inf", "BYSCORE", "LIMIT", "1", "2")},
+			expected: "*2\r\n$1\r\nb\r\n$1\r\nc\r\n",
+		},
+		{
+			name:     "by score with negative count",
+			input:    []Value{makeCommand("ZRANGE", "zrange:scores", "-inf", "+inf", "BYSCORE", "LIMIT", "3", "-1")},
+			expected: "*1\r\n$1\r\nd\r\n",
+		},
+		{name: "by lex", input: []Value{makeCommand("ZRANGE", "zrange:lex", "(a", "[c", "BYLEX")}, expected: "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{name: "by lex unbounded", input: []Value{makeCommand("ZRANGE", "zrange:lex", "+", "(c", "BYLEX", "REV")}, expected: "*1\r\n$1\r\nd\r\n"},
+		{name: "by lex empty range", input: []Value{makeCommand("ZRANGE", "zrange:lex", "+", "-", "BYLEX")}, expected: "*0\r\n"},
+		{name: "by lex invalid item", input: []Value{makeCommand("ZRANGE", "zrange:lex", "a", "+", "BYLEX")}, expected: "-ERR min or max not valid string range item\r\n"},
+		{
+			name:     "limit by rank",
+			input:    []Value{makeCommand("ZRANGE", "zrange:scores", "0", "1", "LIMIT", "0", "1")},
+			expected: "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n",
+		},
+		{
+			name:     "withscores by lex",
+			input:    []Value{makeCommand("ZRANGE", "zrange:lex", "-", "+", "BYLEX", "WITHSCORES")},
+			expected: "-ERR syntax error, WITHSCORES not supported in combination with BYLEX\r\n",
+		},
+		{
+			name:     "zrangestore",
+			input:    []Value{makeCommand("ZRANGESTORE", "zrange:dst", "zrange:scores", "2", "+inf", "BYSCORE"), makeCommand("ZRANGE", "zrange:dst", "0", "-1", "WITHSCORES")},
+			expected: "*6\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$1\r\n3\r\n$1\r\nd\r\n$1\r\n4\r\n",
+		},
+		{
+			name:     "zrangestore empty deletes the destination",
+			input:    []Value{makeCommand("SET", "zrange:dst2", "v"), makeCommand("ZRANGESTORE", "zrange:dst2", "zrange:scores", "5", "6"), makeCommand("TYPE", "zrange:dst2")},
+			expected: "+none\r\n",
+		},
+		{
+			name:     "zremrangebyrank",
+			input:    []Value{makeCommand("ZADD", "zrange:rem", "1", "a", "2", "b", "3", "c"), makeCommand("ZREMRANGEBYRANK", "zrange:rem", "0", "-2"), makeCommand("ZRANGE", "zrange:rem", "0", "-1")},
+			expected: "*1\r\n$1\r\nc\r\n",
+		},
+		{
+			name:     "zremrangebyscore",
+			input:    []Value{makeCommand("ZADD", "zrange:rem2", "1", "a", "2", "b", "3", "c"), makeCommand("ZREMRANGEBYSCORE", "zrange:rem2", "(1", "+inf")},
+			expected: ":2\r\n",
+		},
+		{
+			name:     "zremrangebylex deletes the key",
+			input:    []Value{makeCommand("ZADD", "zrange:rem3", "0", "a", "0", "b"), makeCommand("ZREMRANGEBYLEX", "zrange:rem3", "-", "+"), makeCommand("TYPE", "zrange:rem3")},
+			expected: "+none\r\n",
+		},
+		{name: "zlexcount", input: []Value{makeCommand("ZLEXCOUNT", "zrange:lex", "[b", "+")}, expected: ":3\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCommands(t, append(setup, tt.input...)...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestZSetRangeResp3WithScores(t *testing.T) {
+	result := runCommands(t,
+		makeCommand("HELLO", "3"),
+		makeCommand("ZADD", "zrange:resp3", "1", "a", "2.5", "b"),
+		makeCommand("ZRANGE", "zrange:resp3", "0", "-1", "WITHSCORES"),
+	)
+
+	if expected := "*2\r\n*2\r\n$1\r\na\r\n,1\r\n*2\r\n$1\r\nb\r\n,2.5\r\n"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestZSetOperations(t *testing.T) {
+	setup := []Value{
+		makeCommand("ZADD", "zop:a", "1", "x", "2", "y", "3", "z"),
+		makeCommand("ZADD", "zop:b", "10", "y", "20", "z", "30", "w"),
+		makeCommand("SADD", "zop:set", "z", "w"),
+	}
+
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{
+			name:     "zunion sums the scores",
+			input:    []Value{makeCommand("ZUNION", "2", "zop:a", "zop:b", "WITHSCORES")},
+			expected: "*8\r\n$1\r\nx\r\n$1\r\n1\r\n$1\r\ny\r\n$2\r\n12\r\n$1\r\nz\r\n$2\r\n23\r\n$1\r\nw\r\n$2\r\n30\r\n",
+		},
+		{
+			name:     "zinter with weights",
+			input:    []Value{makeCommand("ZINTER", "2", "zop:a", "zop:b", "WEIGHTS", "2", "0.5", "WITHSCORES")},
+			expected: "*4\r\n$1\r\ny\r\n$1\r\n9\r\n$1\r\nz\r\n$2\r\n16\r\n",
+		},
+		{
+			name:     "zinter aggregate max",
+			input:    []Value{makeCommand("ZINTER", "2", "zop:a", "zop:b", "AGGREGATE", "MAX", "WITHSCORES")},
+			expected: "*4\r\n$1\r\ny\r\n$2\r\n10\r\n$1\r\nz\r\n$2\r\n20\r\n",
+		},
+		{
+			name:     "sets score 1",
+			input:    []Value{makeCommand("ZUNION", "2", "zop:a", "zop:set", "AGGREGATE", "MIN", "WITHSCORES")},
+			expected: "*8\r\n$1\r\nw\r\n$1\r\n1\r\n$1\r\nx\r\n$1\r\n1\r\n$1\r\nz\r\n$1\r\n1\r\n$1\r\ny\r\n$1\r\n2\r\n",
+		},
+		{name: "zdiff", input: []Value{makeCommand("ZDIFF", "3", "zop:a", "zop:b", "zop:missing")}, expected: "*1\r\n$1\r\nx\r\n"},
+		{
+			name:     "zunionstore",
+			input:    []Value{makeCommand("ZUNIONSTORE", "zop:dst", "2", "zop:a", "zop:set", "WEIGHTS", "1", "5"), makeCommand("ZSCORE", "zop:dst", "z")},
+			expected: "$1\r\n8\r\n",
+		},
+		{
+			name:     "zinterstore replies with the cardinality",
+			input:    []Value{makeCommand("ZINTERSTORE", "zop:dst", "3", "zop:a", "zop:b", "zop:set")},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "zdiffstore empty deletes the destination",
+			input:    []Value{makeCommand("SET", "zop:dst", "v"), makeCommand("ZDIFFSTORE", "zop:dst", "2", "zop:a", "zop:a"), makeCommand("TYPE", "zop:dst")},
+			expected: "+none\r\n",
+		},
+		{name: "no keys", input: []Value{makeCommand("ZUNION", "0", "zop:a")}, expected: "-ERR at least 1 input key is needed for 'zunion' command\r\n"},
+		{name: "too many numkeys", input: []Value{makeCommand("ZINTER", "3", "zop:a", "zop:b")}, expected: "-ERR syntax error\r\n"},
+		{name: "invalid weight", input: []Value{makeCommand("ZUNION", "1", "zop:a", "WEIGHTS", "x")}, expected: "-ERR weight value is not a float\r\n"},
+		{name: "weights with zdiff", input: []Value{makeCommand("ZDIFF", "1", "zop:a", "WEIGHTS", "1")}, expected: "-ERR syntax error\r\n"},
+		{name: "withscores with store", input: []Value{makeCommand("ZUNIONSTORE", "zop:dst", "1", "zop:a", "WITHSCORES")}, expected: "-ERR syntax error\r\n"},
+		{
+			name:     "wrong type input",
+			input:    []Value{makeCommand("SET", "zop:str", "v"), makeCommand("ZUNION", "2", "zop:a", "zop:str")},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCommands(t, append(setup, tt.input...)...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestZSetPop(t *testing.T) {
+	setup := []Value{makeCommand("ZADD", "zpop", "1", "a", "2", "b", "3", "c")}
+
+	tests := []struct {
+		name     string
+		input    []Value
+		expected string
+	}{
+		{name: "zpopmin", input: []Value{makeCommand("ZPOPMIN", "zpop")}, expected: "*2\r\n$1\r\na\r\n$1\r\n1\r\n"},
+		{name: "zpopmax with count", input: []Value{makeCommand("ZPOPMAX", "zpop", "2")}, expected: "*4\r\n$1\r\nc\r\n$1\r\n3\r\n$1\r\nb\r\n$1\r\n2\r\n"},
+		{name: "zpopmin missing key", input: []Value{makeCommand("ZPOPMIN", "zpop:missing")}, expected: "*0\r\n"},
+		{
+			name:     "popping everything deletes the key",
+			input:    []Value{makeCommand("ZPOPMIN", "zpop", "10"), makeCommand("TYPE", "zpop")},
+			expected: "+none\r\n",
+		},
+		{name: "negative count", input: []Value{makeCommand("ZPOPMIN", "zpop", "-1")}, expected: "-ERR value is out of range, must be positive\r\n"},
+		{
+			name:     "zmpop",
+			input:    []Value{makeCommand("ZMPOP", "2", "zpop:missing", "zpop", "MAX", "COUNT", "2")},
+			expected: "*2\r\n$4\r\nzpop\r\n*2\r\n*2\r\n$1\r\nc\r\n$1\r\n3\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		},
+		{name: "zmpop empty", input: []Value{makeCommand("ZMPOP", "1", "zpop:missing", "MIN")}, expected: "*-1\r\n"},
+		{name: "zmpop invalid where", input: []Value{makeCommand("ZMPOP", "1", "zpop", "LEFT")}, expected: "-ERR syntax error\r\n"},
+		{name: "bzpopmin with data", input: []Value{makeCommand("BZPOPMIN", "zpop:missing", "zpop", "0")}, expected: "*3\r\n$4\r\nzpop\r\n$1\r\na\r\n$1\r\n1\r\n"},
+		{
+			name:     "bzmpop with data",
+			input:    []Value{makeCommand("BZMPOP", "0", "1", "zpop", "MIN")},
+			expected: "*2\r\n$4\r\nzpop\r\n*1\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runCommands(t, append(setup, tt.input...)...)
+			if result != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestZSetScan(t *testing.T) {
+	input := makeCommand("ZADD", "zset:scan")
+	for i := 0; i < 50; i++ {
+		input.array = append(input.array, makeCommand(strconv.Itoa(i)+".5", "m"+strconv.Itoa(i)).array...)
+	}
+	runCommands(t, input)
+
+	elements := scanAll(t, []string{"ZSCAN", "zset:scan"}, "COUNT", "3")
+	scores := make(map[string]string)
+	for i := 0; i < len(elements); i += 2 {
+		scores[elements[i]] = elements[i+1]
+	}
+	if len(scores) != 50 || scores["m7"] != "7.5" {
+		t.Errorf("expected the 50 members with their scores, got %v", scores)
+	}
+
+	if result, expected := runCommands(t, makeCommand("ZSCAN", "zset:scan", "0", "MATCH", "m42", "COUNT", "1000")), "*2\r\n$1\r\n0\r\n*2\r\n$3\r\nm42\r\n$4\r\n42.5\r\n"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}